@@ -18,6 +18,7 @@ import (
 	yuConfig "github.com/yu-org/yu/config"
 	"github.com/yu-org/yu/core/kernel"
 	"github.com/yu-org/yu/core/startup"
+	"github.com/yu-org/yu/core/txpool"
 	"gorm.io/gorm"
 
 	"github.com/reddio-com/reddio/bridge/checker"
@@ -82,6 +83,9 @@ func loadAllCfg(evmPath, yuPath, poaPath, configPath string) (*yuConfig.KernelCo
 	poaCfg := poa.LoadCfgFromPath(poaPath)
 	evmCfg := evm.LoadEvmConfig(evmPath)
 	err := config.LoadConfig(configPath)
+	if err == nil && !evmCfg.NoBaseFee {
+		err = evm.CheckBaseFeeGasLimit(yuCfg.LeiLimit)
+	}
 	return yuCfg, poaCfg, evmCfg, err
 }
 
@@ -107,7 +111,7 @@ func StartUpChain(yuCfg *yuConfig.KernelConf, poaCfg *poa.PoaConfig, evmCfg *evm
 	}
 	chain := InitReddio(yuCfg, poaCfg, evmCfg, db)
 
-	ethrpc.StartupEthRPC(chain, evmCfg)
+	ethrpc.StartupEthRPC(chain, evmCfg, yuCfg.SyncMode)
 	if evmCfg.EnableBridge {
 		//StartupL1Watcher(evmCfg, db)
 		//StartupL2Watcher(evmCfg, db)
@@ -137,9 +141,11 @@ func InitReddio(yuCfg *yuConfig.KernelConf, poaCfg *poa.PoaConfig, evmCfg *evm.G
 	parallelTri := parallel.NewParallelEVM()
 	//watcherTri := watcher.NewL2EventsWatcherTripod(evmCfg, db)
 
+	startup.Pool = evm.NewTxPool(txpool.WithDefaultChecks(yuCfg.NodeType, &yuCfg.Txpool), evmCfg.TxPriceBump)
 	chain := startup.InitDefaultKernel(yuCfg).WithTripods(poaTri, solidityTri, parallelTri)
 	// chain.WithExecuteFn(chain.OrderedExecute)
 	chain.WithExecuteFn(parallelTri.Execute)
+	chain.Pool.SetPackFilter(solidityTri.PackFilter)
 	return chain
 }
 
@@ -0,0 +1,251 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	yu_common "github.com/yu-org/yu/common"
+	yuConfig "github.com/yu-org/yu/config"
+	"github.com/yu-org/yu/core/blockchain"
+	"github.com/yu-org/yu/core/env"
+	"github.com/yu-org/yu/core/startup"
+	"github.com/yu-org/yu/core/tripod"
+	"github.com/yu-org/yu/core/txdb"
+	"github.com/yu-org/yu/core/types"
+	"github.com/yu-org/yu/infra/storage/kv"
+	"github.com/yu-org/yu/utils/codec"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm"
+	"github.com/reddio-com/reddio/parallel"
+)
+
+const ExecutorSerial = "serial"
+
+// ReplayOptions are the options of the replay subcommand.
+type ReplayOptions struct {
+	StartHeight uint64
+	EndHeight   uint64
+	// Executor is one of serial, batch and blockstm, empty means the configured one.
+	Executor string
+	// Concurrency overrides the configured maxConcurrency if it is positive.
+	Concurrency int
+}
+
+// BlockResult is the result of re-executing one block.
+type BlockResult struct {
+	Height       yu_common.BlockNum
+	TxnCount     int
+	FailedCount  int
+	ExpectedRoot common.Hash
+	ActualRoot   common.Hash
+	Stat         *parallel.BlockTxnStatManager
+}
+
+func (r *BlockResult) Mismatch() bool {
+	return r.ExpectedRoot != r.ActualRoot
+}
+
+type Replayer struct {
+	chain    types.IBlockChain
+	solidity *evm.Solidity
+	parallel *parallel.ParallelEVM
+}
+
+// StartReplay re-executes the blocks of the chain in the data dir of yu and exits with 1
+// if the state root of a block mismatches.
+func StartReplay(evmPath, yuPath, configPath string, opts *ReplayOptions) {
+	yuCfg := startup.InitKernelConfigFromPath(yuPath)
+	evmCfg := evm.LoadEvmConfig(evmPath)
+	if err := config.LoadConfig(configPath); err != nil {
+		logrus.Fatal("load reddio config failed: ", err)
+	}
+	if err := setupExecutor(opts); err != nil {
+		logrus.Fatal(err)
+	}
+	replayer, err := NewReplayer(yuCfg, evmCfg)
+	if err != nil {
+		logrus.Fatal("init replayer failed: ", err)
+	}
+	mismatches, err := replayer.Run(opts.StartHeight, opts.EndHeight)
+	if err != nil {
+		logrus.Fatal("replay failed: ", err)
+	}
+	if mismatches > 0 {
+		os.Exit(1)
+	}
+}
+
+func setupExecutor(opts *ReplayOptions) error {
+	cfg := config.GetGlobalConfig()
+	switch opts.Executor {
+	case "":
+	case ExecutorSerial:
+		cfg.IsParallel = false
+	case config.ExecutorBatch, config.ExecutorBlockStm:
+		cfg.IsParallel = true
+		cfg.ExecutorType = opts.Executor
+	default:
+		return fmt.Errorf("unknown executor %s", opts.Executor)
+	}
+	if opts.Concurrency > 0 {
+		cfg.MaxConcurrency = opts.Concurrency
+	}
+	return nil
+}
+
+// NewReplayer opens the chain and txn DBs of yu and wires the evm tripods on them,
+// without the p2p network and the txpool of the kernel.
+func NewReplayer(yuCfg *yuConfig.KernelConf, evmCfg *evm.GethConfig) (*Replayer, error) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	yuCfg.KVDB.Path = path.Join(yuCfg.DataDir, yuCfg.KVDB.Path)
+	if yuCfg.BlockChain.ChainDB.Dsn == "" {
+		yuCfg.BlockChain.ChainDB.Dsn = os.Getenv("chain_db_dsn")
+	}
+	if yuCfg.BlockChain.ChainDB.SqlDbType == "sqlite" {
+		yuCfg.BlockChain.ChainDB.Dsn = path.Join(yuCfg.DataDir, yuCfg.BlockChain.ChainDB.Dsn)
+	}
+	kvdb, err := kv.NewKvdb(&yuCfg.KVDB)
+	if err != nil {
+		return nil, err
+	}
+	txnDB, err := txdb.NewTxDB(yuCfg.NodeType, kvdb, yuCfg.TxnConf)
+	if err != nil {
+		return nil, err
+	}
+	chain := blockchain.NewBlockChain(yuCfg.NodeType, &yuCfg.BlockChain, txnDB)
+	chainEnv := &env.ChainEnv{
+		Chain: chain,
+		TxDB:  txnDB,
+	}
+
+	solidityTri := evm.NewSolidity(evmCfg)
+	parallelTri := parallel.NewParallelEVM()
+	if err = setupTripods(chainEnv, solidityTri, parallelTri); err != nil {
+		return nil, err
+	}
+	return &Replayer{
+		chain:    chain,
+		solidity: solidityTri,
+		parallel: parallelTri,
+	}, nil
+}
+
+func setupTripods(chainEnv *env.ChainEnv, tripodInstances ...any) error {
+	land := tripod.NewLand()
+	tripods := make([]*tripod.Tripod, 0, len(tripodInstances))
+	for _, v := range tripodInstances {
+		t := tripod.ResolveTripod(v)
+		t.SetChainEnv(chainEnv)
+		t.SetLand(land)
+		t.SetInstance(v)
+		tripods = append(tripods, t)
+	}
+	land.SetTripods(tripods...)
+	for _, v := range tripodInstances {
+		if err := tripod.InjectToTripod(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run re-executes the blocks in [start, end] on the state of their parent blocks,
+// and returns the number of blocks whose state root mismatches the chain.
+// end = 0 means the end block of the chain.
+func (r *Replayer) Run(start, end uint64) (int, error) {
+	if start == 0 {
+		start = 1
+	}
+	if end == 0 {
+		endBlock, err := r.chain.GetEndBlock()
+		if err != nil {
+			return 0, err
+		}
+		end = uint64(endBlock.Height)
+	}
+	if start > end {
+		return 0, fmt.Errorf("invalid block range [%d, %d]", start, end)
+	}
+	parent, err := r.chain.GetBlockByHeight(yu_common.BlockNum(start - 1))
+	if err != nil {
+		return 0, err
+	}
+	if err = r.solidity.OpenState(common.Hash(parent.StateRoot)); err != nil {
+		return 0, err
+	}
+
+	cfg := config.GetGlobalConfig()
+	logrus.Infof("replay blocks [%d, %d], parallel:%v, executor:%s, concurrency:%d",
+		start, end, cfg.IsParallel, cfg.ExecutorType, cfg.MaxConcurrency)
+	var (
+		mismatches   int
+		txnCount     int
+		executeTotal time.Duration
+	)
+	for height := start; height <= end; height++ {
+		block, err := r.chain.GetBlockByHeight(yu_common.BlockNum(height))
+		if err != nil {
+			return mismatches, err
+		}
+		result, err := r.replayBlock(parent, block)
+		if err != nil {
+			return mismatches, err
+		}
+		reportReplay(result)
+		if result.Mismatch() {
+			mismatches++
+		}
+		txnCount += result.TxnCount
+		executeTotal += result.Stat.ExecuteDuration
+		parent = block
+	}
+
+	var tps float64
+	if executeTotal > 0 {
+		tps = float64(txnCount) / executeTotal.Seconds()
+	}
+	logrus.Infof("replayed %d blocks, %d txns, execute cost:%v, tps:%.2f, state root mismatches:%d",
+		end-start+1, txnCount, executeTotal.String(), tps, mismatches)
+	return mismatches, nil
+}
+
+func (r *Replayer) replayBlock(parent, block *types.Block) (*BlockResult, error) {
+	sdb, err := r.solidity.StateAt(common.Hash(parent.StateRoot))
+	if err != nil {
+		return nil, fmt.Errorf("state of block(%d) not found: %v", parent.Height, err)
+	}
+	r.solidity.SetStateDB(sdb)
+	r.solidity.SetTxFees(nil)
+	r.solidity.StartBlock(block)
+
+	receipts, stat := r.parallel.Replay(block)
+	result := &BlockResult{
+		Height:       block.Height,
+		TxnCount:     len(block.Txns),
+		ExpectedRoot: common.Hash(block.StateRoot),
+		ActualRoot:   r.solidity.IntermediateRoot(block),
+		Stat:         stat,
+	}
+	for _, receipt := range receipts {
+		if receipt.Error != "" {
+			result.FailedCount++
+		}
+	}
+	return result, nil
+}
+
+func reportReplay(result *BlockResult) {
+	stat := result.Stat
+	logrus.Infof("block(%d) %v txn, failed:%v, total:%v, execute cost:%v, prepare:%v, copy:%v, txnBatch:%v, conflict:%v, redoBatch:%v, reExecute:%v",
+		result.Height, result.TxnCount, result.FailedCount, stat.ExecuteDuration.String(), stat.ExecuteTxnDuration.String(),
+		stat.PrepareDuration.String(), stat.CopyDuration.String(), stat.TxnBatchCount, stat.ConflictCount, stat.TxnBatchRedoCount, stat.TxnReExecuteCount)
+	if result.Mismatch() {
+		logrus.Errorf("block(%d) state root mismatch, expected %s, got %s",
+			result.Height, result.ExpectedRoot.Hex(), result.ActualRoot.Hex())
+	}
+}
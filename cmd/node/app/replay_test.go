@@ -0,0 +1,170 @@
+package app
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+	yu_common "github.com/yu-org/yu/common"
+	"github.com/yu-org/yu/core/env"
+	"github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm"
+	"github.com/reddio-com/reddio/parallel"
+)
+
+// testBlockChain serves the recorded blocks, the other methods of the chain are not used by the replay.
+type testBlockChain struct {
+	types.IBlockChain
+	blocks []*types.Block
+}
+
+func (c *testBlockChain) GetBlockByHeight(height yu_common.BlockNum) (*types.Block, error) {
+	return c.blocks[height], nil
+}
+
+func (c *testBlockChain) GetEndBlock() (*types.Block, error) {
+	return c.blocks[len(c.blocks)-1], nil
+}
+
+// writeTestGenesis chdirs into a new temp dir and commits the genesis state into the state db
+// of the default config, which is under the working dir. It returns the genesis root.
+func writeTestGenesis(t *testing.T, accounts ...common.Address) common.Hash {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	db, err := rawdb.Open(rawdb.OpenOptions{
+		Type:              "pebble",
+		Directory:         "reddio_db",
+		AncientsDirectory: filepath.Join("reddio_db", "ancient"),
+		Namespace:         "eth/db/chaindata/",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer db.Close()
+	tdb := triedb.NewDatabase(db, triedb.HashDefaults)
+	defer tdb.Close()
+	sdb, _ := state.New(ethtypes.EmptyRootHash, state.NewDatabaseWithNodeDB(db, tdb), nil)
+	for _, addr := range accounts {
+		sdb.AddBalance(addr, uint256.NewInt(params.Ether), 0)
+	}
+	root, err := sdb.Commit(0, true)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err = tdb.Commit(root, false); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return root
+}
+
+func newTestTransfer(t *testing.T, from, to common.Address, nonce uint64) *types.SignedTxn {
+	var (
+		gas      = hexutil.Uint64(params.TxGas)
+		gasPrice = big.NewInt(params.GWei)
+		value    = big.NewInt(1000)
+		n        = hexutil.Uint64(nonce)
+	)
+	args, _ := json.Marshal(&evm.TempTransactionArgs{From: &from, To: &to, Gas: &gas, GasPrice: (*hexutil.Big)(gasPrice), Value: (*hexutil.Big)(value), Nonce: &n})
+	byt, err := json.Marshal(&evm.TxRequest{
+		Origin:     from,
+		Address:    &to,
+		GasLimit:   uint64(gas),
+		GasPrice:   gasPrice,
+		Value:      value,
+		Nonce:      nonce,
+		V:          big.NewInt(27),
+		R:          big.NewInt(1),
+		S:          big.NewInt(1),
+		OriginArgs: args,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return &types.SignedTxn{
+		TxnHash: yu_common.Hash(common.BigToHash(new(big.Int).SetUint64(nonce + 1))),
+		Raw:     &types.UnsignedTxn{WrCall: &yu_common.WrCall{TripodName: "solidity", FuncName: "ExecuteTxn", Params: string(byt)}},
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var (
+		sender    = common.HexToAddress("0x0a")
+		recipient = common.HexToAddress("0x0b")
+	)
+	cfg := config.GetGlobalConfig()
+	old := *cfg
+	defer func() {
+		*config.GetGlobalConfig() = old
+	}()
+
+	genesis := &types.Block{Header: &types.Header{Height: 0, StateRoot: yu_common.Hash(writeTestGenesis(t, sender))}}
+	block := &types.Block{
+		Header: &types.Header{Height: 1, Timestamp: 1, LeiLimit: 30000000, PrevHash: genesis.Hash, StateRoot: yu_common.Hash(ethtypes.EmptyRootHash)},
+		Txns:   types.SignedTxns{newTestTransfer(t, sender, recipient, 0), newTestTransfer(t, sender, recipient, 1)},
+	}
+	chain := &testBlockChain{blocks: []*types.Block{genesis, block}}
+	solidity := evm.NewSolidity(&evm.GethConfig{
+		ChainConfig: params.AllEthashProtocolChanges,
+		Coinbase:    common.HexToAddress("0x0c"),
+		Random:      &common.Hash{},
+		NoBaseFee:   true,
+	})
+	parallelTri := parallel.NewParallelEVM()
+	if err := setupTripods(&env.ChainEnv{Chain: chain}, solidity, parallelTri); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	replayer := &Replayer{chain: chain, solidity: solidity, parallel: parallelTri}
+
+	if err := setupExecutor(&ReplayOptions{Executor: ExecutorSerial}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if mismatches, err := replayer.Run(1, 0); err != nil || mismatches != 1 {
+		t.Fatalf("Expected a state root mismatch, but got %d mismatches, %v", mismatches, err)
+	}
+	if balance := solidity.StateDBCopy().GetBalance(recipient); balance.Uint64() != 2000 {
+		t.Fatalf("Expected the recipient to receive 2000, but got %v", balance)
+	}
+
+	// the block is recorded with the state root of the serial execution, which every executor
+	// must reproduce from the state of the parent block.
+	result, err := replayer.replayBlock(genesis, block)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if result.TxnCount != 2 || result.FailedCount != 0 || result.ActualRoot == common.Hash(genesis.StateRoot) {
+		t.Fatalf("Expected the 2 txns to be executed, but got %+v", result)
+	}
+	block.StateRoot = yu_common.Hash(result.ActualRoot)
+	for _, executor := range []string{ExecutorSerial, config.ExecutorBatch, config.ExecutorBlockStm} {
+		if err = setupExecutor(&ReplayOptions{Executor: executor, Concurrency: 2}); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		result, err = replayer.replayBlock(genesis, block)
+		if err != nil || result.Mismatch() {
+			t.Fatalf("Expected the %s replay to match the state root, but got %+v, %v", executor, result, err)
+		}
+	}
+	if err = setupExecutor(&ReplayOptions{Executor: "unknown"}); err == nil {
+		t.Fatalf("Expected an error of the unknown executor")
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm"
+)
+
+// VerifyBlockOptions are the options of the verify-block subcommand.
+type VerifyBlockOptions struct {
+	// WitnessPath is the file of the encoded execution witness, or of the json result
+	// of `debug_executionWitness`.
+	WitnessPath string
+	// BlockPath is the file of the json result of `eth_getBlockByNumber`.
+	BlockPath string
+}
+
+// StartVerifyBlock re-executes the block from its execution witness and exits with 1 if
+// the state root mismatches the header.
+func StartVerifyBlock(evmPath, configPath string, opts *VerifyBlockOptions) {
+	evmCfg := evm.LoadEvmConfig(evmPath)
+	if err := config.LoadConfig(configPath); err != nil {
+		logrus.Fatal("load reddio config failed: ", err)
+	}
+	witness, err := ReadWitness(opts.WitnessPath)
+	if err != nil {
+		logrus.Fatal("read witness failed: ", err)
+	}
+	header, err := ReadHeader(opts.BlockPath)
+	if err != nil {
+		logrus.Fatal("read block failed: ", err)
+	}
+	result, err := evm.VerifyBlock(evmCfg, witness, header)
+	if err != nil {
+		logrus.Fatal("verify block failed: ", err)
+	}
+	logrus.Infof("block(%d) %v txn, failed:%v, expected root %s, got %s",
+		result.Height, result.TxnCount, result.FailedCount, result.ExpectedRoot.Hex(), result.ActualRoot.Hex())
+	if result.Mismatch() {
+		logrus.Errorf("block(%d) state root mismatch", result.Height)
+		os.Exit(1)
+	}
+}
+
+// ReadWitness reads the execution witness from the file, it is either the encoded witness
+// as it is stored by the node or the json result of `debug_executionWitness`.
+func ReadWitness(path string) (*evm.ExecutionWitness, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(byt); len(trimmed) > 0 && trimmed[0] == '{' {
+		var result struct {
+			Witness hexutil.Bytes `json:"witness"`
+		}
+		if err = json.Unmarshal(trimmed, &result); err != nil {
+			return nil, err
+		}
+		byt = result.Witness
+	}
+	return evm.DecodeWitness(byt)
+}
+
+// ReadHeader reads the header of the block from the json result of `eth_getBlockByNumber`.
+func ReadHeader(path string) (*types.Header, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	header := new(types.Header)
+	if err = json.Unmarshal(byt, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/sirupsen/logrus"
 
@@ -32,6 +33,16 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			replay(os.Args[2:])
+			return
+		case "verify-block":
+			verifyBlock(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
 	switch loadConfigType {
 	case "s3":
@@ -53,3 +64,31 @@ func main() {
 
 	}
 }
+
+// replay re-executes the blocks of the local chain offline, `reddio replay -start 100 -end 200`.
+func replay(args []string) {
+	var opts app.ReplayOptions
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.StringVar(&evmConfigPath, "evm-config", "./conf/evm.toml", "path to evm-config file")
+	fs.StringVar(&yuConfigPath, "yu-config", "./conf/yu.toml", "path to yu-config file")
+	fs.StringVar(&ReddioConfigPath, "reddio-config", "./conf/config.toml", "path to reddio-config file")
+	fs.Uint64Var(&opts.StartHeight, "start", 1, "first block to replay")
+	fs.Uint64Var(&opts.EndHeight, "end", 0, "last block to replay, 0 means the end block of the chain")
+	fs.StringVar(&opts.Executor, "executor", "", "executor to replay with: serial, batch or blockstm, empty means the configured one")
+	fs.IntVar(&opts.Concurrency, "concurrency", 0, "max concurrency of the parallel executor, 0 means the configured one")
+	_ = fs.Parse(args)
+	app.StartReplay(evmConfigPath, yuConfigPath, ReddioConfigPath, &opts)
+}
+
+// verifyBlock re-executes a block statelessly from its execution witness,
+// `reddio verify-block -witness witness.json -block block.json`.
+func verifyBlock(args []string) {
+	var opts app.VerifyBlockOptions
+	fs := flag.NewFlagSet("verify-block", flag.ExitOnError)
+	fs.StringVar(&evmConfigPath, "evm-config", "./conf/evm.toml", "path to evm-config file")
+	fs.StringVar(&ReddioConfigPath, "reddio-config", "./conf/config.toml", "path to reddio-config file")
+	fs.StringVar(&opts.WitnessPath, "witness", "", "path to the execution witness, either encoded or the result of debug_executionWitness")
+	fs.StringVar(&opts.BlockPath, "block", "", "path to the block, the result of eth_getBlockByNumber")
+	_ = fs.Parse(args)
+	app.StartVerifyBlock(evmConfigPath, ReddioConfigPath, &opts)
+}
@@ -7,14 +7,29 @@ import (
 	"github.com/BurntSushi/toml"
 )
 
+const (
+	// ExecutorBatch splits the block into conflict-free batches and redoes a
+	// batch serially when a conflict is met.
+	ExecutorBatch = "batch"
+	// ExecutorBlockStm executes optimistically and only re-executes the
+	// transactions which read stale values.
+	ExecutorBlockStm = "blockstm"
+)
+
 type Config struct {
-	IsParallel      bool            `yaml:"isParallel"`
-	MaxConcurrency  int             `yaml:"maxConcurrency"`
-	IsBenchmarkMode bool            `yaml:"isBenchmarkMode"`
-	AsyncCommit     bool            `yaml:"asyncCommit"`
-	IgnoreConflict  bool            `yaml:"ignoreConflict"`
-	RateLimitConfig RateLimitConfig `yaml:"rateLimitConfig"`
-	ExtraBalanceGas uint64          `yaml:"extraBalanceGas"`
+	IsParallel            bool            `yaml:"isParallel"`
+	ExecutorType          string          `yaml:"executorType"`
+	MaxConcurrency        int             `yaml:"maxConcurrency"`
+	IsBenchmarkMode       bool            `yaml:"isBenchmarkMode"`
+	AsyncCommit           bool            `yaml:"asyncCommit"`
+	IgnoreConflict        bool            `yaml:"ignoreConflict"`
+	RateLimitConfig       RateLimitConfig `yaml:"rateLimitConfig"`
+	ExtraBalanceGas       uint64          `yaml:"extraBalanceGas"`
+	PredictAccessList     bool            `yaml:"predictAccessList"`
+	ConflictHeatmapWindow int             `yaml:"conflictHeatmapWindow"`
+	ConflictHeatmapTopN   int             `yaml:"conflictHeatmapTopN"`
+	DiffExecution         bool            `yaml:"diffExecution"`
+	DiffReportDir         string          `yaml:"diffReportDir"`
 }
 
 type RateLimitConfig struct {
@@ -23,9 +38,13 @@ type RateLimitConfig struct {
 
 func defaultConfig() *Config {
 	return &Config{
-		AsyncCommit:    false,
-		IsParallel:     true,
-		MaxConcurrency: runtime.NumCPU(),
+		AsyncCommit:           false,
+		IsParallel:            true,
+		ExecutorType:          ExecutorBatch,
+		MaxConcurrency:        runtime.NumCPU(),
+		ConflictHeatmapWindow: 100,
+		ConflictHeatmapTopN:   20,
+		DiffReportDir:         "diff_reports",
 		RateLimitConfig: RateLimitConfig{
 			GetReceipt: 2000,
 		},
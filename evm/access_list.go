@@ -0,0 +1,47 @@
+package evm
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const predictedAccessListCacheSize = 100000
+
+// predictedAccessLists caches the access lists predicted by a dry run of
+// transactions when they are admitted into the txpool. They are only hints
+// for the scheduling of the parallel executor, which never trusts them.
+var predictedAccessLists = lru.NewCache[common.Hash, types.AccessList](predictedAccessListCacheSize)
+
+// SetPredictedAccessList caches the predicted access list of the txn.
+func SetPredictedAccessList(txHash common.Hash, al types.AccessList) {
+	predictedAccessLists.Add(txHash, al)
+}
+
+// PredictedAccessList returns the cached predicted access list of the txn.
+func PredictedAccessList(txHash common.Hash) (types.AccessList, bool) {
+	return predictedAccessLists.Get(txHash)
+}
+
+// AccessList returns the EIP-2930 access list carried by the txn. If the txn
+// has none, the predicted access list is returned instead.
+func (tr *TxRequest) AccessList() (types.AccessList, bool) {
+	if al := tr.TxAccessList(); len(al) > 0 {
+		return al, true
+	}
+	return PredictedAccessList(tr.Hash)
+}
+
+// TxAccessList returns the EIP-2930 access list carried by the txn only.
+func (tr *TxRequest) TxAccessList() types.AccessList {
+	if len(tr.OriginArgs) == 0 {
+		return nil
+	}
+	txArgs := &TempTransactionArgs{}
+	if err := json.Unmarshal(tr.OriginArgs, txArgs); err != nil || txArgs.AccessList == nil {
+		return nil
+	}
+	return *txArgs.AccessList
+}
@@ -0,0 +1,91 @@
+package evm
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/core/bloombits"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// BloomSectionSize is the number of blocks in a section of the bloombits index.
+const BloomSectionSize = params.BloomBitsBlocks
+
+var bloomSectionsKey = []byte("reddio-bloombits-sections")
+
+// fullBloom matches everything, it is indexed for the blocks committed before their
+// logs bloom was stored, so that their logs are always checked.
+var fullBloom = func() types.Bloom {
+	var bloom types.Bloom
+	for i := range bloom {
+		bloom[i] = 0xff
+	}
+	return bloom
+}()
+
+// HasBlockBloom reports whether the logs bloom of the block is stored.
+func HasBlockBloom(db ethdb.KeyValueReader, height uint64) bool {
+	has, err := db.Has(blockBloomKey(height))
+	return err == nil && has
+}
+
+// ReadBloomSections returns the number of the sections in the bloombits index.
+func ReadBloomSections(db ethdb.KeyValueReader) uint64 {
+	data, err := db.Get(bloomSectionsKey)
+	if err != nil || len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// ReadBloomBits returns the compressed bloombits vector of the bit in the section.
+// The blocks are final once committed, so the sections are not keyed by their head hash.
+func ReadBloomBits(db ethdb.KeyValueReader, bit uint, section uint64) ([]byte, error) {
+	return rawdb.ReadBloomBits(db, bit, section, common.Hash{})
+}
+
+// IndexBloomBits writes the bloombits of the next section once it is completed by the
+// block at height. At most one section is written per block, so the sections missing
+// from the index, e.g. after an upgrade, are caught up without stalling the chain.
+func IndexBloomBits(db ethdb.Database, height uint64) error {
+	sections := ReadBloomSections(db)
+	if (sections+1)*BloomSectionSize > height+1 {
+		return nil
+	}
+	return indexBloomSection(db, sections)
+}
+
+func indexBloomSection(db ethdb.Database, section uint64) error {
+	gen, err := bloombits.NewGenerator(uint(BloomSectionSize))
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < BloomSectionSize; i++ {
+		height := section*BloomSectionSize + i
+		bloom := fullBloom
+		if HasBlockBloom(db, height) {
+			bloom = ReadBlockBloom(db, height)
+		}
+		if err = gen.AddBloom(uint(i), bloom); err != nil {
+			return err
+		}
+	}
+	batch := db.NewBatch()
+	for bit := uint(0); bit < types.BloomBitLength; bit++ {
+		bits, err := gen.Bitset(bit)
+		if err != nil {
+			return err
+		}
+		rawdb.WriteBloomBits(batch, bit, section, common.Hash{}, bitutil.CompressBytes(bits))
+	}
+	var sections [8]byte
+	binary.BigEndian.PutUint64(sections[:], section+1)
+	if err = batch.Put(bloomSectionsKey, sections[:]); err != nil {
+		return err
+	}
+	return batch.Write()
+}
@@ -0,0 +1,55 @@
+package evm
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestIndexBloomBits(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	bloom := types.BytesToBloom(nil)
+	bloom.Add(common.HexToAddress("0x01").Bytes())
+	for height := uint64(0); height < BloomSectionSize; height++ {
+		if height == 5 {
+			if err := WriteBlockBloom(db, height, bloom); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+		} else if height > 0 {
+			// the bloom of the genesis block is not stored, it matches everything.
+			if err := WriteBlockBloom(db, height, types.Bloom{}); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+		}
+		if err := IndexBloomBits(db, height); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if height < BloomSectionSize-1 && ReadBloomSections(db) != 0 {
+			t.Fatalf("Expected no section indexed at height %d, but got %d", height, ReadBloomSections(db))
+		}
+	}
+	if ReadBloomSections(db) != 1 {
+		t.Fatalf("Expected 1 section indexed, but got %d", ReadBloomSections(db))
+	}
+
+	for bit := uint(0); bit < types.BloomBitLength; bit++ {
+		comp, err := ReadBloomBits(db, bit, 0)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		bits, err := bitutil.DecompressBytes(comp, int(BloomSectionSize/8))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if bits[0]&0x80 == 0 {
+			t.Fatalf("Expected bit %d of the genesis block set, but it is not", bit)
+		}
+		inBloom := bloom[types.BloomByteLength-1-bit/8]&(1<<(bit%8)) != 0
+		if inBlock := bits[0]&(0x80>>5) != 0; inBlock != inBloom {
+			t.Fatalf("Expected bit %d of block 5 to be %v, but got %v", bit, inBloom, inBlock)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package evm
 
 import (
+	"maps"
 	"math/big"
+	"slices"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -52,10 +54,44 @@ type GethConfig struct {
 	EnableEthRPC bool   `toml:"enable_eth_rpc"`
 	EthHost      string `toml:"eth_host"`
 	EthPort      string `toml:"eth_port"`
+	// EnableEthWS serves the websocket RPC on the same host and port as the http RPC.
+	EnableEthWS bool     `toml:"enable_eth_ws"`
+	WSOrigins   []string `toml:"ws_origins"`
+	// LogsMaxBlockRange and LogsMaxResults cap the block range and the number of logs
+	// of an `eth_getLogs` query, zero means no limit.
+	LogsMaxBlockRange uint64 `toml:"logs_max_block_range"`
+	LogsMaxResults    int    `toml:"logs_max_results"`
+	// SyncUpstream is the eth RPC url of the node this node follows, e.g. the sequencer. Its
+	// head is the highest block of `eth_syncing`, without it the head of the boot node is
+	// used in the full sync mode of yu, and the local head otherwise.
+	SyncUpstream string `toml:"sync_upstream"`
+	// HealthMaxBlocksBehind is the max number of blocks the node may be behind the highest
+	// block before `/health` and `/ready` fail.
+	HealthMaxBlocksBehind uint64 `toml:"health_max_blocks_behind"`
+	// RPCGateway guards the http and websocket RPC of a public endpoint.
+	RPCGateway RPCGatewayConfig `toml:"rpc_gateway"`
 
 	// chainID
 	ChainID int64 `toml:"chain_id"`
 
+	// RecordTraces records the parity style flat call traces of the txns when they are
+	// executed, so that the `trace_*` RPC methods do not re-execute the historical blocks.
+	RecordTraces bool `toml:"record_traces"`
+	// RecordWitness stores the execution witness of every committed block, the pre-state trie
+	// nodes, codes, block hashes and txns a stateless verifier, e.g. a ZK prover, needs.
+	RecordWitness bool `toml:"record_witness"`
+	// TxPriceBump is the minimum price bump in percent to replace a txn of the txpool
+	// with the same sender and nonce.
+	TxPriceBump uint64 `toml:"tx_price_bump"`
+
+	// Fee market configs
+	// NoBaseFee disables the base fee, txns then pay their gas price to the coinbase entirely.
+	NoBaseFee bool `toml:"no_base_fee"`
+	// GasPriceCheckBlocks is the number of recent blocks the gas price oracle samples the tips
+	// from, and GasPricePercentile is the percentile of the sampled tips it suggests.
+	GasPriceCheckBlocks int `toml:"gpo_check_blocks"`
+	GasPricePercentile  int `toml:"gpo_percentile"`
+
 	// EventsWatcher configs
 	EnableBridge               bool             `toml:"enable_bridge"`
 	L1ClientAddress            string           `toml:"l1_client_address"`
@@ -82,6 +118,49 @@ type GethConfig struct {
 	EnableBridgeChecker bool                `toml:"enable_bridge_checker"`
 	BridgeCheckerConfig BridgeCheckerConfig `toml:"bridge_checker_config"`
 }
+
+// RPCGatewayConfig configs the limits of the http RPC requests and the websocket messages,
+// zero means no limit.
+type RPCGatewayConfig struct {
+	// MaxBatchSize caps the number of calls of a batch request.
+	MaxBatchSize int `toml:"max_batch_size"`
+	// MaxResponseSize caps the size of a response in bytes.
+	MaxResponseSize int `toml:"max_response_size"`
+	// RequireAPIKey rejects the requests without an API key.
+	RequireAPIKey bool `toml:"require_api_key"`
+	// IPRateLimit limits the requests without an API key per IP.
+	IPRateLimit RPCRateLimit `toml:"ip_rate_limit"`
+	// APIKeys are the keys passed in the X-API-Key header or the api_key query parameter.
+	APIKeys []RPCAPIKey `toml:"api_keys"`
+	// TrustedProxies are the IPs or the CIDRs of the proxies whose CF-Connecting-IP,
+	// X-Forwarded-For and X-Real-Ip headers are trusted, the headers of the other
+	// requests are ignored and their remote IPs are limited.
+	TrustedProxies []string `toml:"trusted_proxies"`
+}
+
+// RPCRateLimit is the token bucket of the calls of every method, Methods overrides it
+// for the listed methods.
+type RPCRateLimit struct {
+	RPS     float64                   `toml:"rps"`
+	Burst   int                       `toml:"burst"`
+	Methods map[string]RPCMethodLimit `toml:"methods"`
+}
+
+type RPCMethodLimit struct {
+	RPS   float64 `toml:"rps"`
+	Burst int     `toml:"burst"`
+}
+
+// RPCAPIKey limits the requests with the key. Allow and Deny list the methods, or the
+// namespaces as "eth_*", an empty Allow allows all of them.
+type RPCAPIKey struct {
+	Key        string       `toml:"key"`
+	RateLimit  RPCRateLimit `toml:"rate_limit"`
+	DailyQuota uint64       `toml:"daily_quota"`
+	Allow      []string     `toml:"allow"`
+	Deny       []string     `toml:"deny"`
+}
+
 type BridgeWatcherConfig struct {
 	Confirmation uint64 `toml:"confirmation"`
 	FetchLimit   uint64 `toml:"fetch_limit"`
@@ -101,30 +180,34 @@ type BridgeCheckerConfig struct {
 	CheckL2ContractAddress string `toml:"check_l2_contract_address"`
 }
 
+// Copy copies every field of the config, the slices and the maps of the RPC configs are
+// not shared with the copy.
 func (gc *GethConfig) Copy() *GethConfig {
-	return &GethConfig{
-		ChainConfig:  gc.ChainConfig,
-		GetHashFn:    gc.GetHashFn,
-		Coinbase:     gc.Coinbase,
-		GasLimit:     gc.GasLimit,
-		BlockNumber:  gc.BlockNumber,
-		Time:         gc.Time,
-		Difficulty:   gc.Difficulty,
-		BaseFee:      gc.BaseFee,
-		BlobBaseFee:  gc.BlobBaseFee,
-		Random:       gc.Random,
-		Origin:       gc.Origin,
-		GasPrice:     gc.GasPrice,
-		BlobHashes:   gc.BlobHashes,
-		BlobFeeCap:   gc.BlobFeeCap,
-		State:        gc.State,
-		Value:        gc.Value,
-		Debug:        gc.Debug,
-		EVMConfig:    gc.EVMConfig,
-		EnableEthRPC: gc.EnableEthRPC,
-		EthHost:      gc.EthHost,
-		EthPort:      gc.EthPort,
+	cp := *gc
+	cp.BlobHashes = slices.Clone(gc.BlobHashes)
+	cp.WSOrigins = slices.Clone(gc.WSOrigins)
+	cp.RPCGateway = gc.RPCGateway.Copy()
+	return &cp
+}
+
+// Copy deep copies the limits, the keys and the proxies of the gateway.
+func (c RPCGatewayConfig) Copy() RPCGatewayConfig {
+	cp := c
+	cp.IPRateLimit = c.IPRateLimit.Copy()
+	cp.APIKeys = slices.Clone(c.APIKeys)
+	for i := range cp.APIKeys {
+		key := &cp.APIKeys[i]
+		key.RateLimit = key.RateLimit.Copy()
+		key.Allow = slices.Clone(key.Allow)
+		key.Deny = slices.Clone(key.Deny)
 	}
+	cp.TrustedProxies = slices.Clone(c.TrustedProxies)
+	return cp
+}
+
+func (l RPCRateLimit) Copy() RPCRateLimit {
+	l.Methods = maps.Clone(l.Methods)
+	return l
 }
 
 // sets defaults on the config
@@ -150,7 +233,15 @@ func SetDefaultGethConfig(fpath string) *GethConfig {
 		GetHashFn: func(n uint64) common.Hash {
 			return common.BytesToHash(crypto.Keccak256([]byte(new(big.Int).SetUint64(n).String())))
 		},
-		ChainID: 50341,
+		ChainID:               50341,
+		LogsMaxBlockRange:     500,
+		LogsMaxResults:        10000,
+		TxPriceBump:           10,
+		HealthMaxBlocksBehind: 10,
+		NoBaseFee:             true,
+		// from geth->config.go->FullNodeGPO
+		GasPriceCheckBlocks: 20,
+		GasPricePercentile:  60,
 	}
 	_, err := toml.DecodeFile(fpath, cfg)
 	if err != nil {
@@ -0,0 +1,53 @@
+package evm
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestGethConfigCopy(t *testing.T) {
+	cfg := &GethConfig{
+		ChainConfig:           params.AllEthashProtocolChanges,
+		Coinbase:              common.HexToAddress("0x3E2D75F83e775761890d9ab9389eCF6C9D6017eB"),
+		GasPrice:              big.NewInt(1),
+		EnableEthRPC:          true,
+		EnableEthWS:           true,
+		WSOrigins:             []string{"https://reddio.com"},
+		LogsMaxBlockRange:     1000,
+		SyncUpstream:          "http://127.0.0.1:9092",
+		HealthMaxBlocksBehind: 10,
+		RPCGateway: RPCGatewayConfig{
+			MaxBatchSize:   100,
+			IPRateLimit:    RPCRateLimit{RPS: 10, Methods: map[string]RPCMethodLimit{"eth_call": {RPS: 1}}},
+			APIKeys:        []RPCAPIKey{{Key: "key", Allow: []string{"eth_*"}}},
+			TrustedProxies: []string{"10.0.0.0/8"},
+		},
+		ChainID:             50341,
+		RecordWitness:       true,
+		TxPriceBump:         10,
+		NoBaseFee:           true,
+		GasPriceCheckBlocks: 20,
+		GasPricePercentile:  60,
+		EnableBridge:        true,
+	}
+
+	cp := cfg.Copy()
+	if !reflect.DeepEqual(cfg, cp) {
+		t.Fatalf("Expected the copy to equal the config, but got %+v", cp)
+	}
+
+	cp.WSOrigins[0] = "*"
+	cp.RPCGateway.IPRateLimit.Methods["eth_call"] = RPCMethodLimit{RPS: 2}
+	cp.RPCGateway.APIKeys[0].Allow[0] = "debug_*"
+	cp.RPCGateway.TrustedProxies[0] = "0.0.0.0/0"
+	if cfg.WSOrigins[0] != "https://reddio.com" ||
+		cfg.RPCGateway.IPRateLimit.Methods["eth_call"].RPS != 1 ||
+		cfg.RPCGateway.APIKeys[0].Allow[0] != "eth_*" ||
+		cfg.RPCGateway.TrustedProxies[0] != "10.0.0.0/8" {
+		t.Fatalf("Expected the copy not to share the slices and maps, but got %+v", cfg.RPCGateway)
+	}
+}
@@ -16,6 +16,17 @@ var (
 	ErrAlreadyKnown = errors.New("already known")
 
 	ErrNotFoundReceipt = errors.New("receipt not found")
+
+	ErrGenesisNotTraceable = errors.New("genesis is not traceable")
+
+	// ErrStateUnavailable is returned if the trie nodes of the state are missing.
+	ErrStateUnavailable = errors.New("state is not available")
+
+	// ErrWitnessVersion is returned if an execution witness is encoded with an unknown version.
+	ErrWitnessVersion = errors.New("unknown execution witness version")
+	// ErrWitnessIncomplete is returned if a block reads a trie node, a code or a block hash
+	// its execution witness does not supply.
+	ErrWitnessIncomplete = errors.New("execution witness is incomplete")
 )
 
 // RevertError is an API error that encompasses an EVM revert with JSON error
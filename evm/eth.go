@@ -9,7 +9,6 @@ import (
 	"math/big"
 	"net/http"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -18,7 +17,9 @@ import (
 	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/holiman/uint256"
 	"github.com/sirupsen/logrus"
@@ -58,7 +59,20 @@ type Solidity struct {
 	stateConfig *yuConfig.Config
 
 	// gasPool        *core.GasPool
-	coinbaseReward atomic.Uint64
+	// txFees are the fees of the txns executed in the current block, see BlockFees.
+	txFees map[common.Hash]*TxFee
+	// txTraces are the flat call traces of the txns executed in the current block, they are
+	// only recorded if RecordTraces is set.
+	txTraces map[common.Hash]json.RawMessage
+	// witness collects the state accessed by the txns executed in the current block, it is
+	// only used if RecordWitness is set.
+	witness *witnessRecorder
+	// packNonces are the next nonces of the senders in the block being packed.
+	packNonces map[common.Address]uint64
+	// packCosts are the max costs of the txns of the senders in the block being packed.
+	packCosts map[common.Address]*big.Int
+
+	blockFeed event.Feed
 }
 
 func (s *Solidity) StateDB() *state.StateDB {
@@ -174,6 +188,31 @@ func (s *Solidity) InitChain(genesisBlock *yu_types.Block) {
 	genesisBlock.StateRoot = yu_common.Hash(genesisStateRoot)
 }
 
+// OpenState opens the existing eth state at root without setting up the genesis,
+// it is used to re-execute the historical blocks offline.
+func (s *Solidity) OpenState(root common.Hash) error {
+	ethState, err := NewEthState(s.stateConfig, root)
+	if err != nil {
+		return err
+	}
+	s.ethState = ethState
+	s.cfg.State = ethState.stateDB
+	return nil
+}
+
+// IntermediateRoot rewards the coinbase as Commit does and returns the state root,
+// without committing the state.
+func (s *Solidity) IntermediateRoot(block *yu_types.Block) common.Hash {
+	s.Lock()
+	defer s.Unlock()
+	fees := newBlockFees(block, s.cfg.Coinbase, s.cfg.BaseFee, s.txFees)
+	s.ethState.AddBalance(s.cfg.Coinbase, fees.CoinbaseReward, tracing.BalanceIncreaseRewardTransactionFee)
+	s.txFees = make(map[common.Hash]*TxFee)
+	s.txTraces = make(map[common.Hash]json.RawMessage)
+	s.witness = newWitnessRecorder()
+	return s.ethState.StateDB().IntermediateRoot(true)
+}
+
 func NewSolidity(gethConfig *GethConfig) *Solidity {
 	ethStateConfig := setDefaultEthStateConfig()
 
@@ -181,6 +220,11 @@ func NewSolidity(gethConfig *GethConfig) *Solidity {
 		Tripod:      tripod.NewTripod(),
 		cfg:         gethConfig,
 		stateConfig: ethStateConfig,
+		packNonces:  make(map[common.Address]uint64),
+		packCosts:   make(map[common.Address]*big.Int),
+		txFees:      make(map[common.Hash]*TxFee),
+		txTraces:    make(map[common.Hash]json.RawMessage),
+		witness:     newWitnessRecorder(),
 		// network:       utils.Network(cfg.Network),
 	}
 	solidity.SetWritings(solidity.ExecuteTxn)
@@ -211,6 +255,12 @@ func (s *Solidity) StartBlock(block *yu_types.Block) {
 	s.cfg.GasLimit = block.LeiLimit
 	s.cfg.Time = block.Timestamp
 	s.cfg.Difficulty = big.NewInt(int64(block.Difficulty))
+	baseFee, err := s.calcBaseFee(block)
+	if err != nil {
+		logrus.Panicf("Solidity failed to calculate the base fee of Block(%d): %v", block.Height, err)
+	}
+	s.cfg.BaseFee = baseFee
+	SetHeaderBaseFee(block.Header, baseFee)
 }
 
 func (s *Solidity) EndBlock(block *yu_types.Block) {
@@ -218,7 +268,12 @@ func (s *Solidity) EndBlock(block *yu_types.Block) {
 }
 
 func (s *Solidity) FinalizeBlock(block *yu_types.Block) {
-	// nothing
+	s.blockFeed.Send(block)
+}
+
+// SubscribeFinalizedBlock notifies the blocks once they are executed and appended to the chain.
+func (s *Solidity) SubscribeFinalizedBlock(ch chan<- *yu_types.Block) event.Subscription {
+	return s.blockFeed.Subscribe(ch)
 }
 
 func (s *Solidity) PreHandleTxn(txn *yu_types.SignedTxn) error {
@@ -246,12 +301,18 @@ func (s *Solidity) CheckTxn(txn *yu_types.SignedTxn) error {
 	if req.IsInternalCall {
 		// TODO: use txn.Pubkey and txn.Signature to verify the tx
 	}
+	if err = s.checkPoolNonce(req); err != nil {
+		return err
+	}
 	return s.CheckGasfee(req)
 }
 
 func (s *Solidity) CheckGasfee(req *TxRequest) error {
 	s.Lock()
 	defer s.Unlock()
+	if _, _, err := effectiveGasPrice(req, s.cfg.BaseFee); err != nil {
+		return err
+	}
 	state := s.ethState.StateDB()
 	gasFee := new(big.Int).Mul(req.GasPrice, new(big.Int).SetUint64(req.GasLimit))
 	gasFeeU256, _ := uint256.FromBig(gasFee)
@@ -278,29 +339,77 @@ func (s *Solidity) ExecuteTxn(ctx *context.WriteContext) (err error) {
 			metrics.SolidityCounter.WithLabelValues(executeTxnLbl, statusErr).Inc()
 		}
 	}()
+
+	// the fee of a former execution of the txn is dropped when it is re-executed.
+	txHash := common.Hash(ctx.GetTxnHash())
+	delete(s.txFees, txHash)
+	delete(s.txTraces, txHash)
+
+	cfg := s.cfg
+	var tracer *tracers.Tracer
+	if s.cfg.RecordTraces {
+		if tracer, err = NewFlatCallTracer(ctx.Block, ctx.TxnIndex); err != nil {
+			logrus.Warnf("Solidity failed to create the tracer of txn(%s), error: %v", txHash.String(), err)
+		} else {
+			traced := *s.cfg
+			traced.EVMConfig.Tracer = tracer.Hooks
+			cfg = &traced
+		}
+	}
+	if s.cfg.RecordWitness {
+		witnessed := *cfg
+		witnessed.GetHashFn = s.witness.getHashFn(cfg.GetHashFn)
+		cfg = &witnessed
+	}
+
+	fee, err := s.applyTxn(ctx, cfg)
+	if s.cfg.RecordWitness {
+		if pd, ok := ctx.ExtraInterface.(*pending_state.PendingStateWrapper); ok {
+			s.witness.recordAccesses(pd.GetCtx())
+		}
+	}
+	if fee != nil {
+		s.txFees[txHash] = fee
+		// the receipt of the txn is only emitted once it is executed.
+		if tracer != nil {
+			s.recordTxTrace(ctx, tracer, err)
+		}
+	}
+	return err
+}
+
+// applyTxn executes the txn of ctx on its pending state with the block configs of cfg,
+// it returns the fee paid by the txn once its gas is refunded.
+func (s *Solidity) applyTxn(ctx *context.WriteContext, cfg *GethConfig) (fee *TxFee, err error) {
 	txReq := new(TxRequest)
-	coinbase := common.BytesToAddress(s.cfg.Coinbase.Bytes())
+	coinbase := common.BytesToAddress(cfg.Coinbase.Bytes())
 
 	_ = ctx.BindJson(txReq)
 
 	pd := ctx.ExtraInterface.(*pending_state.PendingStateWrapper)
 
-	cfg := s.cfg
 	vmenv := copyEvmFromRequest(cfg, txReq)
+	vmenv.StateDB = pd
 
 	if cfg.EVMConfig.Tracer != nil && cfg.EVMConfig.Tracer.OnTxStart != nil {
 		cfg.EVMConfig.Tracer.OnTxStart(vmenv.GetVMContext(), types.NewTx(&types.LegacyTx{To: txReq.Address, Data: txReq.Input, Value: txReq.Value, Gas: txReq.GasLimit}), txReq.Origin)
 	}
 
-	err = s.preCheck(txReq, pd)
+	txHash := common.Hash(ctx.GetTxnHash())
+	gasPrice, tip, err := effectiveGasPrice(txReq, cfg.BaseFee)
 	if err != nil {
-		pd.SetNonce(txReq.Origin, pd.GetNonce(txReq.Origin)+1)
 		ctx.ExtraInterface = pd
-		return err
+		return nil, err
 	}
+	vmenv.GasPrice = gasPrice
 
-	pd.SetTxContext(common.Hash(ctx.GetTxnHash()), ctx.TxnIndex)
-	vmenv.StateDB = pd
+	err = s.preCheck(cfg, txReq, pd, gasPrice)
+	if err != nil {
+		ctx.ExtraInterface = pd
+		return nil, err
+	}
+
+	pd.SetTxContext(txHash, ctx.TxnIndex)
 
 	vmenv.Context.BlockNumber = big.NewInt(int64(ctx.Block.Height))
 
@@ -320,13 +429,15 @@ func (s *Solidity) ExecuteTxn(ctx *context.WriteContext) (err error) {
 		gasUsed, err = s.executeContractCall(ctx, txReq, pd, txReq.Origin, coinbase, vmenv, sender, rules)
 	}
 
+	var remainGas uint64
 	if !rules.IsLondon {
 		// Before EIP-3529: refunds were capped to gasUsed / 2
-		s.refundGas(vmenv.StateDB, txReq, gasUsed, params.RefundQuotient)
+		remainGas = s.refundGas(vmenv.StateDB, txReq, gasPrice, gasUsed, params.RefundQuotient)
 	} else {
 		// After EIP-3529: refunds are capped to gasUsed / 5
-		s.refundGas(vmenv.StateDB, txReq, gasUsed, params.RefundQuotientEIP3529)
+		remainGas = s.refundGas(vmenv.StateDB, txReq, gasPrice, gasUsed, params.RefundQuotientEIP3529)
 	}
+	fee = newTxFee(txHash, txReq.GasLimit, remainGas, gasPrice, tip, cfg.BaseFee)
 
 	ctx.ExtraInterface = pd
 
@@ -418,8 +529,22 @@ func (s *Solidity) Commit(block *yu_types.Block) {
 	}()
 
 	// reward coinbase
-	s.ethState.AddBalance(s.cfg.Coinbase, uint256.NewInt(s.coinbaseReward.Load()), tracing.BalanceIncreaseRewardTransactionFee)
-	s.coinbaseReward.Store(0)
+	fees := newBlockFees(block, s.cfg.Coinbase, s.cfg.BaseFee, s.txFees)
+	s.ethState.AddBalance(s.cfg.Coinbase, fees.CoinbaseReward, tracing.BalanceIncreaseRewardTransactionFee)
+	s.txFees = make(map[common.Hash]*TxFee)
+	if err := WriteBlockFees(s.ethState.ethDB, fees); err != nil {
+		logrus.Errorf("Solidity failed to write the fees of Block(%d), error: %v", block.Height, err)
+	}
+	if s.cfg.RecordTraces {
+		if err := WriteBlockTraces(s.ethState.ethDB, block, s.txTraces); err != nil {
+			logrus.Errorf("Solidity failed to write the traces of Block(%d), error: %v", block.Height, err)
+		}
+	}
+	s.txTraces = make(map[common.Hash]json.RawMessage)
+	if s.cfg.RecordWitness {
+		s.writeWitness(block)
+	}
+	s.witness = newWitnessRecorder()
 
 	blockNumber := uint64(block.Height)
 	stateRoot, err := s.ethState.Commit(blockNumber)
@@ -428,64 +553,50 @@ func (s *Solidity) Commit(block *yu_types.Block) {
 		return
 	}
 	block.StateRoot = yu_common.Hash(stateRoot)
+	s.resetPackNonces()
 	// s.gasPool.SetGas(0)
 }
 
-func (s *Solidity) buyGas(state vm.StateDB, req *TxRequest) error {
-	gasFee := new(big.Int).Mul(req.GasPrice, new(big.Int).SetUint64(req.GasLimit))
+// buyGas charges the txn the gas limit at its effective gas price.
+func (s *Solidity) buyGas(state vm.StateDB, req *TxRequest, gasPrice *big.Int) error {
+	gasFee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(req.GasLimit))
 	gasFeeU256, _ := uint256.FromBig(gasFee)
 	if state.GetBalance(req.Origin).Cmp(gasFeeU256) < 0 {
 		return core.ErrInsufficientFunds
 	}
 	state.SubBalance(req.Origin, gasFeeU256, tracing.BalanceDecreaseGasBuy)
-	s.coinbaseReward.Add(gasFee.Uint64())
 	// return s.gasPool.SubGas(req.GasLimit)
 	return nil
 }
 
-func (s *Solidity) refundGas(state vm.StateDB, req *TxRequest, gasUsed uint64, refundQuotient uint64) {
+// refundGas returns the remaining gas and the refund to the sender, it returns the amount of gas returned.
+func (s *Solidity) refundGas(state vm.StateDB, req *TxRequest, gasPrice *big.Int, gasUsed uint64, refundQuotient uint64) uint64 {
 	refund := gasUsed / refundQuotient
 	if refund > state.GetRefund() {
 		refund = state.GetRefund()
 	}
 	remainGas := req.GasLimit - gasUsed + refund
-	refundFee := new(big.Int).Mul(req.GasPrice, new(big.Int).SetUint64(remainGas))
+	refundFee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(remainGas))
 	refundFeeU256, _ := uint256.FromBig(refundFee)
 	state.AddBalance(req.Origin, refundFeeU256, tracing.BalanceIncreaseGasReturn)
 	// s.gasPool.AddGas(remainGas)
+	return remainGas
 }
 
-func (s *Solidity) preCheck(req *TxRequest, stateDB vm.StateDB) error {
-	//// Make sure this transaction's nonce is correct.
-	//stNonce := stateDB.GetNonce(tx.Origin)
-	//fmt.Printf("From(%s) stateDB.Nonce = %d, request.Nonce = %d \n", tx.Origin.Hex(), stNonce, tx.Nonce)
-	//if msgNonce := tx.Nonce; stNonce < msgNonce {
-	//	return fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooHigh,
-	//		tx.Origin.Hex(), msgNonce, stNonce)
-	//} else if stNonce > msgNonce {
-	//	return fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooLow,
-	//		tx.Origin.Hex(), msgNonce, stNonce)
-	//} else if stNonce+1 < stNonce {
-	//	return fmt.Errorf("%w: address %v, nonce: %d", core.ErrNonceMax,
-	//		tx.Origin.Hex(), stNonce)
-	//}
-	//
-	//// Make sure the sender is an EOA
-	//codeHash := stateDB.GetCodeHash(tx.Origin)
-	//if codeHash != (common.Hash{}) && codeHash != types.EmptyCodeHash {
-	//	return fmt.Errorf("%w: address %v, codehash: %s", core.ErrSenderNoEOA,
-	//		tx.Origin.Hex(), codeHash)
-	//}
-	//
-	//return nil
-	//stNonce := stateDB.GetNonce(req.Origin)
-	//
-	//// fmt.Printf("address %s, tx.nonce: %d, state.nonce: %d \n", req.Origin.Hex(), req.Nonce, stNonce)
-	//if req.Nonce < stNonce {
-	//	return fmt.Errorf("%w: txHash: %s address %v, tx: %d state: %d", core.ErrNonceTooLow, req.Hash.String(),
-	//		req.Origin.Hex(), req.Nonce, stNonce)
-	//}
-	return s.buyGas(stateDB, req)
+func (s *Solidity) preCheck(cfg *GethConfig, req *TxRequest, stateDB vm.StateDB, gasPrice *big.Int) error {
+	if err := checkNonce(req, stateDB); err != nil {
+		return err
+	}
+	// Make sure the sender is an EOA, see EIP-3607
+	codeHash := stateDB.GetCodeHash(req.Origin)
+	if codeHash != (common.Hash{}) && codeHash != types.EmptyCodeHash {
+		return fmt.Errorf("%w: address %v, codehash: %s", core.ErrSenderNoEOA,
+			req.Origin.Hex(), codeHash)
+	}
+	if err := checkIntrinsicGas(cfg, req); err != nil {
+		return err
+	}
+	return s.buyGas(stateDB, req, gasPrice)
 }
 
 func (s *Solidity) executeContractCreation(ctx *context.WriteContext, txReq *TxRequest, stateDB *pending_state.PendingStateWrapper, origin, coinBase common.Address, vmenv *vm.EVM, sender vm.AccountRef, rules params.Rules) (uint64, error) {
@@ -556,32 +667,24 @@ func makeEvmReceipt(ctx *context.WriteContext, vmEvm *vm.EVM, code []byte, signe
 	_ = json.Unmarshal(txReq.OriginArgs, txArgs)
 	originTx := txArgs.ToTransaction(txReq.V, txReq.R, txReq.S)
 
-	stateDb := vmEvm.StateDB.(*pending_state.PendingStateWrapper).GetStateDB()
+	pd := vmEvm.StateDB.(*pending_state.PendingStateWrapper)
 	usedGas := originTx.Gas() - leftOverGas
 
 	blockNumber := big.NewInt(int64(block.Height))
 	txHash := common.Hash(signedTx.TxnHash)
-	effectiveGasPrice := big.NewInt(1000000000) // 1 GWei
+	effectiveGasPrice := new(big.Int).Set(vmEvm.GasPrice)
 
 	status := types.ReceiptStatusFailed
 	if err == nil {
 		status = types.ReceiptStatusSuccessful
 	}
-	var root []byte
-	//stateDB := vmEvm.StateDB.(*pending_state.PendingState)
-	//if vmEvm.ChainConfig().IsByzantium(blockNumber) {
-	//	stateDB.Finalise(true)
-	//} else {
-	//	root = stateDB.IntermediateRoot(vmEvm.ChainConfig().IsEIP158(blockNumber)).Bytes()
-	//}
-
-	// TODO: 1. root is nil; 2. CumulativeGasUsed not; 3. logBloom is empty
-
+	// PostState is left empty as the status replaces it since byzantium.
+	// CumulativeGasUsed, the bloom and the log indices depend on the other txns
+	// in the block, they are finalized by FinalizeReceipts after the block is executed.
 	receipt := &types.Receipt{
 		Type:              originTx.Type(),
 		Status:            status,
-		PostState:         root,
-		CumulativeGasUsed: leftOverGas,
+		CumulativeGasUsed: usedGas,
 		TxHash:            txHash,
 		ContractAddress:   address,
 		GasUsed:           usedGas,
@@ -593,8 +696,7 @@ func makeEvmReceipt(ctx *context.WriteContext, vmEvm *vm.EVM, code []byte, signe
 		receipt.BlobGasPrice = vmEvm.Context.BlobBaseFee
 	}
 
-	receipt.Logs = stateDb.GetLogs(txHash, blockNumber.Uint64(), common.Hash(block.Hash))
-	receipt.Bloom = types.CreateBloom(types.Receipts{})
+	receipt.Logs = pd.GetLogs(txHash, blockNumber.Uint64(), common.Hash(block.Hash))
 	receipt.BlockHash = common.Hash(block.Hash)
 	receipt.BlockNumber = blockNumber
 	receipt.TransactionIndex = uint(ctx.TxnIndex)
@@ -604,6 +706,7 @@ func makeEvmReceipt(ctx *context.WriteContext, vmEvm *vm.EVM, code []byte, signe
 	if receipt.Logs == nil {
 		receipt.Logs = []*types.Log{}
 	}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
 
 	for idx, txn := range block.Txns {
 		if common.Hash(txn.TxnHash) == txHash {
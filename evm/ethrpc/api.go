@@ -40,6 +40,7 @@ import (
 	"github.com/reddio-com/reddio/config"
 	"github.com/reddio-com/reddio/evm"
 	"github.com/reddio-com/reddio/metrics"
+	"github.com/reddio-com/reddio/parallel"
 )
 
 var (
@@ -308,30 +309,47 @@ func (n *proofList) Delete(key []byte) error {
 
 // GetProof returns the Merkle-proof for a given account and optionally some storage keys.
 func (s *BlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*AccountResult, error) {
+	keys, keyLengths, err := decodeStorageKeys(storageKeys)
+	if err != nil {
+		return nil, err
+	}
+	statedb, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	tr, err := trie.NewStateTrie(trie.StateTrieID(header.Root), statedb.Database().TrieDB())
+	if err != nil {
+		return nil, err
+	}
+	return proveAccount(statedb, tr, header.Root, address, keys, keyLengths)
+}
+
+// decodeStorageKeys deserializes all keys. This prevents state access on invalid input.
+func decodeStorageKeys(storageKeys []string) ([]common.Hash, []int, error) {
 	var (
-		keys         = make([]common.Hash, len(storageKeys))
-		keyLengths   = make([]int, len(storageKeys))
-		storageProof = make([]StorageResult, len(storageKeys))
+		keys       = make([]common.Hash, len(storageKeys))
+		keyLengths = make([]int, len(storageKeys))
 	)
-	// Deserialize all keys. This prevents state access on invalid input.
 	for i, hexKey := range storageKeys {
 		var err error
 		keys[i], keyLengths[i], err = decodeHash(hexKey)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	statedb, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
-	if statedb == nil || err != nil {
-		return nil, err
-	}
+	return keys, keyLengths, nil
+}
+
+// proveAccount creates the proofs of the account and of its storage keys in the state trie tr.
+func proveAccount(statedb *state.StateDB, tr state.Trie, root common.Hash, address common.Address, keys []common.Hash, keyLengths []int) (*AccountResult, error) {
 	codeHash := statedb.GetCodeHash(address)
 	storageRoot := statedb.GetStorageRoot(address)
+	storageProof := make([]StorageResult, len(keys))
 
 	if len(keys) > 0 {
 		var storageTrie state.Trie
 		if storageRoot != types.EmptyRootHash && storageRoot != (common.Hash{}) {
-			id := trie.StorageTrieID(header.Root, crypto.Keccak256Hash(address.Bytes()), storageRoot)
+			id := trie.StorageTrieID(root, crypto.Keccak256Hash(address.Bytes()), storageRoot)
 			st, err := trie.NewStateTrie(id, statedb.Database().TrieDB())
 			if err != nil {
 				return nil, err
@@ -363,10 +381,6 @@ func (s *BlockChainAPI) GetProof(ctx context.Context, address common.Address, st
 		}
 	}
 	// Create the accountProof.
-	tr, err := trie.NewStateTrie(trie.StateTrieID(header.Root), statedb.Database().TrieDB())
-	if err != nil {
-		return nil, err
-	}
 	var accountProof proofList
 	if err := tr.Prove(crypto.Keccak256(address.Bytes()), &accountProof); err != nil {
 		return nil, err
@@ -1173,20 +1187,19 @@ func (s *TransactionAPI) GetRawTransactionByBlockHashAndIndex(ctx context.Contex
 func (s *TransactionAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Uint64, error) {
 	TransactionAPICounter.WithLabelValues("GetTransactionCount").Inc()
 	// Ask transaction pool for the nonce which includes pending transactions
-	nonce := uint64(0)
 	if blockNr, ok := blockNrOrHash.Number(); ok && blockNr == rpc.PendingBlockNumber {
-		poolNonce, err := s.b.GetPoolNonce(ctx, address)
+		nonce, err := s.b.GetPoolNonce(ctx, address)
 		if err != nil {
 			return nil, err
 		}
-		nonce += poolNonce
+		return (*hexutil.Uint64)(&nonce), nil
 	}
 	// Resolve block number and use its state to ask for the nonce
 	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if state == nil || err != nil {
 		return nil, err
 	}
-	nonce += state.GetNonce(address)
+	nonce := state.GetNonce(address)
 	return (*hexutil.Uint64)(&nonce), state.Error()
 }
 
@@ -1327,6 +1340,9 @@ func marshalReceipt(receipt *types.Receipt, blockHash common.Hash, blockNumber u
 
 // sign is a helper function that signs a transaction with the private key of the given address.
 func (s *TransactionAPI) sign(addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
+	if s.b.AccountManager() == nil {
+		return nil, errors.New("no accounts are managed by this node")
+	}
 	// Look up the wallet containing the requested signer
 	account := accounts.Account{Address: addr}
 
@@ -1490,7 +1506,54 @@ func (s *TransactionAPI) PendingTransactions() ([]*RPCTransaction, error) {
 // Resend accepts an existing transaction and a new gas price and limit. It will remove
 // the given transaction from the pool and reinsert it with the new gas price and limit.
 func (s *TransactionAPI) Resend(ctx context.Context, sendArgs TransactionArgs, gasPrice *hexutil.Big, gasLimit *hexutil.Uint64) (common.Hash, error) {
-	panic("implement me")
+	TransactionAPICounter.WithLabelValues("Resend").Inc()
+	if sendArgs.Nonce == nil {
+		return common.Hash{}, errors.New("missing transaction nonce in transaction spec")
+	}
+	if err := sendArgs.setDefaults(ctx, s.b, false); err != nil {
+		return common.Hash{}, err
+	}
+	matchTx := sendArgs.ToTransaction(nil, nil, nil)
+
+	// Before replacing the old transaction, ensure the _new_ transaction fee is reasonable.
+	var price = matchTx.GasPrice()
+	if gasPrice != nil {
+		price = gasPrice.ToInt()
+	}
+	var gas = matchTx.Gas()
+	if gasLimit != nil {
+		gas = uint64(*gasLimit)
+	}
+	if err := checkTxFee(price, gas, s.b.RPCTxFeeCap()); err != nil {
+		return common.Hash{}, err
+	}
+	// Iterate the pending list for replacement, the replaced txn is evicted by SendTx.
+	pending, err := s.b.GetPoolTransactions()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for _, p := range pending {
+		wantSigHash := s.signer.Hash(matchTx)
+		pFrom, err := types.Sender(s.signer, p)
+		if err == nil && pFrom == sendArgs.from() && s.signer.Hash(p) == wantSigHash {
+			// Match. Re-sign and send the transaction.
+			if gasPrice != nil && (*big.Int)(gasPrice).Sign() != 0 {
+				sendArgs.GasPrice = gasPrice
+			}
+			if gasLimit != nil && *gasLimit != 0 {
+				sendArgs.Gas = gasLimit
+			}
+			signedTx, err := s.sign(sendArgs.from(), sendArgs.ToTransaction(nil, nil, nil))
+			if err != nil {
+				return common.Hash{}, err
+			}
+			if err = s.b.SendTx(ctx, signedTx); err != nil {
+				return common.Hash{}, err
+			}
+			return signedTx.Hash(), nil
+		}
+	}
+	return common.Hash{}, fmt.Errorf("transaction %#x not found", matchTx.Hash())
 }
 
 // DebugAPI is the collection of Ethereum APIs exposed over the debugging
@@ -1637,6 +1700,227 @@ func (api *DebugAPI) SetHead(number hexutil.Uint64) {
 	api.b.SetHead(uint64(number))
 }
 
+// ParallelConflicts returns the addresses and storage slots which caused the
+// most conflicts in the parallel executor over the recent blocks.
+func (api *DebugAPI) ParallelConflicts(count *int) *parallel.ConflictHeatmapResult {
+	n := 0
+	if count != nil {
+		n = *count
+	}
+	return parallel.GetConflictHeatmap().Top(n)
+}
+
+// DroppedReplaced is the reason of the txns evicted from the txpool by a replacement.
+const DroppedReplaced = "replaced"
+
+// DroppedTxEvent is posted when a txn is evicted from the txpool, e.g. replaced by a txn
+// with the same sender and nonce and a higher fee.
+type DroppedTxEvent struct {
+	Tx          *types.Transaction
+	Reason      string
+	Replacement common.Hash
+}
+
+// TxPoolAPI offers and API for the transaction pool. It only operates on data that is non-confidential.
+type TxPoolAPI struct {
+	b Backend
+}
+
+// NewTxPoolAPI creates a new tx pool service that gives information about the transaction pool.
+func NewTxPoolAPI(b Backend) *TxPoolAPI {
+	return &TxPoolAPI{b}
+}
+
+// Content returns the transactions contained within the transaction pool.
+func (s *TxPoolAPI) Content() map[string]map[string]map[string]*RPCTransaction {
+	content := map[string]map[string]map[string]*RPCTransaction{
+		"pending": make(map[string]map[string]*RPCTransaction),
+		"queued":  make(map[string]map[string]*RPCTransaction),
+	}
+	pending, queue := s.b.TxPoolContent()
+	curHeader := s.b.CurrentHeader()
+	// Flatten the pending transactions
+	for account, txs := range pending {
+		dump := make(map[string]*RPCTransaction)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx, curHeader, s.b.ChainConfig())
+		}
+		content["pending"][account.Hex()] = dump
+	}
+	// Flatten the queued transactions
+	for account, txs := range queue {
+		dump := make(map[string]*RPCTransaction)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx, curHeader, s.b.ChainConfig())
+		}
+		content["queued"][account.Hex()] = dump
+	}
+	return content
+}
+
+// ContentFrom returns the transactions contained within the transaction pool.
+func (s *TxPoolAPI) ContentFrom(addr common.Address) map[string]map[string]*RPCTransaction {
+	content := make(map[string]map[string]*RPCTransaction, 2)
+	pending, queue := s.b.TxPoolContentFrom(addr)
+	curHeader := s.b.CurrentHeader()
+
+	// Build the pending transactions
+	dump := make(map[string]*RPCTransaction, len(pending))
+	for _, tx := range pending {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx, curHeader, s.b.ChainConfig())
+	}
+	content["pending"] = dump
+
+	// Build the queued transactions
+	dump = make(map[string]*RPCTransaction, len(queue))
+	for _, tx := range queue {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx, curHeader, s.b.ChainConfig())
+	}
+	content["queued"] = dump
+
+	return content
+}
+
+// Status returns the number of pending and queued transaction in the pool.
+func (s *TxPoolAPI) Status() map[string]hexutil.Uint {
+	pending, queue := s.b.Stats()
+	return map[string]hexutil.Uint{
+		"pending": hexutil.Uint(pending),
+		"queued":  hexutil.Uint(queue),
+	}
+}
+
+// Inspect retrieves the content of the transaction pool and flattens it into an
+// easily inspectable list.
+func (s *TxPoolAPI) Inspect() map[string]map[string]map[string]string {
+	content := map[string]map[string]map[string]string{
+		"pending": make(map[string]map[string]string),
+		"queued":  make(map[string]map[string]string),
+	}
+	pending, queue := s.b.TxPoolContent()
+
+	// Define a formatter to flatten a transaction into a string
+	var format = func(tx *types.Transaction) string {
+		if to := tx.To(); to != nil {
+			return fmt.Sprintf("%s: %v wei + %v gas × %v wei", tx.To().Hex(), tx.Value(), tx.Gas(), tx.GasPrice())
+		}
+		return fmt.Sprintf("contract creation: %v wei + %v gas × %v wei", tx.Value(), tx.Gas(), tx.GasPrice())
+	}
+	// Flatten the pending transactions
+	for account, txs := range pending {
+		dump := make(map[string]string)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
+		}
+		content["pending"][account.Hex()] = dump
+	}
+	// Flatten the queued transactions
+	for account, txs := range queue {
+		dump := make(map[string]string)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
+		}
+		content["queued"][account.Hex()] = dump
+	}
+	return content
+}
+
+// DroppedTransactions creates a subscription that is triggered each time a txn is evicted
+// from the txpool, with the reason and the hash of its replacement if it was replaced.
+func (s *TxPoolAPI) DroppedTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	go func() {
+		droppedCh := make(chan DroppedTxEvent, txChanSize)
+		sub := s.b.SubscribeDroppedTxsEvent(droppedCh)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-droppedCh:
+				notifier.Notify(rpcSub.ID, map[string]interface{}{
+					"hash":        ev.Tx.Hash(),
+					"reason":      ev.Reason,
+					"replacement": ev.Replacement,
+				})
+			case <-rpcSub.Err():
+				return
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// ReddioAPI offers the reddio specific RPC methods.
+type ReddioAPI struct {
+	b Backend
+}
+
+// NewReddioAPI creates a new instance of ReddioAPI.
+func NewReddioAPI(b Backend) *ReddioAPI {
+	return &ReddioAPI{b: b}
+}
+
+// BlockFees returns the fee ledger of the given block: the net fee paid by each txn,
+// the burnt base fee and the reward paid to the coinbase.
+func (api *ReddioAPI) BlockFees(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*evm.BlockFees, error) {
+	header, _, err := api.b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	return evm.ReadBlockFees(api.b.ChainDb(), header.Number.Uint64())
+}
+
+// maxMultiProofAccounts is the max number of accounts proved by a single reddio_getMultiProof call.
+const maxMultiProofAccounts = 1024
+
+// ProofRequest is an account and the storage keys to be proved by reddio_getMultiProof.
+type ProofRequest struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []string       `json:"storageKeys"`
+}
+
+// GetMultiProof returns the Merkle-proofs of the accounts and their storage keys at the
+// given block, they are all proved against the same state root. The states of all the
+// blocks are kept, see EthState.Commit.
+func (api *ReddioAPI) GetMultiProof(ctx context.Context, requests []ProofRequest, blockNrOrHash rpc.BlockNumberOrHash) ([]*AccountResult, error) {
+	if len(requests) > maxMultiProofAccounts {
+		return nil, fmt.Errorf("too many accounts, want at most %d", maxMultiProofAccounts)
+	}
+	keys := make([][]common.Hash, len(requests))
+	keyLengths := make([][]int, len(requests))
+	for i, req := range requests {
+		var err error
+		if keys[i], keyLengths[i], err = decodeStorageKeys(req.StorageKeys); err != nil {
+			return nil, err
+		}
+	}
+	statedb, header, err := api.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	tr, err := trie.NewStateTrie(trie.StateTrieID(header.Root), statedb.Database().TrieDB())
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*AccountResult, len(requests))
+	for i, req := range requests {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if results[i], err = proveAccount(statedb, tr, header.Root, req.Address, keys[i], keyLengths[i]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
 // NetAPI offers network related RPC methods
 type NetAPI struct {
 	net            *p2p.Server
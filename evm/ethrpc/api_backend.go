@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"sort"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -30,6 +31,7 @@ import (
 	"github.com/yu-org/yu/core/protocol"
 	yutypes "github.com/yu-org/yu/core/types"
 
+	"github.com/reddio-com/reddio/config"
 	"github.com/reddio-com/reddio/evm"
 )
 
@@ -38,6 +40,16 @@ type EthAPIBackend struct {
 	ethChainCfg         *params.ChainConfig
 	chain               *kernel.Kernel
 	gasPriceCache       *EthGasPrice
+	sync                *syncTracker
+	pendingCache        pendingCache
+	cfg                 *evm.GethConfig
+	bloomRequests       chan chan *bloombits.Retrieval
+
+	chainFeed     event.Feed
+	chainHeadFeed event.Feed
+	logsFeed      event.Feed
+	txsFeed       event.Feed
+	droppedFeed   event.Feed
 }
 
 const (
@@ -46,15 +58,22 @@ const (
 )
 
 func (e *EthAPIBackend) SyncProgress() ethereum.SyncProgress {
-	// TODO implement me
-	panic("implement me")
+	start := time.Now()
+	defer func() {
+		EthApiBackendDuration.WithLabelValues("syncProgress").Observe(float64(time.Since(start).Microseconds()))
+	}()
+	EthApiBackendCounter.WithLabelValues("syncProgress").Inc()
+	starting, current, highest, err := e.sync.progress()
+	if err != nil {
+		logrus.Error("EthAPIBackend.SyncProgress() failed: ", err)
+	}
+	return ethereum.SyncProgress{
+		StartingBlock: starting,
+		CurrentBlock:  current,
+		HighestBlock:  highest,
+	}
 }
 
-//func (e *EthAPIBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
-//	//TODO implement me
-//	panic("implement me")
-//}
-
 // BlobBaseFee Move to ethrpc/gasprice.go
 // func (e *EthAPIBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, []*big.Int, []float64, error) {}
 func (e *EthAPIBackend) BlobBaseFee(ctx context.Context) *big.Int {
@@ -70,6 +89,14 @@ func (e *EthAPIBackend) RPCGasCap() uint64 {
 	return 50000000
 }
 
+func (e *EthAPIBackend) RPCLogsMaxBlockRange() uint64 {
+	return e.cfg.LogsMaxBlockRange
+}
+
+func (e *EthAPIBackend) RPCLogsMaxResults() int {
+	return e.cfg.LogsMaxResults
+}
+
 func (e *EthAPIBackend) RPCEVMTimeout() time.Duration {
 	return 5 * time.Second
 }
@@ -99,8 +126,11 @@ func (e *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	)
 	switch number {
 	case rpc.PendingBlockNumber:
-		// FIXME
-		yuBlock, err = e.chain.Chain.GetEndCompactBlock()
+		p, err := e.pending()
+		if err != nil {
+			return nil, nil, err
+		}
+		return p.block.Header(), p.yuBlock.Header, nil
 	case rpc.LatestBlockNumber, rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
 		yuBlock, err = e.chain.Chain.LastFinalizedCompact()
 	default:
@@ -110,7 +140,7 @@ func (e *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if yuBlock == nil {
 		return nil, nil, err
 	}
-	return yuHeader2EthHeader(yuBlock.Header), yuBlock.Header, err
+	return e.yuHeader2EthHeader(yuBlock.Header), yuBlock.Header, err
 }
 
 func (e *EthAPIBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, *yutypes.Header, error) {
@@ -125,7 +155,7 @@ func (e *EthAPIBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*ty
 		return nil, nil, err
 	}
 
-	return yuHeader2EthHeader(yuBlock.Header), yuBlock.Header, err
+	return e.yuHeader2EthHeader(yuBlock.Header), yuBlock.Header, err
 }
 
 func (e *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, *yutypes.Header, error) {
@@ -157,7 +187,7 @@ func (e *EthAPIBackend) CurrentHeader() *types.Header {
 		return nil
 	}
 
-	return yuHeader2EthHeader(yuBlock.Header)
+	return e.yuHeader2EthHeader(yuBlock.Header)
 }
 
 func (e *EthAPIBackend) CurrentBlock() *types.Header {
@@ -172,7 +202,7 @@ func (e *EthAPIBackend) CurrentBlock() *types.Header {
 		return nil
 	}
 
-	return yuHeader2EthHeader(yuBlock.Header)
+	return e.yuHeader2EthHeader(yuBlock.Header)
 }
 
 func (e *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, *yutypes.Block, error) {
@@ -185,10 +215,15 @@ func (e *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 		yuBlock *yutypes.Block
 		err     error
 	)
+	if number == rpc.PendingBlockNumber {
+		p, err := e.pending()
+		if err != nil {
+			return nil, nil, err
+		}
+		return p.block, p.yuBlock, nil
+	}
 	for attempt := 1; attempt <= MaxRetries; attempt++ {
 		switch number {
-		case rpc.PendingBlockNumber:
-			yuBlock, err = e.chain.Chain.GetEndBlock()
 		case rpc.LatestBlockNumber:
 			yuBlock, err = e.chain.Chain.GetEndBlock()
 		case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
@@ -258,6 +293,13 @@ func (e *EthAPIBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.B
 		EthApiBackendDuration.WithLabelValues("stateAndHeaderByNumber").Observe(float64(time.Since(start).Microseconds()))
 	}()
 	EthApiBackendCounter.WithLabelValues("stateAndHeaderByNumber").Inc()
+	if number == rpc.PendingBlockNumber {
+		block, _, statedb := e.Pending()
+		if block == nil {
+			return nil, nil, errors.New("pending block not available")
+		}
+		return statedb, block.Header(), nil
+	}
 	header, _, err := e.HeaderByNumber(ctx, number)
 	if err != nil {
 		return nil, nil, err
@@ -294,7 +336,7 @@ func (e *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 		if err != nil {
 			return nil, nil, err
 		}
-		return stateDB, yuHeader2EthHeader(yuBlock.Header), nil
+		return stateDB, e.yuHeader2EthHeader(yuBlock.Header), nil
 	}
 	return nil, nil, errors.New("invalid arguments; neither block nor hash specified")
 }
@@ -312,9 +354,19 @@ func (e *EthAPIBackend) AccountManager() *accounts.Manager {
 	return nil
 }
 
+// Pending returns the pending block, its receipts and a copy of its state.
 func (e *EthAPIBackend) Pending() (*types.Block, types.Receipts, *state.StateDB) {
-	// TODO implement me
-	panic("implement me")
+	start := time.Now()
+	defer func() {
+		EthApiBackendDuration.WithLabelValues("pending").Observe(float64(time.Since(start).Microseconds()))
+	}()
+	EthApiBackendCounter.WithLabelValues("pending").Inc()
+	p, err := e.pending()
+	if err != nil {
+		logrus.Error("EthAPIBackend.Pending() failed: ", err)
+		return nil, nil, nil
+	}
+	return p.block, p.receipts, p.state
 }
 
 // Eth has changed to POS, Td(total difficulty) is for POW
@@ -341,19 +393,22 @@ func (e *EthAPIBackend) GetEVM(ctx context.Context, msg *core.Message, state *st
 	return vm.NewEVM(context, txContext, state, e.ChainConfig(), *vmConfig)
 }
 
+func (e *EthAPIBackend) NewTraceEnv(block *yutypes.Block) (*evm.TraceEnv, error) {
+	solidity := e.chain.GetTripodInstance(SolidityTripod).(*evm.Solidity)
+	return solidity.NewTraceEnv(block)
+}
+
 func (e *EthAPIBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
-	// TODO implement me
-	panic("implement me")
+	return e.chainFeed.Subscribe(ch)
 }
 
 func (e *EthAPIBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
-	// TODO implement me
-	panic("implement me")
+	return e.chainHeadFeed.Subscribe(ch)
 }
 
+// SubscribeChainSideEvent never fires, the blocks are final once they are appended to the chain.
 func (e *EthAPIBackend) SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription {
-	// TODO implement me
-	panic("implement me")
+	return noopSubscription()
 }
 
 func (e *EthAPIBackend) Call(ctx context.Context, args TransactionArgs, blockNrOrHash *rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) (hexutil.Bytes, error) {
@@ -467,14 +522,45 @@ func (e *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 			Params:     string(byt),
 		},
 	}
-	return e.chain.HandleTxn(signedWrCall)
+	if config.GetGlobalConfig().PredictAccessList && len(signedTx.AccessList()) == 0 {
+		e.predictAccessList(ctx, signedTx, sender)
+	}
+	// a txn of the txpool with the same sender and nonce is replaced by evm.TxPool.
+	if err = e.chain.HandleTxn(signedWrCall); err != nil {
+		return err
+	}
+	// the txns added into evm.TxPool are posted by txPoolEventLoop.
+	if _, ok := e.chain.Pool.(*evm.TxPool); !ok {
+		e.txsFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{signedTx}})
+	}
+	return nil
+}
+
+// predictAccessList dry-runs the txn on the latest state and caches the accounts
+// and slots it touches, so that the parallel executor can schedule it.
+func (e *EthAPIBackend) predictAccessList(ctx context.Context, signedTx *types.Transaction, sender common.Address) {
+	args := NewTxArgsFromTx(signedTx)
+	args.From = &sender
+	if args.MaxFeePerGas != nil {
+		args.GasPrice = nil
+	}
+	acl, _, _, err := AccessList(ctx, e, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), *args)
+	if err != nil {
+		logrus.Debugf("[SendTx] Failed to predict access list, txHash(%s), error: %v", signedTx.Hash().Hex(), err)
+		return
+	}
+	evm.SetPredictedAccessList(signedTx.Hash(), acl)
 }
 
 func YuTxn2EthTxn(yuSignedTxn *yutypes.SignedTxn) (*types.Transaction, error) {
 	// Un-serialize wrCall.params to retrieve data:
-	wrCallParams := yuSignedTxn.Raw.WrCall.Params
+	return txRequest2EthTxn([]byte(yuSignedTxn.Raw.WrCall.Params))
+}
+
+// txRequest2EthTxn rebuilds the signed eth txn from the json encoded TxRequest.
+func txRequest2EthTxn(params []byte) (*types.Transaction, error) {
 	txReq := &evm.TxRequest{}
-	err := json.Unmarshal([]byte(wrCallParams), txReq)
+	err := json.Unmarshal(params, txReq)
 	if err != nil {
 		return nil, err
 	}
@@ -667,42 +753,118 @@ func (e *EthAPIBackend) GetPoolNonce(ctx context.Context, addr common.Address) (
 		EthApiBackendDuration.WithLabelValues("getPoolNonce").Observe(float64(time.Since(start).Microseconds()))
 	}()
 	EthApiBackendCounter.WithLabelValues("getPoolNonce").Inc()
-	// Loop through all transactions to find matching Account Address, and return it's nonce (if have)
-	allEthTxns, _ := e.GetPoolTransactions()
-
-	head := e.CurrentBlock()
-	signer := types.MakeSigner(e.ChainConfig(), head.Number, head.Time)
-
-	nonce := uint64(0)
-	for _, ethTxn := range allEthTxns {
-		sender, _ := types.Sender(signer, ethTxn)
-		if sender == addr {
-			nonce++
-			// return ethTxn.Nonce(), nil
-		}
+	statedb, _, err := e.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return 0, err
+	}
+	nonce := statedb.GetNonce(addr)
+	// The txns of the txpool whose nonces follow the nonce of the latest state are counted.
+	if pool, ok := e.chain.Pool.(*evm.TxPool); ok {
+		return pool.PoolNonce(addr, nonce), nil
 	}
-
 	return nonce, nil
 }
 
 func (e *EthAPIBackend) Stats() (pending int, queued int) {
-	// TODO implement me
-	panic("implement me")
+	start := time.Now()
+	defer func() {
+		EthApiBackendDuration.WithLabelValues("stats").Observe(float64(time.Since(start).Microseconds()))
+	}()
+	EthApiBackendCounter.WithLabelValues("stats").Inc()
+	pendingTxs, queuedTxs := e.poolContent(nil)
+	for _, txs := range pendingTxs {
+		pending += len(txs)
+	}
+	for _, txs := range queuedTxs {
+		queued += len(txs)
+	}
+	return pending, queued
 }
 
 func (e *EthAPIBackend) TxPoolContent() (map[common.Address][]*types.Transaction, map[common.Address][]*types.Transaction) {
-	// TODO implement me
-	panic("implement me")
+	start := time.Now()
+	defer func() {
+		EthApiBackendDuration.WithLabelValues("txPoolContent").Observe(float64(time.Since(start).Microseconds()))
+	}()
+	EthApiBackendCounter.WithLabelValues("txPoolContent").Inc()
+	return e.poolContent(nil)
 }
 
 func (e *EthAPIBackend) TxPoolContentFrom(addr common.Address) ([]*types.Transaction, []*types.Transaction) {
-	// TODO implement me
-	panic("implement me")
+	start := time.Now()
+	defer func() {
+		EthApiBackendDuration.WithLabelValues("txPoolContentFrom").Observe(float64(time.Since(start).Microseconds()))
+	}()
+	EthApiBackendCounter.WithLabelValues("txPoolContentFrom").Inc()
+	pending, queued := e.poolContent(&addr)
+	return pending[addr], queued[addr]
+}
+
+// poolContent groups the txns of the txpool by sender, sorted by nonce, only the txns of addr
+// if it is not nil. The txns following the nonce of their sender in the latest state are pending,
+// the ones behind a nonce gap are queued until the gap is filled, the same way as the txns are
+// packed by evm.Solidity.PackFilter. The txns whose nonce is too low are pending, they are packed
+// and rejected in execution.
+func (e *EthAPIBackend) poolContent(addr *common.Address) (map[common.Address][]*types.Transaction, map[common.Address][]*types.Transaction) {
+	txs, err := e.GetPoolTransactions()
+	if err != nil {
+		logrus.Errorf("[TxPool] Failed to get the txns of the txpool: %v", err)
+		return make(map[common.Address][]*types.Transaction), make(map[common.Address][]*types.Transaction)
+	}
+	head := e.CurrentBlock()
+	return groupPoolTxns(txs, types.MakeSigner(e.ChainConfig(), head.Number, head.Time), addr, func() (*state.StateDB, error) {
+		statedb, _, err := e.StateAndHeaderByNumber(context.Background(), rpc.LatestBlockNumber)
+		return statedb, err
+	})
+}
+
+// groupPoolTxns groups the txns by sender into the pending and the queued ones, see poolContent.
+// The latest state is only opened if there are txns to group.
+func groupPoolTxns(txs types.Transactions, signer types.Signer, addr *common.Address, latest func() (*state.StateDB, error)) (map[common.Address][]*types.Transaction, map[common.Address][]*types.Transaction) {
+	pending := make(map[common.Address][]*types.Transaction)
+	queued := make(map[common.Address][]*types.Transaction)
+	senders := make(map[common.Address][]*types.Transaction)
+	for _, tx := range txs {
+		sender, err := types.Sender(signer, tx)
+		if err != nil || (addr != nil && sender != *addr) {
+			continue
+		}
+		senders[sender] = append(senders[sender], tx)
+	}
+	if len(senders) == 0 {
+		return pending, queued
+	}
+
+	statedb, err := latest()
+	if err != nil {
+		logrus.Errorf("[TxPool] Failed to open the latest state: %v", err)
+		return pending, queued
+	}
+	for sender, txs := range senders {
+		sort.SliceStable(txs, func(i, j int) bool {
+			return txs[i].Nonce() < txs[j].Nonce()
+		})
+		next := statedb.GetNonce(sender)
+		for i, tx := range txs {
+			if tx.Nonce() > next {
+				queued[sender] = txs[i:]
+				break
+			}
+			if tx.Nonce() == next {
+				next++
+			}
+			pending[sender] = append(pending[sender], tx)
+		}
+	}
+	return pending, queued
 }
 
 func (e *EthAPIBackend) SubscribeNewTxsEvent(events chan<- core.NewTxsEvent) event.Subscription {
-	// TODO implement me
-	panic("implement me")
+	return e.txsFeed.Subscribe(events)
+}
+
+func (e *EthAPIBackend) SubscribeDroppedTxsEvent(events chan<- DroppedTxEvent) event.Subscription {
+	return e.droppedFeed.Subscribe(events)
 }
 
 func (e *EthAPIBackend) ChainConfig() *params.ChainConfig {
@@ -744,27 +906,30 @@ func (e *EthAPIBackend) GetLogs(ctx context.Context, blockHash common.Hash, numb
 	return result, nil
 }
 
+// SubscribeRemovedLogsEvent never fires, the blocks are final once they are appended to the chain.
 func (e *EthAPIBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
-	// TODO implement me
-	panic("implement me")
+	return noopSubscription()
 }
 
 func (e *EthAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
-	// TODO implement me
-	panic("implement me")
+	return e.logsFeed.Subscribe(ch)
 }
 
 func (e *EthAPIBackend) BloomStatus() (uint64, uint64) {
-	// TODO implement me
-	panic("implement me")
+	return evm.BloomSectionSize, evm.ReadBloomSections(e.ChainDb())
 }
 
 func (e *EthAPIBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
-	// TODO implement me
-	panic("implement me")
+	for i := 0; i < bloomFilterThreads; i++ {
+		go session.Multiplex(bloomRetrievalBatch, bloomRetrievalWait, e.bloomRequests)
+	}
 }
 
-func yuHeader2EthHeader(yuHeader *yutypes.Header) *types.Header {
+func (e *EthAPIBackend) yuHeader2EthHeader(yuHeader *yutypes.Header) *types.Header {
+	baseFee, err := evm.ExecutedBaseFee(yuHeader)
+	if err != nil {
+		logrus.Errorf("yuHeader2EthHeader: %v", err)
+	}
 	return &types.Header{
 		ParentHash:  common.Hash(yuHeader.PrevHash),
 		Coinbase:    common.Address{}, // FIXME
@@ -778,12 +943,13 @@ func yuHeader2EthHeader(yuHeader *yutypes.Header) *types.Header {
 		Time:        yuHeader.Timestamp,
 		Extra:       yuHeader.Extra,
 		Nonce:       types.BlockNonce{},
-		BaseFee:     big.NewInt(params.InitialBaseFee),
+		BaseFee:     baseFee,
+		Bloom:       evm.ReadBlockBloom(e.ChainDb(), uint64(yuHeader.Height)),
 	}
 }
 
 func (e *EthAPIBackend) compactBlock2EthBlock(yuBlock *yutypes.Block) (*types.Block, error) {
-	header := yuHeader2EthHeader(yuBlock.Header)
+	header := e.yuHeader2EthHeader(yuBlock.Header)
 
 	// Generate transactions and receipts
 	var ethTxs []*types.Transaction
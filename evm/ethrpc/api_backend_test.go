@@ -0,0 +1,88 @@
+package ethrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func txnNonces(txs []*types.Transaction) []uint64 {
+	nonces := make([]uint64, 0, len(txs))
+	for _, tx := range txs {
+		nonces = append(nonces, tx.Nonce())
+	}
+	return nonces
+}
+
+func checkNonces(t *testing.T, name string, txs []*types.Transaction, expected ...uint64) {
+	nonces := txnNonces(txs)
+	if len(nonces) != len(expected) {
+		t.Fatalf("Expected %s nonces %v, but got %v", name, expected, nonces)
+	}
+	for i := range expected {
+		if nonces[i] != expected[i] {
+			t.Fatalf("Expected %s nonces %v, but got %v", name, expected, nonces)
+		}
+	}
+}
+
+func TestGroupPoolTxns(t *testing.T) {
+	aliceKey, _ := crypto.GenerateKey()
+	bobKey, _ := crypto.GenerateKey()
+	alice := crypto.PubkeyToAddress(aliceKey.PublicKey)
+	bob := crypto.PubkeyToAddress(bobKey.PublicKey)
+	sdb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	sdb.SetNonce(alice, 2)
+	latest := func() (*state.StateDB, error) {
+		return sdb, nil
+	}
+
+	txs := types.Transactions{
+		newTestEthTxn(t, aliceKey, 5, params.GWei),
+		newTestEthTxn(t, aliceKey, 3, params.GWei),
+		// the nonce too low is pending, it is packed and rejected in execution.
+		newTestEthTxn(t, aliceKey, 1, params.GWei),
+		newTestEthTxn(t, aliceKey, 2, params.GWei),
+		// the nonce 4 of alice is missing.
+		newTestEthTxn(t, aliceKey, 6, params.GWei),
+		newTestEthTxn(t, bobKey, 1, params.GWei),
+	}
+	signer := types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID)
+	pending, queued := groupPoolTxns(txs, signer, nil, latest)
+	checkNonces(t, "pending alice", pending[alice], 1, 2, 3)
+	checkNonces(t, "queued alice", queued[alice], 5, 6)
+	// bob has no txn of its nonce 0.
+	checkNonces(t, "pending bob", pending[bob])
+	checkNonces(t, "queued bob", queued[bob], 1)
+	if len(pending) != 1 || len(queued) != 2 {
+		t.Fatalf("Expected the pending txns of alice and the queued ones of both, but got %v, %v", pending, queued)
+	}
+
+	// only the txns of addr are grouped.
+	pending, queued = groupPoolTxns(txs, signer, &bob, latest)
+	if len(pending) != 0 || len(queued) != 1 {
+		t.Fatalf("Expected the queued txns of bob, but got %v, %v", pending, queued)
+	}
+	checkNonces(t, "queued bob", queued[bob], 1)
+
+	// the latest state is not opened without txns.
+	pending, queued = groupPoolTxns(txs, signer, &common.Address{0x01}, func() (*state.StateDB, error) {
+		t.Fatalf("Expected the latest state not to be opened")
+		return nil, nil
+	})
+	if len(pending) != 0 || len(queued) != 0 {
+		t.Fatalf("Expected no txns, but got %v, %v", pending, queued)
+	}
+	pending, queued = groupPoolTxns(txs, signer, nil, func() (*state.StateDB, error) {
+		return nil, errors.New("no state")
+	})
+	if len(pending) != 0 || len(queued) != 0 {
+		t.Fatalf("Expected no txns without the latest state, but got %v, %v", pending, queued)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	yutypes "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm"
 )
 
 // Backend interface provides the common API services (that are provided by
@@ -35,6 +37,8 @@ type Backend interface {
 	AccountManager() *accounts.Manager
 	ExtRPCEnabled() bool
 	RPCGasCap() uint64            // global gas cap for eth_call over rpc: DoS protection
+	RPCLogsMaxBlockRange() uint64 // max block range of eth_getLogs, 0 means no limit
+	RPCLogsMaxResults() int       // max number of logs returned by eth_getLogs, 0 means no limit
 	RPCEVMTimeout() time.Duration // global timeout for eth_call over rpc: DoS protection
 	RPCTxFeeCap() float64         // global tx fee cap for all transaction related APIs
 	UnprotectedAllowed() bool     // allows only for EIP155 transactions.
@@ -56,6 +60,7 @@ type Backend interface {
 	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
 	GetTd(ctx context.Context, hash common.Hash) *big.Int
 	GetEVM(ctx context.Context, msg *core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config, blockCtx *vm.BlockContext) *vm.EVM
+	NewTraceEnv(block *yutypes.Block) (*evm.TraceEnv, error)
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
 	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
 	SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription
@@ -71,6 +76,7 @@ type Backend interface {
 	TxPoolContent() (map[common.Address][]*types.Transaction, map[common.Address][]*types.Transaction)
 	TxPoolContentFrom(addr common.Address) ([]*types.Transaction, []*types.Transaction)
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
+	SubscribeDroppedTxsEvent(chan<- DroppedTxEvent) event.Subscription
 
 	ChainConfig() *params.ChainConfig
 	Engine() consensus.Engine
@@ -98,9 +104,24 @@ func GetAPIs(apiBackend Backend) []rpc.API {
 		}, {
 			Namespace: "eth",
 			Service:   NewTransactionAPI(apiBackend, nonceLock),
+		}, {
+			Namespace: "eth",
+			Service:   NewFilterAPI(apiBackend),
 		}, {
 			Namespace: "debug",
 			Service:   NewDebugAPI(apiBackend),
+		}, {
+			Namespace: "debug",
+			Service:   NewTracerAPI(apiBackend),
+		}, {
+			Namespace: "trace",
+			Service:   NewTraceAPI(apiBackend),
+		}, {
+			Namespace: "txpool",
+			Service:   NewTxPoolAPI(apiBackend),
+		}, {
+			Namespace: "reddio",
+			Service:   NewReddioAPI(apiBackend),
 		}, {
 			Namespace: "net",
 			Service:   NewNetAPI(nil, 0),
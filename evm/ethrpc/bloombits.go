@@ -0,0 +1,54 @@
+package ethrpc
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/bitutil"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+const (
+	// bloomServiceThreads is the number of goroutines used globally by an Ethereum
+	// instance to service bloombits lookups for all running filters.
+	bloomServiceThreads = 16
+
+	// bloomFilterThreads is the number of goroutines used locally per filter to
+	// multiplex requests onto the global servicing goroutines.
+	bloomFilterThreads = 3
+
+	// bloomRetrievalBatch is the maximum number of bloom bit retrievals to service
+	// in a single batch.
+	bloomRetrievalBatch = 16
+
+	// bloomRetrievalWait is the maximum time to wait for enough bloom bit requests
+	// to accumulate request an entire batch (avoiding hysteresis).
+	bloomRetrievalWait = time.Duration(0)
+)
+
+// startBloomHandlers starts a batch of goroutines to accept bloom bit database
+// retrievals from possibly a range of filters and serving the data to satisfy.
+func (e *EthAPIBackend) startBloomHandlers(sectionSize uint64) {
+	for i := 0; i < bloomServiceThreads; i++ {
+		go func() {
+			for request := range e.bloomRequests {
+				task := <-request
+				task.Bitsets = make([][]byte, len(task.Sections))
+				for i, section := range task.Sections {
+					compVector, err := evm.ReadBloomBits(e.ChainDb(), task.Bit, section)
+					if err != nil {
+						task.Error = err
+						continue
+					}
+					blob, err := bitutil.DecompressBytes(compVector, int(sectionSize/8))
+					if err != nil {
+						task.Error = err
+						continue
+					}
+					task.Bitsets[i] = blob
+				}
+				request <- task
+			}
+		}()
+	}
+}
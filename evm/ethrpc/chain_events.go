@@ -0,0 +1,110 @@
+package ethrpc
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/sirupsen/logrus"
+	yutypes "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+// blockChanSize is the size of channel listening to the finalized blocks.
+const blockChanSize = 10
+
+// chainEventLoop converts the blocks finalized by the solidity tripod into the chain,
+// chain head and logs events of the backend.
+func (e *EthAPIBackend) chainEventLoop(solidity *evm.Solidity) {
+	blockCh := make(chan *yutypes.Block, blockChanSize)
+	sub := solidity.SubscribeFinalizedBlock(blockCh)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case block := <-blockCh:
+			e.sendChainEvents(block)
+		case err := <-sub.Err():
+			if err != nil {
+				logrus.Errorf("[ChainEvents] subscription of finalized blocks failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+func (e *EthAPIBackend) sendChainEvents(yuBlock *yutypes.Block) {
+	header := e.yuHeader2EthHeader(yuBlock.Header)
+	blockHash := common.Hash(yuBlock.Hash)
+	var logs []*types.Log
+	if len(yuBlock.Txns) > 0 {
+		txLogs, err := e.GetLogs(context.Background(), blockHash, uint64(yuBlock.Height))
+		if err != nil {
+			logrus.Errorf("[ChainEvents] Failed to get logs of block(%d): %v", yuBlock.Height, err)
+		}
+		for _, l := range txLogs {
+			logs = append(logs, l...)
+		}
+	}
+
+	block := types.NewBlockWithHeader(header)
+	e.chainFeed.Send(core.ChainEvent{Block: block, Hash: blockHash, Logs: logs})
+	e.chainHeadFeed.Send(core.ChainHeadEvent{Block: block})
+	if len(logs) > 0 {
+		e.logsFeed.Send(logs)
+	}
+}
+
+// subscribeTxPool subscribes to the txpool before the events are converted by txPoolEventLoop
+// in the background, so that no txn added after it returns is missed.
+func (e *EthAPIBackend) subscribeTxPool(pool *evm.TxPool) {
+	newCh := make(chan evm.NewTxnEvent, txChanSize)
+	newSub := pool.SubscribeNewTxns(newCh)
+	replacedCh := make(chan evm.ReplacedTxnEvent, txChanSize)
+	sub := pool.SubscribeReplacedTxns(replacedCh)
+	go e.txPoolEventLoop(newCh, newSub, replacedCh, sub)
+}
+
+// txPoolEventLoop converts the txns added into the txpool into the new txns events, and the
+// txns replaced in the txpool into the dropped txns events.
+func (e *EthAPIBackend) txPoolEventLoop(newCh <-chan evm.NewTxnEvent, newSub event.Subscription, replacedCh <-chan evm.ReplacedTxnEvent, sub event.Subscription) {
+	defer newSub.Unsubscribe()
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-newCh:
+			tx, err := YuTxn2EthTxn(ev.Txn)
+			if err != nil {
+				logrus.Errorf("[ChainEvents] Failed to decode new txn(%s): %v", ev.Txn.TxnHash.String(), err)
+				continue
+			}
+			e.txsFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+		case ev := <-replacedCh:
+			tx, err := YuTxn2EthTxn(ev.Replaced)
+			if err != nil {
+				logrus.Errorf("[ChainEvents] Failed to decode replaced txn(%s): %v", ev.Replaced.TxnHash.String(), err)
+				continue
+			}
+			e.droppedFeed.Send(DroppedTxEvent{Tx: tx, Reason: DroppedReplaced, Replacement: common.Hash(ev.Replacement)})
+		case err := <-sub.Err():
+			if err != nil {
+				logrus.Errorf("[ChainEvents] subscription of replaced txns failed: %v", err)
+			}
+			return
+		case err := <-newSub.Err():
+			if err != nil {
+				logrus.Errorf("[ChainEvents] subscription of new txns failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+func noopSubscription() event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
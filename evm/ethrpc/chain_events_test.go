@@ -0,0 +1,124 @@
+package ethrpc
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	yucommon "github.com/yu-org/yu/common"
+	yuconfig "github.com/yu-org/yu/config"
+	"github.com/yu-org/yu/core/txpool"
+	yutypes "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+func newTestTxPool() *evm.TxPool {
+	return evm.NewTxPool(txpool.NewTxPool(yucommon.FullNode, &yuconfig.TxpoolConf{PoolSize: 100, TxnMaxSize: 1 << 20}), 10)
+}
+
+// newTestEthTxn signs a transfer of the key with the nonce and the gas price.
+func newTestEthTxn(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, gasPrice int64) *types.Transaction {
+	to := common.HexToAddress("0x1001")
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID), &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &to,
+		Gas:      params.TxGas,
+		GasPrice: big.NewInt(gasPrice),
+		Value:    big.NewInt(1),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return tx
+}
+
+// newTestYuTxn wraps the signed eth txn into the ExecuteTxn call of the txpool, as SendTx does.
+func newTestYuTxn(t *testing.T, tx *types.Transaction) *yutypes.SignedTxn {
+	sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	v, r, s := tx.RawSignatureValues()
+	args, _ := json.Marshal(NewTxArgsFromTx(tx))
+	byt, err := json.Marshal(&evm.TxRequest{
+		Input:      tx.Data(),
+		Origin:     sender,
+		Address:    tx.To(),
+		GasLimit:   tx.Gas(),
+		GasPrice:   tx.GasPrice(),
+		Value:      tx.Value(),
+		Hash:       tx.Hash(),
+		Nonce:      tx.Nonce(),
+		V:          v,
+		R:          r,
+		S:          s,
+		OriginArgs: args,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return &yutypes.SignedTxn{
+		TxnHash: yucommon.Hash(tx.Hash()),
+		Raw: &yutypes.UnsignedTxn{WrCall: &yucommon.WrCall{
+			TripodName: SolidityTripod,
+			FuncName:   "ExecuteTxn",
+			Params:     string(byt),
+		}},
+	}
+}
+
+func TestTxPoolEvents(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	pool := newTestTxPool()
+	e := &EthAPIBackend{}
+	txsCh := make(chan core.NewTxsEvent, 2)
+	txsSub := e.SubscribeNewTxsEvent(txsCh)
+	defer txsSub.Unsubscribe()
+	droppedCh := make(chan DroppedTxEvent, 1)
+	droppedSub := e.SubscribeDroppedTxsEvent(droppedCh)
+	defer droppedSub.Unsubscribe()
+	e.subscribeTxPool(pool)
+
+	// the txns inserted into the txpool directly, e.g. from the p2p network, are posted too.
+	tx := newTestEthTxn(t, key, 0, params.GWei)
+	replacement := newTestEthTxn(t, key, 0, 2*params.GWei)
+	for _, txn := range []*types.Transaction{tx, replacement} {
+		if err := pool.Insert(newTestYuTxn(t, txn)); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		select {
+		case ev := <-txsCh:
+			if len(ev.Txs) != 1 || ev.Txs[0].Hash() != txn.Hash() {
+				t.Fatalf("Expected the new txn %s, but got %v", txn.Hash().Hex(), ev.Txs)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the new txn %s", txn.Hash().Hex())
+		}
+	}
+	select {
+	case ev := <-droppedCh:
+		if ev.Tx.Hash() != tx.Hash() || ev.Reason != DroppedReplaced || ev.Replacement != replacement.Hash() {
+			t.Fatalf("Expected txn %s replaced, but got %+v", tx.Hash().Hex(), ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected txn %s replaced", tx.Hash().Hex())
+	}
+
+	// the rejected txns are not posted.
+	if err := pool.Insert(newTestYuTxn(t, tx)); err == nil {
+		t.Fatalf("Expected the underpriced txn to be rejected")
+	}
+	select {
+	case ev := <-txsCh:
+		t.Fatalf("Expected no new txn, but got %v", ev.Txs)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
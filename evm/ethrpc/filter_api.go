@@ -0,0 +1,378 @@
+package ethrpc
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// chainEvChanSize is the size of channel listening to ChainEvent.
+	chainEvChanSize = 10
+	// logsChanSize is the size of channel listening to the logs.
+	logsChanSize = 10
+	// txChanSize is the size of channel listening to NewTxsEvent.
+	txChanSize = 4096
+	// filterTimeout is how long an installed filter lives without being polled.
+	filterTimeout = 5 * time.Minute
+)
+
+type filterType byte
+
+const (
+	logsFilter filterType = iota
+	blocksFilter
+	pendingTxsFilter
+)
+
+// filter is installed by `eth_newFilter`, `eth_newBlockFilter` or `eth_newPendingTransactionFilter`,
+// it collects the changes until they are polled by `eth_getFilterChanges`.
+type filter struct {
+	typ      filterType
+	fullTx   bool
+	crit     FilterCriteria
+	deadline *time.Timer // filter is inactive when deadline triggers
+	hashes   []common.Hash
+	txs      []*types.Transaction
+	logs     []*types.Log
+	sub      event.Subscription
+}
+
+// FilterAPI offers the `eth_subscribe` RPC methods over websocket, and the
+// installed filters which are polled over http.
+type FilterAPI struct {
+	b         Backend
+	timeout   time.Duration
+	filtersMu sync.Mutex
+	filters   map[rpc.ID]*filter
+}
+
+// NewFilterAPI creates a new instance of FilterAPI.
+func NewFilterAPI(b Backend) *FilterAPI {
+	api := &FilterAPI{
+		b:       b,
+		timeout: filterTimeout,
+		filters: make(map[rpc.ID]*filter),
+	}
+	go api.timeoutLoop()
+	return api
+}
+
+// timeoutLoop runs at the interval set by 'timeout' and deletes filters
+// that have not been recently used.
+func (api *FilterAPI) timeoutLoop() {
+	ticker := time.NewTicker(api.timeout)
+	defer ticker.Stop()
+	for range ticker.C {
+		api.filtersMu.Lock()
+		for id, f := range api.filters {
+			select {
+			case <-f.deadline.C:
+				delete(api.filters, id)
+				f.sub.Unsubscribe()
+			default:
+				continue
+			}
+		}
+		api.filtersMu.Unlock()
+	}
+}
+
+func (api *FilterAPI) installFilter(f *filter) rpc.ID {
+	id := rpc.NewID()
+	f.deadline = time.NewTimer(api.timeout)
+	api.filtersMu.Lock()
+	api.filters[id] = f
+	api.filtersMu.Unlock()
+	return id
+}
+
+// NewPendingTransactionFilter creates a filter that fetches pending transactions
+// as transactions enter the pending state. If fullTx is true the full tx is
+// returned, otherwise the hash is returned.
+func (api *FilterAPI) NewPendingTransactionFilter(fullTx *bool) rpc.ID {
+	txsCh := make(chan core.NewTxsEvent, txChanSize)
+	f := &filter{typ: pendingTxsFilter, fullTx: fullTx != nil && *fullTx}
+	f.sub = api.b.SubscribeNewTxsEvent(txsCh)
+	id := api.installFilter(f)
+	go func() {
+		for {
+			select {
+			case ev := <-txsCh:
+				api.filtersMu.Lock()
+				f.txs = append(f.txs, ev.Txs...)
+				api.filtersMu.Unlock()
+			case <-f.sub.Err():
+				return
+			}
+		}
+	}()
+	return id
+}
+
+// NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
+func (api *FilterAPI) NewBlockFilter() rpc.ID {
+	chainCh := make(chan core.ChainEvent, chainEvChanSize)
+	f := &filter{typ: blocksFilter}
+	f.sub = api.b.SubscribeChainEvent(chainCh)
+	id := api.installFilter(f)
+	go func() {
+		for {
+			select {
+			case ev := <-chainCh:
+				api.filtersMu.Lock()
+				f.hashes = append(f.hashes, ev.Hash)
+				api.filtersMu.Unlock()
+			case <-f.sub.Err():
+				return
+			}
+		}
+	}()
+	return id
+}
+
+// NewFilter creates a new filter and returns the filter id. It can be
+// used to retrieve logs when the state changes. This method cannot be
+// used to fetch logs that are already stored in the state.
+func (api *FilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
+	if len(crit.Topics) > maxTopics {
+		return "", errExceedMaxTopics
+	}
+	if isPendingBlock(crit.FromBlock) || isPendingBlock(crit.ToBlock) {
+		return "", errPendingLogsUnsupported
+	}
+	logsCh := make(chan []*types.Log, logsChanSize)
+	matcher := &LogFilter{b: api.b, addresses: crit.Addresses, topics: crit.Topics}
+	f := &filter{typ: logsFilter, crit: crit}
+	f.sub = api.b.SubscribeLogsEvent(logsCh)
+	id := api.installFilter(f)
+	go func() {
+		for {
+			select {
+			case logs := <-logsCh:
+				api.filtersMu.Lock()
+				for _, log := range logs {
+					if matcher.checkMatches(context.Background(), log) {
+						f.logs = append(f.logs, log)
+					}
+				}
+				api.filtersMu.Unlock()
+			case <-f.sub.Err():
+				return
+			}
+		}
+	}()
+	return id, nil
+}
+
+// GetFilterLogs returns the logs for the filter with the given id.
+// If the filter could not be found an empty array of logs is returned.
+func (api *FilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*types.Log, error) {
+	api.filtersMu.Lock()
+	f, found := api.filters[id]
+	api.filtersMu.Unlock()
+	if !found || f.typ != logsFilter {
+		return nil, errFilterNotFound
+	}
+	filter, err := newLogFilter(ctx, api.b, f.crit)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return returnLogs(logs), nil
+}
+
+// UninstallFilter removes the filter with the given filter id.
+func (api *FilterAPI) UninstallFilter(id rpc.ID) bool {
+	api.filtersMu.Lock()
+	f, found := api.filters[id]
+	if found {
+		delete(api.filters, id)
+	}
+	api.filtersMu.Unlock()
+	if found {
+		f.sub.Unsubscribe()
+	}
+	return found
+}
+
+// GetFilterChanges returns the logs for the filter with the given id since
+// last time it was called. This can be used for polling.
+//
+// For pending transaction and block filters the result is []common.Hash.
+// (pending)Log filters return []Log.
+func (api *FilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
+	api.filtersMu.Lock()
+	defer api.filtersMu.Unlock()
+
+	f, found := api.filters[id]
+	if !found {
+		return []interface{}{}, errFilterNotFound
+	}
+	if !f.deadline.Stop() {
+		// timer expired but filter is not yet removed in timeout loop
+		// receive timer value and reset timer
+		<-f.deadline.C
+	}
+	f.deadline.Reset(api.timeout)
+
+	switch f.typ {
+	case pendingTxsFilter:
+		txs := f.txs
+		f.txs = nil
+		if f.fullTx {
+			latest := api.b.CurrentHeader()
+			rpcTxs := make([]*RPCTransaction, 0, len(txs))
+			for _, tx := range txs {
+				rpcTxs = append(rpcTxs, NewRPCPendingTransaction(tx, latest, api.b.ChainConfig()))
+			}
+			return rpcTxs, nil
+		}
+		hashes := make([]common.Hash, 0, len(txs))
+		for _, tx := range txs {
+			hashes = append(hashes, tx.Hash())
+		}
+		return hashes, nil
+	case blocksFilter:
+		hashes := f.hashes
+		f.hashes = nil
+		return returnHashes(hashes), nil
+	case logsFilter:
+		logs := f.logs
+		f.logs = nil
+		return returnLogs(logs), nil
+	}
+	return []interface{}{}, errFilterNotFound
+}
+
+func isPendingBlock(number *big.Int) bool {
+	return number != nil && number.Int64() == rpc.PendingBlockNumber.Int64()
+}
+
+// returnHashes is a helper that will return an empty hash array case the given hash array is nil,
+// otherwise the given hashes array is returned.
+func returnHashes(hashes []common.Hash) []common.Hash {
+	if hashes == nil {
+		return []common.Hash{}
+	}
+	return hashes
+}
+
+// returnLogs is a helper that will return an empty log array in case the given logs array is nil,
+// otherwise the given logs array is returned.
+func returnLogs(logs []*types.Log) []*types.Log {
+	if logs == nil {
+		return []*types.Log{}
+	}
+	return logs
+}
+
+// NewHeads sends a notification each time a new block is appended to the chain.
+func (api *FilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	go func() {
+		chainCh := make(chan core.ChainEvent, chainEvChanSize)
+		sub := api.b.SubscribeChainEvent(chainCh)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-chainCh:
+				fields := RPCMarshalHeader(ev.Block.Header())
+				fields["hash"] = ev.Hash
+				notifier.Notify(rpcSub.ID, fields)
+			case <-rpcSub.Err():
+				return
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// Logs creates a subscription that fires for all new logs that match the given filter criteria.
+func (api *FilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if len(crit.Topics) > maxTopics {
+		return nil, errExceedMaxTopics
+	}
+
+	filter := &LogFilter{b: api.b, addresses: crit.Addresses, topics: crit.Topics}
+	rpcSub := notifier.CreateSubscription()
+	go func() {
+		logsCh := make(chan []*types.Log, logsChanSize)
+		sub := api.b.SubscribeLogsEvent(logsCh)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case logs := <-logsCh:
+				for _, log := range logs {
+					if filter.checkMatches(ctx, log) {
+						notifier.Notify(rpcSub.ID, log)
+					}
+				}
+			case <-rpcSub.Err():
+				return
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// NewPendingTransactions creates a subscription that is triggered each time a
+// transaction enters the transaction pool. If fullTx is true the full tx is
+// sent to the client, otherwise the hash is sent.
+func (api *FilterAPI) NewPendingTransactions(ctx context.Context, fullTx *bool) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	go func() {
+		txsCh := make(chan core.NewTxsEvent, txChanSize)
+		sub := api.b.SubscribeNewTxsEvent(txsCh)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-txsCh:
+				latest := api.b.CurrentHeader()
+				for _, tx := range ev.Txs {
+					if fullTx != nil && *fullTx {
+						notifier.Notify(rpcSub.ID, NewRPCPendingTransaction(tx, latest, api.b.ChainConfig()))
+					} else {
+						notifier.Notify(rpcSub.ID, tx.Hash())
+					}
+				}
+			case <-rpcSub.Err():
+				return
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
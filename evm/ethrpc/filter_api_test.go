@@ -0,0 +1,141 @@
+package ethrpc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func newTestFilterAPI(b Backend, timeout time.Duration) *FilterAPI {
+	api := &FilterAPI{
+		b:       b,
+		timeout: timeout,
+		filters: make(map[rpc.ID]*filter),
+	}
+	go api.timeoutLoop()
+	return api
+}
+
+// waitFilterChanges polls the filter until it has at least n changes, the changes are
+// collected in the background once the events are sent.
+func waitFilterChanges[T any](t *testing.T, api *FilterAPI, id rpc.ID, n int) []T {
+	var all []T
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		changes, err := api.GetFilterChanges(id)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		all = append(all, changes.([]T)...)
+		if len(all) >= n {
+			return all
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d changes, but got %d", n, len(all))
+		}
+	}
+}
+
+func TestBlockFilter(t *testing.T) {
+	e := &EthAPIBackend{}
+	api := newTestFilterAPI(e, filterTimeout)
+	id := api.NewBlockFilter()
+	if changes := waitFilterChanges[common.Hash](t, api, id, 0); len(changes) != 0 {
+		t.Fatalf("Expected no changes, but got %v", changes)
+	}
+
+	hashes := []common.Hash{{0x01}, {0x02}}
+	for i, hash := range hashes {
+		e.chainFeed.Send(core.ChainEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i + 1))}), Hash: hash})
+	}
+	changes := waitFilterChanges[common.Hash](t, api, id, 2)
+	if len(changes) != 2 || changes[0] != hashes[0] || changes[1] != hashes[1] {
+		t.Fatalf("Expected the hashes %v, but got %v", hashes, changes)
+	}
+	// the changes are only returned once.
+	if changes = waitFilterChanges[common.Hash](t, api, id, 0); len(changes) != 0 {
+		t.Fatalf("Expected no changes, but got %v", changes)
+	}
+
+	if !api.UninstallFilter(id) || api.UninstallFilter(id) {
+		t.Fatalf("Expected the filter to be uninstalled once")
+	}
+	if _, err := api.GetFilterChanges(id); !errors.Is(err, errFilterNotFound) {
+		t.Fatalf("Expected %v, but got %v", errFilterNotFound, err)
+	}
+}
+
+func TestLogsFilter(t *testing.T) {
+	var (
+		addr   = common.HexToAddress("0x1001")
+		other  = common.HexToAddress("0x1002")
+		topic  = common.HexToHash("0x01")
+		topic2 = common.HexToHash("0x02")
+	)
+	e := &EthAPIBackend{}
+	api := newTestFilterAPI(e, filterTimeout)
+
+	if _, err := api.NewFilter(FilterCriteria{FromBlock: big.NewInt(rpc.PendingBlockNumber.Int64())}); !errors.Is(err, errPendingLogsUnsupported) {
+		t.Fatalf("Expected %v, but got %v", errPendingLogsUnsupported, err)
+	}
+	if _, err := api.NewFilter(FilterCriteria{Topics: make([][]common.Hash, maxTopics+1)}); !errors.Is(err, errExceedMaxTopics) {
+		t.Fatalf("Expected %v, but got %v", errExceedMaxTopics, err)
+	}
+
+	id, err := api.NewFilter(FilterCriteria{Addresses: []common.Address{addr}, Topics: [][]common.Hash{{topic}}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	matched := &types.Log{Address: addr, Topics: []common.Hash{topic, topic2}, BlockNumber: 1}
+	e.logsFeed.Send([]*types.Log{
+		{Address: other, Topics: []common.Hash{topic}, BlockNumber: 1},
+		matched,
+		{Address: addr, Topics: []common.Hash{topic2}, BlockNumber: 1},
+		{Address: addr, BlockNumber: 1},
+	})
+	logs := waitFilterChanges[*types.Log](t, api, id, 1)
+	if len(logs) != 1 || logs[0] != matched {
+		t.Fatalf("Expected the log %+v, but got %v", matched, logs)
+	}
+	if _, err = api.GetFilterLogs(context.Background(), api.NewBlockFilter()); !errors.Is(err, errFilterNotFound) {
+		t.Fatalf("Expected the logs of a block filter to be %v, but got %v", errFilterNotFound, err)
+	}
+}
+
+func TestPendingTransactionFilter(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e := &EthAPIBackend{}
+	api := newTestFilterAPI(e, filterTimeout)
+	id := api.NewPendingTransactionFilter(nil)
+
+	txs := []*types.Transaction{newTestEthTxn(t, key, 0, params.GWei), newTestEthTxn(t, key, 1, params.GWei)}
+	e.txsFeed.Send(core.NewTxsEvent{Txs: txs})
+	changes := waitFilterChanges[common.Hash](t, api, id, 2)
+	if len(changes) != 2 || changes[0] != txs[0].Hash() || changes[1] != txs[1].Hash() {
+		t.Fatalf("Expected the hashes of the txns, but got %v", changes)
+	}
+}
+
+func TestFilterTimeout(t *testing.T) {
+	api := newTestFilterAPI(&EthAPIBackend{}, 20*time.Millisecond)
+	polled := api.NewBlockFilter()
+	idle := api.NewBlockFilter()
+	// polling the filter keeps it alive.
+	for i := 0; i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := api.GetFilterChanges(polled); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	if _, err := api.GetFilterChanges(idle); !errors.Is(err, errFilterNotFound) {
+		t.Fatalf("Expected the idle filter to be removed, but got %v", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"math/big"
 	"slices"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/consensus/misc/eip1559"
 	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
@@ -13,12 +15,23 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/sirupsen/logrus"
+	yutypes "github.com/yu-org/yu/core/types"
 
 	//"github.com/yu-org/yu/common"
 	"github.com/ethereum/go-ethereum/common"
 )
 
-const sampleNumber = 3 // Number of transactions sampled in a block
+const (
+	sampleNumber = 3 // Number of transactions sampled in a block
+
+	defaultCheckBlocks = 20
+	defaultPercentile  = 60
+
+	// maxFeeHistory is the max number of blocks of an `eth_feeHistory` query.
+	maxFeeHistory = 1024
+)
+
+var errInvalidPercentile = errors.New("invalid reward percentile")
 
 // Oracle recommends gas prices based on the content of recent
 // blocks. Suitable for both light and full clients.
@@ -28,108 +41,126 @@ type EthGasPrice struct {
 	lastPrice   *big.Int
 	maxPrice    *big.Int
 	ignorePrice *big.Int
-	// cacheLock   sync.RWMutex
-	// fetchLock   sync.Mutex
+	cacheLock   sync.RWMutex
+	fetchLock   sync.Mutex
 
 	checkBlocks, percentile int
-	// maxHeaderHistory, maxBlockHistory uint64
-
-	// historyCache *lru.Cache[cacheKey, processedFees]
 }
 
-func NewEthGasPrice(backend Backend) *EthGasPrice {
+func NewEthGasPrice(backend Backend, checkBlocks, percentile int) *EthGasPrice {
+	if checkBlocks < 1 {
+		logrus.Warnf("Sanitizing invalid gas price oracle check blocks %d, using %d", checkBlocks, defaultCheckBlocks)
+		checkBlocks = defaultCheckBlocks
+	}
+	if percentile < 0 || percentile > 100 {
+		logrus.Warnf("Sanitizing invalid gas price oracle percentile %d, using %d", percentile, defaultPercentile)
+		percentile = defaultPercentile
+	}
 	// default value from geth->config.go->FullNodeGPO
 	return &EthGasPrice{
 		backend:     backend,
-		checkBlocks: 20,
-		percentile:  60,
+		checkBlocks: checkBlocks,
+		percentile:  percentile,
 		maxPrice:    big.NewInt(500 * params.GWei),
 		ignorePrice: big.NewInt(2 * params.Wei),
 		lastPrice:   big.NewInt(params.GWei), // lastPrice default value from geth->miner.go->DefaultConfig
 	}
 }
 
-// SuggestTipCap returns a tip cap so that newly created transaction can have a
+// SuggestGasTipCap returns a tip cap so that newly created transaction can have a
 // very high chance to be included in the following blocks.
 //
 // Note, for legacy transactions and the legacy eth_gasPrice RPC call, it will be
 // necessary to add the basefee to the returned number to fall back to the legacy
 // behavior.
 func (e *EthAPIBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
-	//head, _, _ := e.HeaderByNumber(ctx, rpc.LatestBlockNumber)
-	//headHash := head.Hash()
-	//
-	//// TODO: need add cache lock
-	//// If the latest gasprice is still available, return it.
-	//// e.cacheLock.RLock()
-	//lastHead, lastPrice := e.gasPriceCache.lastHead, e.gasPriceCache.lastPrice
-	//// oracle.cacheLock.RUnlock()
-	//if headHash == lastHead {
-	//	return new(big.Int).Set(lastPrice), nil
-	//}
-	//// oracle.fetchLock.Lock()
-	//// defer oracle.fetchLock.Unlock()
-	//
-	//// Try checking the cache again, maybe the last fetch fetched what we need
-	////oracle.cacheLock.RLock()
-	////lastHead, lastPrice = ethGasPrice.lastHead, ethGasPrice.lastPrice
-	////oracle.cacheLock.RUnlock()
-	////if headHash == lastHead {
-	////	return new(big.Int).Set(lastPrice), nil
-	////}
-	//var (
-	//	sent, exp int
-	//	number    = head.Number.Uint64()
-	//	result    = make(chan results, e.gasPriceCache.checkBlocks)
-	//	quit      = make(chan struct{})
-	//	results   []*big.Int
-	//)
-	//for sent < e.gasPriceCache.checkBlocks && number > 0 {
-	//	go e.getBlockValues(ctx, number, sampleNumber, e.gasPriceCache.ignorePrice, result, quit)
-	//	sent++
-	//	exp++
-	//	number--
-	//}
-	//for exp > 0 {
-	//	res := <-result
-	//	if res.err != nil {
-	//		close(quit)
-	//		return new(big.Int).Set(lastPrice), res.err
-	//	}
-	//	exp--
-	//	// Nothing returned. There are two special cases here:
-	//	// - The block is empty
-	//	// - All the transactions included are sent by the miner itself.
-	//	// In these cases, use the latest calculated price for sampling.
-	//	if len(res.values) == 0 {
-	//		res.values = []*big.Int{lastPrice}
-	//	}
-	//	// Besides, in order to collect enough data for sampling, if nothing
-	//	// meaningful returned, try to query more blocks. But the maximum
-	//	// is 2*checkBlocks.
-	//	if len(res.values) == 1 && len(results)+1+exp < e.gasPriceCache.checkBlocks*2 && number > 0 {
-	//		go e.getBlockValues(ctx, number, sampleNumber, e.gasPriceCache.ignorePrice, result, quit)
-	//		sent++
-	//		exp++
-	//		number--
-	//	}
-	//	results = append(results, res.values...)
-	//}
-	//price := lastPrice
-	//if len(results) > 0 {
-	//	slices.SortFunc(results, func(a, b *big.Int) int { return a.Cmp(b) })
-	//	price = results[(len(results)-1)*e.gasPriceCache.percentile/100]
-	//}
-	//if price.Cmp(e.gasPriceCache.maxPrice) > 0 {
-	//	price = new(big.Int).Set(e.gasPriceCache.maxPrice)
-	//}
-	//// oracle.cacheLock.Lock()
-	//e.gasPriceCache.lastHead = headHash
-	//e.gasPriceCache.lastPrice = price
-	//// oracle.cacheLock.Unlock()
-	//
-	//return new(big.Int).Set(price), nil
-	return new(big.Int).SetUint64(1), nil
+	start := time.Now()
+	defer func() {
+		EthApiBackendDuration.WithLabelValues("suggestGasTipCap").Observe(float64(time.Since(start).Microseconds()))
+	}()
+	EthApiBackendCounter.WithLabelValues("suggestGasTipCap").Inc()
+	return e.gasPriceCache.SuggestTipCap(ctx)
+}
+
+// SuggestTipCap samples the lowest effective tips of the recent blocks and returns the
+// configured percentile of them. The result is cached until the head block changes.
+func (o *EthGasPrice) SuggestTipCap(ctx context.Context) (*big.Int, error) {
+	_, head, err := o.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	o.cacheLock.RLock()
+	lastHead, lastPrice := o.lastHead, o.lastPrice
+	o.cacheLock.RUnlock()
+	if head == nil {
+		return new(big.Int).Set(lastPrice), nil
+	}
+	headHash := common.Hash(head.Hash)
+
+	// If the latest gasprice is still available, return it.
+	if headHash == lastHead {
+		return new(big.Int).Set(lastPrice), nil
+	}
+	o.fetchLock.Lock()
+	defer o.fetchLock.Unlock()
+
+	// Try checking the cache again, maybe the last fetch fetched what we need
+	o.cacheLock.RLock()
+	lastHead, lastPrice = o.lastHead, o.lastPrice
+	o.cacheLock.RUnlock()
+	if headHash == lastHead {
+		return new(big.Int).Set(lastPrice), nil
+	}
+	var (
+		sent, exp int
+		number    = uint64(head.Height)
+		result    = make(chan results, o.checkBlocks)
+		quit      = make(chan struct{})
+		results   []*big.Int
+	)
+	for sent < o.checkBlocks && number > 0 {
+		go o.getBlockValues(ctx, number, sampleNumber, o.ignorePrice, result, quit)
+		sent++
+		exp++
+		number--
+	}
+	for exp > 0 {
+		res := <-result
+		if res.err != nil {
+			close(quit)
+			return new(big.Int).Set(lastPrice), res.err
+		}
+		exp--
+		// Nothing returned. The block is empty or all its txns are underpriced,
+		// use the latest calculated price for sampling.
+		if len(res.values) == 0 {
+			res.values = []*big.Int{lastPrice}
+		}
+		// Besides, in order to collect enough data for sampling, if nothing
+		// meaningful returned, try to query more blocks. But the maximum
+		// is 2*checkBlocks.
+		if len(res.values) == 1 && len(results)+1+exp < o.checkBlocks*2 && number > 0 {
+			go o.getBlockValues(ctx, number, sampleNumber, o.ignorePrice, result, quit)
+			sent++
+			exp++
+			number--
+		}
+		results = append(results, res.values...)
+	}
+	price := lastPrice
+	if len(results) > 0 {
+		slices.SortFunc(results, func(a, b *big.Int) int { return a.Cmp(b) })
+		price = results[(len(results)-1)*o.percentile/100]
+	}
+	if price.Cmp(o.maxPrice) > 0 {
+		price = new(big.Int).Set(o.maxPrice)
+	}
+	o.cacheLock.Lock()
+	o.lastHead = headHash
+	o.lastPrice = price
+	o.cacheLock.Unlock()
+
+	return new(big.Int).Set(price), nil
 }
 
 type results struct {
@@ -137,68 +168,91 @@ type results struct {
 	err    error
 }
 
-// getBlockValues calculates the lowest transaction gas price in a given block
-// and sends it to the result channel. If the block is empty or all transactions
-// are sent by the miner itself(it doesn't make any sense to include this kind of
-// transaction prices for sampling), nil gasprice is returned.
-func (e *EthAPIBackend) getBlockValues(ctx context.Context, blockNum uint64, limit int, ignoreUnder *big.Int, result chan results, quit chan struct{}) {
-	block, _, err := e.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
-	if block == nil {
-		select {
-		case result <- results{nil, err}:
-		case <-quit:
-		}
-		return
+// getBlockValues calculates the lowest effective tips of the txns in a given block
+// from their receipts and sends them to the result channel. If the block is empty,
+// nil tips are returned.
+func (o *EthGasPrice) getBlockValues(ctx context.Context, blockNum uint64, limit int, ignoreUnder *big.Int, result chan results, quit chan struct{}) {
+	prices, err := o.blockTips(ctx, blockNum, limit, ignoreUnder)
+	select {
+	case result <- results{prices, err}:
+	case <-quit:
 	}
-	signer := types.MakeSigner(e.ChainConfig(), block.Number(), block.Time())
-
-	// Sort the transaction by effective tip in ascending sort.
-	txs := block.Transactions()
-	sortedTxs := make([]*types.Transaction, len(txs))
-	copy(sortedTxs, txs)
-	baseFee := block.BaseFee()
-	slices.SortFunc(sortedTxs, func(a, b *types.Transaction) int {
-		// It's okay to discard the error because a tx would never be
-		// accepted into a block with an invalid effective tip.
-		tip1, _ := a.EffectiveGasTip(baseFee)
-		tip2, _ := b.EffectiveGasTip(baseFee)
-		return tip1.Cmp(tip2)
-	})
+}
 
-	var prices []*big.Int
-	for _, tx := range sortedTxs {
-		tip, _ := tx.EffectiveGasTip(baseFee)
-		if ignoreUnder != nil && tip.Cmp(ignoreUnder) == -1 {
+func (o *EthGasPrice) blockTips(ctx context.Context, blockNum uint64, limit int, ignoreUnder *big.Int) ([]*big.Int, error) {
+	header, yuHeader, err := o.backend.HeaderByNumber(ctx, rpc.BlockNumber(blockNum))
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %d not found", blockNum)
+	}
+	receipts, err := o.backend.GetReceipts(ctx, common.Hash(yuHeader.Hash))
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort the tips in ascending order.
+	tips := make([]*big.Int, 0, len(receipts))
+	for _, receipt := range receipts {
+		if receipt == nil || receipt.EffectiveGasPrice == nil {
 			continue
 		}
-		sender, err := types.Sender(signer, tx)
-		if err == nil && sender != block.Coinbase() {
-			prices = append(prices, tip)
-			if len(prices) >= limit {
-				break
-			}
+		tip := effectiveTip(receipt, header.BaseFee)
+		if ignoreUnder != nil && tip.Cmp(ignoreUnder) == -1 {
+			continue
 		}
+		tips = append(tips, tip)
 	}
-	select {
-	case result <- results{prices, nil}:
-	case <-quit:
+	slices.SortFunc(tips, func(a, b *big.Int) int { return a.Cmp(b) })
+	if len(tips) > limit {
+		tips = tips[:limit]
 	}
+	return tips, nil
+}
+
+// effectiveTip is the part of the effective gas price of the receipt above the base fee.
+func effectiveTip(receipt *types.Receipt, baseFee *big.Int) *big.Int {
+	if receipt.EffectiveGasPrice == nil {
+		return new(big.Int)
+	}
+	tip := new(big.Int).Set(receipt.EffectiveGasPrice)
+	if baseFee != nil {
+		tip.Sub(tip, baseFee)
+	}
+	if tip.Sign() < 0 {
+		tip.SetUint64(0)
+	}
+	return tip
 }
 
 func (e *EthAPIBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, []*big.Int, []float64, error) {
 	if blockCount < 1 {
 		return common.Big0, nil, nil, nil, nil, nil, nil
 	}
+	if blockCount > maxFeeHistory {
+		blockCount = maxFeeHistory
+	}
+	for i, p := range rewardPercentiles {
+		if p < 0 || p > 100 {
+			return common.Big0, nil, nil, nil, nil, nil, fmt.Errorf("%w: %f", errInvalidPercentile, p)
+		}
+		if i > 0 && p <= rewardPercentiles[i-1] {
+			return common.Big0, nil, nil, nil, nil, nil, fmt.Errorf("%w: #%d:%f >= #%d:%f", errInvalidPercentile, i-1, rewardPercentiles[i-1], i, p)
+		}
+	}
 
 	oldestBlock := common.Big0
-	currentHeader := e.CurrentHeader().Number.Uint64()
+	head := e.CurrentHeader()
+	if head == nil {
+		return common.Big0, nil, nil, nil, nil, nil, errors.New("head block not found")
+	}
+	currentHeader := head.Number.Uint64()
 	resolvedLastBlock := uint64(0)
 	if lastBlock < 0 {
 		switch lastBlock {
-		case rpc.PendingBlockNumber:
-			// TODO: Don't know how to implement it
-		case rpc.LatestBlockNumber:
-			// Retrieved above.
+		case rpc.PendingBlockNumber, rpc.LatestBlockNumber:
+			// Retrieved above, the pending block is not served.
 			resolvedLastBlock = currentHeader
 		case rpc.SafeBlockNumber:
 			header, _, _ := e.HeaderByNumber(ctx, rpc.SafeBlockNumber)
@@ -221,16 +275,18 @@ func (e *EthAPIBackend) FeeHistory(ctx context.Context, blockCount uint64, lastB
 	results := make([]*blockFees, 0)
 
 	for i := 0; i < int(blockCount); i++ {
-		blockNumber := oldestBlock
+		blockNumber := new(big.Int).Add(oldestBlock, big.NewInt(int64(i)))
 		if blockNumber.Uint64() > resolvedLastBlock {
 			break
 		}
 		fees := &blockFees{blockNumber: blockNumber.Uint64()}
 
 		if len(rewardPercentiles) > 0 {
-			fees.block, _, fees.err = e.BlockByNumber(ctx, rpc.BlockNumber(blockNumber.Int64()))
-			if fees.block != nil && fees.err != nil {
-				fees.receipts, fees.err = e.GetReceipts(ctx, fees.block.Hash())
+			var yuBlock *yutypes.Block
+			fees.block, yuBlock, fees.err = e.BlockByNumber(ctx, rpc.BlockNumber(blockNumber.Int64()))
+			if fees.block != nil && fees.err == nil {
+				// the receipts are indexed by the yu block hash, not the hash of the eth header.
+				fees.receipts, fees.err = e.GetReceipts(ctx, common.Hash(yuBlock.Hash))
 				fees.header = fees.block.Header()
 			}
 		} else {
@@ -408,7 +464,7 @@ func (e *EthAPIBackend) processBlock(bf *blockFees, percentiles []float64) {
 	}
 
 	bf.results.reward = make([]*big.Int, len(percentiles))
-	if len(bf.block.Transactions()) == 0 {
+	if len(bf.receipts) == 0 {
 		// return an all zero row if there are no transactions to gather data from
 		for i := range bf.results.reward {
 			bf.results.reward[i] = new(big.Int)
@@ -416,10 +472,11 @@ func (e *EthAPIBackend) processBlock(bf *blockFees, percentiles []float64) {
 		return
 	}
 
-	sorter := make([]txGasAndReward, len(bf.block.Transactions()))
-	for i, tx := range bf.block.Transactions() {
-		reward, _ := tx.EffectiveGasTip(bf.block.BaseFee())
-		sorter[i] = txGasAndReward{gasUsed: bf.receipts[i].GasUsed, reward: reward}
+	// The rewards are the effective tips of the receipts, some txns of the block
+	// may have no receipt if they were rejected before their execution.
+	sorter := make([]txGasAndReward, len(bf.receipts))
+	for i, receipt := range bf.receipts {
+		sorter[i] = txGasAndReward{gasUsed: receipt.GasUsed, reward: effectiveTip(receipt, bf.results.baseFee)}
 	}
 	slices.SortStableFunc(sorter, func(a, b txGasAndReward) int {
 		return a.reward.Cmp(b.reward)
@@ -430,7 +487,7 @@ func (e *EthAPIBackend) processBlock(bf *blockFees, percentiles []float64) {
 
 	for i, p := range percentiles {
 		thresholdGasUsed := uint64(float64(bf.block.GasUsed()) * p / 100)
-		for sumGasUsed < thresholdGasUsed && txIndex < len(bf.block.Transactions())-1 {
+		for sumGasUsed < thresholdGasUsed && txIndex < len(sorter)-1 {
 			txIndex++
 			sumGasUsed += sorter[txIndex].gasUsed
 		}
@@ -0,0 +1,124 @@
+package ethrpc
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	yucommon "github.com/yu-org/yu/common"
+	yutypes "github.com/yu-org/yu/core/types"
+)
+
+// testGasPriceBackend serves the blocks whose txns paid the tips, in gwei, on the base fee of 1 gwei.
+type testGasPriceBackend struct {
+	Backend
+	head uint64
+	tips map[uint64][]int64
+
+	mu           sync.Mutex
+	receiptCalls int
+}
+
+func (b *testGasPriceBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, *yutypes.Header, error) {
+	height := uint64(number)
+	if number == rpc.LatestBlockNumber {
+		height = b.head
+	}
+	if height > b.head {
+		return nil, nil, nil
+	}
+	header := &types.Header{Number: new(big.Int).SetUint64(height), BaseFee: big.NewInt(params.GWei)}
+	return header, &yutypes.Header{Height: yucommon.BlockNum(height), Hash: yucommon.Hash(common.BigToHash(header.Number))}, nil
+}
+
+func (b *testGasPriceBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receiptCalls++
+	var receipts types.Receipts
+	for _, tip := range b.tips[hash.Big().Uint64()] {
+		price := new(big.Int).Mul(big.NewInt(tip), big.NewInt(params.GWei))
+		receipts = append(receipts, &types.Receipt{EffectiveGasPrice: price.Add(price, big.NewInt(params.GWei))})
+	}
+	return receipts, nil
+}
+
+func (b *testGasPriceBackend) calls() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.receiptCalls
+}
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.GWei))
+}
+
+func TestSuggestTipCap(t *testing.T) {
+	b := &testGasPriceBackend{
+		head: 3,
+		tips: map[uint64][]int64{
+			// only the 3 lowest tips of a block are sampled.
+			1: {4, 3, 2, 1},
+			2: {5},
+			3: {7, 6},
+		},
+	}
+	// the tips sampled from the 3 blocks are 1, 2, 3, 5, 6, 7 gwei.
+	for _, c := range []struct {
+		percentile int
+		expected   *big.Int
+	}{
+		{0, gwei(1)},
+		{50, gwei(3)},
+		{60, gwei(5)},
+		{100, gwei(7)},
+	} {
+		o := NewEthGasPrice(b, 3, c.percentile)
+		tip, err := o.SuggestTipCap(context.Background())
+		if err != nil || tip.Cmp(c.expected) != 0 {
+			t.Fatalf("Expected tip %v of percentile %d, but got %v, %v", c.expected, c.percentile, tip, err)
+		}
+	}
+
+	// the tip is cached until the head changes.
+	o := NewEthGasPrice(b, 3, 100)
+	if tip, err := o.SuggestTipCap(context.Background()); err != nil || tip.Cmp(gwei(7)) != 0 {
+		t.Fatalf("Expected tip %v, but got %v, %v", gwei(7), tip, err)
+	}
+	calls := b.calls()
+	tip, err := o.SuggestTipCap(context.Background())
+	if err != nil || tip.Cmp(gwei(7)) != 0 || b.calls() != calls {
+		t.Fatalf("Expected the cached tip %v, but got %v, %v after %d receipts queries", gwei(7), tip, err, b.calls()-calls)
+	}
+	// the cached tip is not shared with the callers.
+	tip.SetInt64(0)
+
+	// the tips are capped by the max price.
+	b.head = 4
+	b.tips[4] = []int64{1000}
+	if tip, err = o.SuggestTipCap(context.Background()); err != nil || tip.Cmp(gwei(500)) != 0 {
+		t.Fatalf("Expected the max tip %v, but got %v, %v", gwei(500), tip, err)
+	}
+	if b.calls() == calls {
+		t.Fatalf("Expected the tip to be sampled again for the new head")
+	}
+}
+
+func TestSuggestTipCapEmptyBlocks(t *testing.T) {
+	// the empty blocks and the tips under the ignored price are sampled as the last price.
+	b := &testGasPriceBackend{head: 2, tips: map[uint64][]int64{2: {0}}}
+	o := NewEthGasPrice(b, 2, 60)
+	tip, err := o.SuggestTipCap(context.Background())
+	if err != nil || tip.Cmp(big.NewInt(params.GWei)) != 0 {
+		t.Fatalf("Expected the default tip of 1 gwei, but got %v, %v", tip, err)
+	}
+
+	if o = NewEthGasPrice(b, 0, 101); o.checkBlocks != defaultCheckBlocks || o.percentile != defaultPercentile {
+		t.Fatalf("Expected the default check blocks and percentile, but got %d, %d", o.checkBlocks, o.percentile)
+	}
+}
@@ -0,0 +1,530 @@
+package ethrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+const (
+	// bucketIdleTimeout is how long the token buckets of a client live without requests.
+	bucketIdleTimeout = 10 * time.Minute
+
+	apiKeyHeader = "X-API-Key"
+	apiKeyQuery  = "api_key"
+
+	// maxRequestSize caps the body of an http request, it is the body limit of the RPC server.
+	maxRequestSize = 5 * 1024 * 1024
+
+	// unknownMethod is the method the calls of the methods which are not served are limited
+	// and counted as, so that the clients can't grow the buckets and the metrics.
+	unknownMethod = "unknown"
+)
+
+// the JSON-RPC error codes of the rejected requests, see EIP-1474.
+const (
+	errCodeUnauthorized  = -32001
+	errCodeMethodDenied  = -32004
+	errCodeLimitExceeded = -32005
+)
+
+// the reasons of the throttled calls in RPCGatewayThrottledCounter.
+const (
+	throttledRateLimit    = "rate_limit"
+	throttledQuota        = "quota"
+	throttledDenied       = "denied"
+	throttledBatchSize    = "batch_size"
+	throttledResponseSize = "response_size"
+	throttledAPIKey       = "api_key"
+)
+
+// Middleware wraps the http handler of the RPC server, e.g. to reject some requests.
+type Middleware func(next http.Handler) http.Handler
+
+// chainMiddlewares wraps h with the middlewares, the first one handles the requests first.
+func chainMiddlewares(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// rpcCall is the part of a JSON-RPC call the gateway checks.
+type rpcCall struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// gateway limits the RPC requests with the config of RPCGatewayConfig. The requests with
+// an API key are limited per key, the others per IP. The websocket connections are checked
+// when they are upgraded, and then every message like an http request.
+type gateway struct {
+	cfg       *evm.RPCGatewayConfig
+	keys      map[string]*apiKey
+	ipBuckets *buckets
+	// methods are the methods served by the RPC server.
+	methods map[string]bool
+	// trustedProxies are the proxies whose forwarding headers carry the IPs of the clients.
+	trustedProxies []*net.IPNet
+}
+
+type apiKey struct {
+	cfg     *evm.RPCAPIKey
+	buckets *buckets
+
+	mu   sync.Mutex
+	day  int64 // the UTC day the quota is used in
+	used uint64
+}
+
+func newGateway(cfg *evm.RPCGatewayConfig, apis []rpc.API) (*gateway, error) {
+	g := &gateway{
+		cfg:       cfg,
+		keys:      make(map[string]*apiKey, len(cfg.APIKeys)),
+		ipBuckets: newBuckets(cfg.IPRateLimit),
+		methods:   rpcMethods(apis),
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		ipNet, err := parseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+		}
+		g.trustedProxies = append(g.trustedProxies, ipNet)
+	}
+	for i := range cfg.APIKeys {
+		key := &cfg.APIKeys[i]
+		g.keys[key.Key] = &apiKey{cfg: key, buckets: newBuckets(key.RateLimit)}
+	}
+	go g.evictLoop()
+	return g, nil
+}
+
+// parseCIDR parses a CIDR, or an IP as the CIDR of the IP alone.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.New("not an IP or a CIDR")
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+// rpcMethods returns the methods the RPC server serves for the apis, they are named like the
+// RPC server names the exported methods of the services.
+func rpcMethods(apis []rpc.API) map[string]bool {
+	methods := map[string]bool{"rpc_modules": true}
+	for _, api := range apis {
+		methods[api.Namespace+"_subscribe"] = true
+		methods[api.Namespace+"_unsubscribe"] = true
+		typ := reflect.TypeOf(api.Service)
+		for i := 0; i < typ.NumMethod(); i++ {
+			name := []rune(typ.Method(i).Name)
+			name[0] = unicode.ToLower(name[0])
+			methods[api.Namespace+"_"+string(name)] = true
+		}
+	}
+	return methods
+}
+
+// method returns the method the call is limited and counted as.
+func (g *gateway) method(call rpcCall) string {
+	if g.methods[call.Method] {
+		return call.Method
+	}
+	return unknownMethod
+}
+
+// evictLoop deletes the token buckets of the clients without recent requests.
+func (g *gateway) evictLoop() {
+	ticker := time.NewTicker(bucketIdleTimeout)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		g.ipBuckets.evict(now)
+		for _, key := range g.keys {
+			key.buckets.evict(now)
+		}
+	}
+}
+
+// Middleware rejects the requests exceeding the limits before they reach next.
+func (g *gateway) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		calls, batch, ok := parseCalls(body)
+		if !ok {
+			// the invalid requests are answered by the RPC server.
+			next.ServeHTTP(w, r)
+			return
+		}
+		if status, code, reason, msg := g.check(r, calls, batch); status != 0 {
+			g.throttled(reason, calls)
+			writeRPCErrors(w, status, calls, batch, code, msg)
+			return
+		}
+		if g.cfg.MaxResponseSize <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &cappedResponseWriter{ResponseWriter: w, limit: g.cfg.MaxResponseSize}
+		next.ServeHTTP(cw, r)
+		if cw.exceeded {
+			g.throttled(throttledResponseSize, calls)
+			writeRPCErrors(w, http.StatusOK, calls, batch, errCodeLimitExceeded, "response size exceeds the limit")
+			return
+		}
+		cw.flush()
+	})
+}
+
+// check returns the http status, the error code, the throttle reason and the error message
+// if the calls are rejected, the status is zero otherwise.
+func (g *gateway) check(r *http.Request, calls []rpcCall, batch bool) (int, int, string, string) {
+	c, status, code, reason, msg := g.authenticate(r)
+	if status != 0 {
+		return status, code, reason, msg
+	}
+	return g.checkCalls(c, calls, batch)
+}
+
+// gatewayClient is who the calls of a request are limited for, the API key of the request
+// or its IP if it has no key.
+type gatewayClient struct {
+	key *apiKey
+	id  string
+}
+
+// authenticate returns the client of the request, the status is non-zero if the API key
+// of the request is missing while it is required, or unknown.
+func (g *gateway) authenticate(r *http.Request) (*gatewayClient, int, int, string, string) {
+	keyStr := r.Header.Get(apiKeyHeader)
+	if keyStr == "" {
+		keyStr = r.URL.Query().Get(apiKeyQuery)
+	}
+	if keyStr == "" {
+		if g.cfg.RequireAPIKey {
+			return nil, http.StatusUnauthorized, errCodeUnauthorized, throttledAPIKey, "missing API key"
+		}
+		return &gatewayClient{id: g.clientIP(r)}, 0, 0, "", ""
+	}
+	key, ok := g.keys[keyStr]
+	if !ok {
+		return nil, http.StatusUnauthorized, errCodeUnauthorized, throttledAPIKey, "invalid API key"
+	}
+	return &gatewayClient{key: key, id: keyStr}, 0, 0, "", ""
+}
+
+// checkCalls checks the calls against the batch size, and the methods, the rate limit and
+// the quota of the client.
+func (g *gateway) checkCalls(c *gatewayClient, calls []rpcCall, batch bool) (int, int, string, string) {
+	if batch && g.cfg.MaxBatchSize > 0 && len(calls) > g.cfg.MaxBatchSize {
+		return http.StatusRequestEntityTooLarge, errCodeLimitExceeded, throttledBatchSize, "batch size exceeds the limit"
+	}
+	methods := make([]string, len(calls))
+	for i, call := range calls {
+		methods[i] = g.method(call)
+	}
+	if c.key == nil {
+		if !g.ipBuckets.allow(c.id, methods) {
+			return http.StatusTooManyRequests, errCodeLimitExceeded, throttledRateLimit, "rate limit exceeded"
+		}
+		return 0, 0, "", ""
+	}
+
+	key := c.key
+	for _, call := range calls {
+		if !key.permits(call.Method) {
+			return http.StatusForbidden, errCodeMethodDenied, throttledDenied, "method " + call.Method + " is not allowed"
+		}
+	}
+	if !key.buckets.allow(c.id, methods) {
+		return http.StatusTooManyRequests, errCodeLimitExceeded, throttledRateLimit, "rate limit exceeded"
+	}
+	if !key.useQuota(uint64(len(calls)), time.Now()) {
+		return http.StatusTooManyRequests, errCodeLimitExceeded, throttledQuota, "daily quota exceeded"
+	}
+	return 0, 0, "", ""
+}
+
+// clientIP returns the IP of the client of the request. The forwarding headers are only
+// read from the trusted proxies, and X-Forwarded-For is read from the right, the first
+// hop which is not a trusted proxy is the client.
+func (g *gateway) clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !g.trusted(ip) {
+		return ip
+	}
+	if cfConnectingIP := r.Header.Get("CF-Connecting-IP"); cfConnectingIP != "" {
+		return cfConnectingIP
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = strings.TrimSpace(hops[i])
+			if !g.trusted(ip) {
+				return ip
+			}
+		}
+		return ip
+	}
+	if xri := r.Header.Get("X-Real-Ip"); xri != "" {
+		return xri
+	}
+	return ip
+}
+
+func (g *gateway) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range g.trustedProxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// permits reports whether the method is allowed and not denied for the key.
+func (k *apiKey) permits(method string) bool {
+	if matchMethod(k.cfg.Deny, method) {
+		return false
+	}
+	return len(k.cfg.Allow) == 0 || matchMethod(k.cfg.Allow, method)
+}
+
+// useQuota counts n calls in the daily quota of the key, it is reset every UTC day.
+func (k *apiKey) useQuota(n uint64, now time.Time) bool {
+	if k.cfg.DailyQuota == 0 {
+		return true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if day := now.UTC().Unix() / 86400; day != k.day {
+		k.day, k.used = day, 0
+	}
+	if k.used+n > k.cfg.DailyQuota {
+		return false
+	}
+	k.used += n
+	return true
+}
+
+// matchMethod reports whether the method is listed, or its namespace as "eth_*".
+func matchMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+		if ns, ok := strings.CutSuffix(m, "*"); ok && strings.HasPrefix(method, ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// buckets are the token buckets of the methods of every client.
+type buckets struct {
+	limit evm.RPCRateLimit
+
+	mu      sync.Mutex
+	clients map[string]*clientBuckets
+}
+
+type clientBuckets struct {
+	methods  map[string]*rate.Limiter
+	lastSeen time.Time
+}
+
+func newBuckets(limit evm.RPCRateLimit) *buckets {
+	return &buckets{limit: limit, clients: make(map[string]*clientBuckets)}
+}
+
+// allow takes a token of the bucket of the method of every call, the calls are rejected
+// together if one of the buckets is empty.
+func (b *buckets) allow(client string, methods []string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(methods))
+	for _, method := range methods {
+		limiter := b.limiter(client, method, now)
+		if limiter == nil {
+			continue
+		}
+		r := limiter.ReserveN(now, 1)
+		if !r.OK() || r.DelayFrom(now) > 0 {
+			// give back the tokens of the batch, the latest reservation first.
+			r.CancelAt(now)
+			for i := len(reservations) - 1; i >= 0; i-- {
+				reservations[i].CancelAt(now)
+			}
+			return false
+		}
+		reservations = append(reservations, r)
+	}
+	return true
+}
+
+// limiter returns the token bucket of the method of the client, nil if it is not limited.
+func (b *buckets) limiter(client, method string, now time.Time) *rate.Limiter {
+	rps, burst := b.limit.RPS, b.limit.Burst
+	if m, ok := b.limit.Methods[method]; ok {
+		rps, burst = m.RPS, m.Burst
+	}
+	if rps <= 0 {
+		return nil
+	}
+	c, ok := b.clients[client]
+	if !ok {
+		c = &clientBuckets{methods: make(map[string]*rate.Limiter)}
+		b.clients[client] = c
+	}
+	c.lastSeen = now
+	limiter, ok := c.methods[method]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(rps), max(burst, 1))
+		c.methods[method] = limiter
+	}
+	return limiter
+}
+
+func (b *buckets) evict(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for client, c := range b.clients {
+		if now.Sub(c.lastSeen) > bucketIdleTimeout {
+			delete(b.clients, client)
+		}
+	}
+}
+
+// parseCalls decodes the methods and the ids of a single or a batch request.
+func parseCalls(body []byte) ([]rpcCall, bool, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var calls []rpcCall
+		if err := json.Unmarshal(body, &calls); err != nil {
+			return nil, true, false
+		}
+		return calls, true, true
+	}
+	var call rpcCall
+	if err := json.Unmarshal(body, &call); err != nil {
+		return nil, false, false
+	}
+	return []rpcCall{call}, false, true
+}
+
+// writeRPCErrors answers every call with the error.
+func writeRPCErrors(w http.ResponseWriter, status int, calls []rpcCall, batch bool, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if resp := rpcErrors(calls, batch, code, msg); resp != nil {
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// rpcErrors returns the responses answering every call with the error, nil if there is none.
+func rpcErrors(calls []rpcCall, batch bool, code int, msg string) any {
+	type rpcError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	type rpcResponse struct {
+		Version string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   rpcError        `json:"error"`
+	}
+	resps := make([]rpcResponse, len(calls))
+	for i, call := range calls {
+		id := call.ID
+		if len(id) == 0 {
+			id = json.RawMessage("null")
+		}
+		resps[i] = rpcResponse{Version: "2.0", ID: id, Error: rpcError{Code: code, Message: msg}}
+	}
+	if batch {
+		return resps
+	}
+	if len(resps) > 0 {
+		return resps[0]
+	}
+	return nil
+}
+
+// cappedResponseWriter buffers the response until it exceeds the limit, then it is discarded.
+type cappedResponseWriter struct {
+	http.ResponseWriter
+	limit    int
+	status   int
+	buf      bytes.Buffer
+	exceeded bool
+}
+
+func (w *cappedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *cappedResponseWriter) Write(b []byte) (int, error) {
+	if w.exceeded {
+		return len(b), nil
+	}
+	if w.buf.Len()+len(b) > w.limit {
+		w.exceeded = true
+		w.buf.Reset()
+		return len(b), nil
+	}
+	return w.buf.Write(b)
+}
+
+func (w *cappedResponseWriter) flush() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+}
+
+func (g *gateway) throttled(reason string, calls []rpcCall) {
+	for _, call := range calls {
+		RPCGatewayThrottledCounter.WithLabelValues(reason, g.method(call)).Inc()
+	}
+}
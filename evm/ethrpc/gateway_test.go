@@ -0,0 +1,221 @@
+package ethrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+// newTestGateway serves the echo service behind the gateway of cfg.
+func newTestGateway(t *testing.T, cfg *evm.RPCGatewayConfig) (*gateway, http.Handler) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("test", testEchoService{}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	g, err := newGateway(cfg, []rpc.API{{Namespace: "test", Service: testEchoService{}}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return g, g.Middleware(srv)
+}
+
+func newRPCRequest(target, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func serveRPC(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func postRPC(h http.Handler, body string, header http.Header) *httptest.ResponseRecorder {
+	r := newRPCRequest("/", body)
+	for k, v := range header {
+		r.Header.Set(k, v[0])
+	}
+	return serveRPC(h, r)
+}
+
+func echoCall(id int) string {
+	return `{"jsonrpc":"2.0","id":` + string(rune('0'+id)) + `,"method":"test_echo","params":["hi"]}`
+}
+
+// checkRPC checks the http status of the response and the error code of its first call,
+// zero for no error.
+func checkRPC(t *testing.T, w *httptest.ResponseRecorder, status, code int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("Expected status %d, but got %d: %s", status, w.Code, w.Body.String())
+	}
+	var resps []testRPCResponse
+	body := strings.TrimSpace(w.Body.String())
+	if !strings.HasPrefix(body, "[") {
+		body = "[" + body + "]"
+	}
+	if err := json.Unmarshal([]byte(body), &resps); err != nil || len(resps) == 0 {
+		t.Fatalf("Expected the JSON-RPC responses, but got %s", w.Body.String())
+	}
+	if code == 0 && resps[0].Error != nil {
+		t.Fatalf("Expected no error, but got %+v", resps[0].Error)
+	}
+	if code != 0 && (resps[0].Error == nil || resps[0].Error.Code != code) {
+		t.Fatalf("Expected error code %d, but got %s", code, w.Body.String())
+	}
+}
+
+func TestGatewayRateLimit(t *testing.T) {
+	g, h := newTestGateway(t, &evm.RPCGatewayConfig{
+		IPRateLimit: evm.RPCRateLimit{
+			RPS:     0.001,
+			Burst:   2,
+			Methods: map[string]evm.RPCMethodLimit{"test_echo": {RPS: 0.001, Burst: 3}},
+		},
+	})
+
+	// the batch exceeding the bucket is rejected, and its tokens are given back.
+	batch := "[" + echoCall(1) + "," + echoCall(2) + "," + echoCall(3) + "," + echoCall(4) + "]"
+	checkRPC(t, postRPC(h, batch, nil), http.StatusTooManyRequests, errCodeLimitExceeded)
+	for i := 1; i <= 3; i++ {
+		checkRPC(t, postRPC(h, echoCall(i), nil), http.StatusOK, 0)
+	}
+	checkRPC(t, postRPC(h, echoCall(4), nil), http.StatusTooManyRequests, errCodeLimitExceeded)
+
+	// every IP has its buckets.
+	r := newRPCRequest("/", echoCall(5))
+	r.RemoteAddr = "192.0.2.2:1234"
+	checkRPC(t, serveRPC(h, r), http.StatusOK, 0)
+
+	// the methods which are not served share one bucket of the default limit.
+	for i, method := range []string{"test_a", "test_b", "test_c"} {
+		w := postRPC(h, `{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`, nil)
+		if i < 2 {
+			checkRPC(t, w, http.StatusOK, -32601)
+		} else {
+			checkRPC(t, w, http.StatusTooManyRequests, errCodeLimitExceeded)
+		}
+	}
+	c := g.ipBuckets.clients["192.0.2.1"]
+	if len(c.methods) != 2 || c.methods[unknownMethod] == nil {
+		t.Fatalf("Expected the buckets of test_echo and %s, but got %v", unknownMethod, c.methods)
+	}
+	if m := g.method(rpcCall{Method: "test_a"}); m != unknownMethod {
+		t.Fatalf("Expected the method to be counted as %s, but got %s", unknownMethod, m)
+	}
+	if m := g.method(rpcCall{Method: "test_echo"}); m != "test_echo" {
+		t.Fatalf("Expected the method test_echo, but got %s", m)
+	}
+
+	// the buckets of the idle clients are evicted.
+	g.ipBuckets.evict(time.Now().Add(bucketIdleTimeout + time.Second))
+	if len(g.ipBuckets.clients) != 0 {
+		t.Fatalf("Expected the buckets to be evicted, but got %v", g.ipBuckets.clients)
+	}
+}
+
+func TestGatewayAPIKeys(t *testing.T) {
+	_, h := newTestGateway(t, &evm.RPCGatewayConfig{
+		MaxBatchSize:  2,
+		RequireAPIKey: true,
+		APIKeys: []evm.RPCAPIKey{
+			{Key: "key", Allow: []string{"test_*"}, Deny: []string{"test_secret"}},
+			{Key: "limited", RateLimit: evm.RPCRateLimit{RPS: 0.001, Burst: 1}},
+		},
+	})
+	keyHeader := http.Header{apiKeyHeader: {"key"}}
+
+	checkRPC(t, postRPC(h, echoCall(1), nil), http.StatusUnauthorized, errCodeUnauthorized)
+	checkRPC(t, postRPC(h, echoCall(1), http.Header{apiKeyHeader: {"other"}}), http.StatusUnauthorized, errCodeUnauthorized)
+	checkRPC(t, postRPC(h, echoCall(1), keyHeader), http.StatusOK, 0)
+	// the key is also read from the query.
+	checkRPC(t, serveRPC(h, newRPCRequest("/?"+apiKeyQuery+"=key", echoCall(1))), http.StatusOK, 0)
+
+	checkRPC(t, postRPC(h, `{"jsonrpc":"2.0","id":1,"method":"test_secret"}`, keyHeader), http.StatusForbidden, errCodeMethodDenied)
+	checkRPC(t, postRPC(h, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`, keyHeader), http.StatusForbidden, errCodeMethodDenied)
+	batch := "[" + echoCall(1) + "," + echoCall(2) + "," + echoCall(3) + "]"
+	checkRPC(t, postRPC(h, batch, keyHeader), http.StatusRequestEntityTooLarge, errCodeLimitExceeded)
+
+	// the keys are limited apart from the IPs.
+	limited := http.Header{apiKeyHeader: {"limited"}}
+	checkRPC(t, postRPC(h, echoCall(1), limited), http.StatusOK, 0)
+	checkRPC(t, postRPC(h, echoCall(2), limited), http.StatusTooManyRequests, errCodeLimitExceeded)
+	checkRPC(t, postRPC(h, echoCall(3), keyHeader), http.StatusOK, 0)
+}
+
+func TestGatewayQuota(t *testing.T) {
+	g, h := newTestGateway(t, &evm.RPCGatewayConfig{
+		APIKeys: []evm.RPCAPIKey{{Key: "key", DailyQuota: 3}},
+	})
+	keyHeader := http.Header{apiKeyHeader: {"key"}}
+	checkRPC(t, postRPC(h, "["+echoCall(1)+","+echoCall(2)+"]", keyHeader), http.StatusOK, 0)
+	// the batch is counted whole, the calls over the quota are rejected together.
+	checkRPC(t, postRPC(h, "["+echoCall(3)+","+echoCall(4)+"]", keyHeader), http.StatusTooManyRequests, errCodeLimitExceeded)
+	checkRPC(t, postRPC(h, echoCall(3), keyHeader), http.StatusOK, 0)
+	checkRPC(t, postRPC(h, echoCall(4), keyHeader), http.StatusTooManyRequests, errCodeLimitExceeded)
+
+	// the quota is reset every UTC day.
+	key := g.keys["key"]
+	day := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	if !key.useQuota(3, day) || key.useQuota(1, day.Add(59*time.Minute)) {
+		t.Fatalf("Expected the quota of the day to be used up")
+	}
+	if !key.useQuota(1, day.Add(time.Hour)) || key.used != 1 {
+		t.Fatalf("Expected the quota of the next day, but got %d used", key.used)
+	}
+}
+
+func TestGatewayClientIP(t *testing.T) {
+	g, err := newGateway(&evm.RPCGatewayConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for i, c := range []struct {
+		remote   string
+		header   http.Header
+		expected string
+	}{
+		// the headers of the clients which are not trusted are ignored.
+		{"198.51.100.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.1"}}, "198.51.100.1"},
+		{"198.51.100.1:1234", http.Header{"Cf-Connecting-Ip": {"203.0.113.1"}}, "198.51.100.1"},
+		{"192.0.2.1:1234", http.Header{"Cf-Connecting-Ip": {"203.0.113.1"}, "X-Forwarded-For": {"203.0.113.2"}}, "203.0.113.1"},
+		// X-Forwarded-For is read from the right, the spoofed hops on the left are skipped.
+		{"10.1.2.3:1234", http.Header{"X-Forwarded-For": {"203.0.113.9, 203.0.113.1, 10.0.0.2"}}, "203.0.113.1"},
+		{"10.1.2.3:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"10.1.2.3:1234", http.Header{"X-Real-Ip": {"203.0.113.1"}}, "203.0.113.1"},
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = c.remote
+		for k, v := range c.header {
+			r.Header[k] = v
+		}
+		if ip := g.clientIP(r); ip != c.expected {
+			t.Fatalf("Expected the IP %s of case %d, but got %s", c.expected, i, ip)
+		}
+	}
+
+	if _, err = newGateway(&evm.RPCGatewayConfig{TrustedProxies: []string{"proxy"}}, nil); err == nil {
+		t.Fatalf("Expected the invalid trusted proxy to fail")
+	}
+}
+
+func TestGatewaySizes(t *testing.T) {
+	_, h := newTestGateway(t, &evm.RPCGatewayConfig{MaxResponseSize: 64})
+	w := postRPC(h, `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["`+strings.Repeat("a", maxRequestSize)+`"]}`, nil)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status %d, but got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	checkRPC(t, postRPC(h, echoCall(1), nil), http.StatusOK, 0)
+	w = postRPC(h, `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["`+strings.Repeat("a", 64)+`"]}`, nil)
+	checkRPC(t, w, http.StatusOK, errCodeLimitExceeded)
+}
@@ -13,9 +13,12 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
 	yutypes "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm"
 )
 
 var (
@@ -24,12 +27,13 @@ var (
 	errInvalidBlockRange      = errors.New("invalid block range params")
 	errPendingLogsUnsupported = errors.New("pending logs are not supported")
 	errExceedMaxTopics        = errors.New("exceed max topics")
+	errExceedMaxBlockRange    = errors.New("block range is too wide")
+	errExceedMaxResults       = errors.New("query returned more than the max number of logs")
 )
 
 const (
-	maxTopics          = 100
-	maxSubTopics       = 1000
-	getLogsLimitBlocks = 500
+	maxTopics    = 100
+	maxSubTopics = 1000
 )
 
 // FilterCriteria represents a request to create a new filter.
@@ -169,6 +173,8 @@ type LogFilter struct {
 
 	block      *common.Hash // Block hash if filtering a single block
 	begin, end int64        // Range interval if filtering multiple blocks
+
+	matcher *bloombits.Matcher
 }
 
 func newLogFilter(ctx context.Context, b Backend, crit FilterCriteria) (*LogFilter, error) {
@@ -195,19 +201,23 @@ func newLogFilter(ctx context.Context, b Backend, crit FilterCriteria) (*LogFilt
 			return nil, errPendingLogsUnsupported
 		}
 
-		_, hdr, _ := b.HeaderByNumber(ctx, rpc.LatestBlockNumber)
-		if begin == rpc.LatestBlockNumber.Int64() {
+		_, hdr, err := b.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		// latest, safe and finalized are the same block, the blocks are final once appended.
+		if begin < 0 {
 			begin = int64(hdr.Height)
 		}
-		if end == rpc.LatestBlockNumber.Int64() {
+		if end < 0 {
 			end = int64(hdr.Height)
 		}
 
-		if begin > 0 && end > 0 && begin > end {
+		if begin > end {
 			return nil, errInvalidBlockRange
 		}
-		if end-begin > getLogsLimitBlocks {
-			return nil, errors.New("block range is too wide")
+		if maxRange := b.RPCLogsMaxBlockRange(); maxRange > 0 && uint64(end-begin) > maxRange {
+			return nil, errExceedMaxBlockRange
 		}
 
 		filter = &LogFilter{
@@ -216,6 +226,7 @@ func newLogFilter(ctx context.Context, b Backend, crit FilterCriteria) (*LogFilt
 			end:       end,
 			addresses: crit.Addresses,
 			topics:    crit.Topics,
+			matcher:   newBloomMatcher(b, crit.Addresses, crit.Topics),
 		}
 	}
 
@@ -232,24 +243,55 @@ func (f *LogFilter) Logs(ctx context.Context) ([]*types.Log, error) {
 			return nil, errors.New("unknown block")
 		}
 		return f.FilterLogs(ctx, yuHeader)
-	} else {
-		var result []*types.Log
-		for ; f.begin <= f.end; f.begin++ {
-			_, yuHeader, err := f.b.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
-			if err != nil {
-				logrus.Errorf("[GetLog] Failed to getHeaderByNumber %v, error: %s", f.begin, err)
-				return nil, err
+	}
+
+	// stop the range query once it returns, e.g. when it exceeds the max results.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		maxResults       = f.b.RPCLogsMaxResults()
+		result           []*types.Log
+		logChan, errChan = f.rangeLogsAsync(ctx)
+	)
+	for {
+		select {
+		case log := <-logChan:
+			if maxResults > 0 && len(result) >= maxResults {
+				return nil, errExceedMaxResults
 			}
-			logs, err := f.FilterLogs(ctx, yuHeader)
+			result = append(result, log)
+		case err := <-errChan:
 			if err != nil {
+				logrus.Errorf("[GetLog] Failed to get logs of blocks [%d, %d], error: %s", f.begin, f.end, err)
 				return nil, err
 			}
-			result = append(result, logs...)
+			return result, nil
 		}
-		return result, nil
 	}
 }
 
+// newBloomMatcher creates the bloombits matcher of the addresses and topics,
+// the same way as the log filter of geth.
+func newBloomMatcher(b Backend, addresses []common.Address, topics [][]common.Hash) *bloombits.Matcher {
+	var filters [][][]byte
+	if len(addresses) > 0 {
+		filter := make([][]byte, len(addresses))
+		for i, address := range addresses {
+			filter[i] = address.Bytes()
+		}
+		filters = append(filters, filter)
+	}
+	for _, topicList := range topics {
+		filter := make([][]byte, len(topicList))
+		for i, topic := range topicList {
+			filter[i] = topic.Bytes()
+		}
+		filters = append(filters, filter)
+	}
+	size, _ := b.BloomStatus()
+	return bloombits.NewMatcher(size, filters)
+}
+
 func (f *LogFilter) FilterLogs(ctx context.Context, yuHeader *yutypes.Header) ([]*types.Log, error) {
 	logs, err := f.b.GetLogs(ctx, common.Hash(yuHeader.Hash), uint64(yuHeader.Height))
 	if err != nil {
@@ -304,7 +346,7 @@ func (f *LogFilter) checkMatches(ctx context.Context, vLog *types.Log) bool {
 func (f *LogFilter) rangeLogsAsync(ctx context.Context) (chan *types.Log, chan error) {
 	var (
 		logChan = make(chan *types.Log)
-		errChan = make(chan error)
+		errChan = make(chan error, 1)
 	)
 
 	go func() {
@@ -315,19 +357,18 @@ func (f *LogFilter) rangeLogsAsync(ctx context.Context) (chan *types.Log, chan e
 
 		// Gather all indexed logs, and finish with non indexed ones
 		var (
-			end = uint64(f.end)
-			// size, sections = f.sys.backend.BloomStatus()
-			// err            error
+			end            = uint64(f.end)
+			size, sections = f.b.BloomStatus()
 		)
-		// if indexed := sections * size; indexed > uint64(f.begin) {
-		// 	if indexed > end {
-		// 		indexed = end + 1
-		// 	}
-		// 	if err = f.indexedLogs(ctx, indexed-1, logChan); err != nil {
-		// 		errChan <- err
-		// 		return
-		// 	}
-		// }
+		if indexed := sections * size; indexed > uint64(f.begin) {
+			if indexed > end {
+				indexed = end + 1
+			}
+			if err := f.indexedLogs(ctx, indexed-1, logChan); err != nil {
+				errChan <- err
+				return
+			}
+		}
 
 		if err := f.unindexedLogs(ctx, end, logChan); err != nil {
 			errChan <- err
@@ -340,15 +381,65 @@ func (f *LogFilter) rangeLogsAsync(ctx context.Context) (chan *types.Log, chan e
 	return logChan, errChan
 }
 
+// indexedLogs returns the logs matching the filter criteria based on the bloom
+// bits indexed available locally or via the network.
+func (f *LogFilter) indexedLogs(ctx context.Context, end uint64, logChan chan *types.Log) error {
+	// Create a matcher session and request servicing from the backend
+	matches := make(chan uint64, 64)
+
+	session, err := f.matcher.Start(ctx, uint64(f.begin), end, matches)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	f.b.ServiceFilter(ctx, session)
+
+	for {
+		select {
+		case number, ok := <-matches:
+			// Abort if all matches have been fulfilled
+			if !ok {
+				err := session.Error()
+				if err == nil {
+					f.begin = int64(end) + 1
+				}
+				return err
+			}
+			f.begin = int64(number) + 1
+
+			// Retrieve the suggested block and pull any truly matching logs
+			_, yuHeader, err := f.b.HeaderByNumber(ctx, rpc.BlockNumber(number))
+			if yuHeader == nil || err != nil {
+				return err
+			}
+			found, err := f.FilterLogs(ctx, yuHeader)
+			if err != nil {
+				return err
+			}
+			for _, log := range found {
+				select {
+				case logChan <- log:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 // unindexedLogs returns the logs matching the filter criteria based on raw block
 // iteration and bloom matching.
 func (f *LogFilter) unindexedLogs(ctx context.Context, end uint64, logChan chan *types.Log) error {
 	for ; f.begin <= int64(end); f.begin++ {
-		header, _, err := f.b.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
-		if header == nil || err != nil {
+		header, yuHeader, err := f.b.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
+		if yuHeader == nil || err != nil {
 			return err
 		}
-		found, err := f.blockLogs(ctx, header)
+		found, err := f.blockLogs(ctx, header, yuHeader)
 		if err != nil {
 			return err
 		}
@@ -362,47 +453,43 @@ func (f *LogFilter) unindexedLogs(ctx context.Context, end uint64, logChan chan
 	}
 	return nil
 }
-func (f *LogFilter) blockLogs(ctx context.Context, header *types.Header) ([]*types.Log, error) {
-	//if bloomFilter(header.Bloom, f.addresses, f.topics) {
-	return f.checkMatchesFromHeader(ctx, header)
-	//}
-	//return nil, nil
+
+// blockLogs returns the logs matching the filter criteria within a single block.
+// The blocks committed before their logs bloom was stored are always checked.
+func (f *LogFilter) blockLogs(ctx context.Context, header *types.Header, yuHeader *yutypes.Header) ([]*types.Log, error) {
+	if evm.HasBlockBloom(f.b.ChainDb(), uint64(yuHeader.Height)) && !bloomFilter(header.Bloom, f.addresses, f.topics) {
+		return nil, nil
+	}
+	return f.FilterLogs(ctx, yuHeader)
 }
 
-// checkMatches checks if the receipts belonging to the given header contain any log events that
-// match the filter criteria. This function is called when the bloom filter signals a potential match.
-// skipFilter signals all logs of the given block are requested.
-func (f *LogFilter) checkMatchesFromHeader(ctx context.Context, header *types.Header) ([]*types.Log, error) {
-	// hash := header.Hash()
-	// // Logs in cache are partially filled with context data
-	// // such as tx index, block hash, etc.
-	// // Notably tx hash is NOT filled in because it needs
-	// // access to block body data.
-	// cached, err := f.sys.cachedLogElem(ctx, hash, header.Number.Uint64())
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// logs := filterLogs(cached.logs, nil, nil, f.addresses, f.topics)
-	// if len(logs) == 0 {
-	// 	return nil, nil
-	// }
-	// // Most backends will deliver un-derived logs, but check nevertheless.
-	// if len(logs) > 0 && logs[0].TxHash != (common.Hash{}) {
-	// 	return logs, nil
-	// }
-
-	// body, err := f.sys.cachedGetBody(ctx, cached, hash, header.Number.Uint64())
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// for i, log := range logs {
-	// 	// Copy log not to modify cache elements
-	// 	logcopy := *log
-	// 	logcopy.TxHash = body.Transactions[logcopy.TxIndex].Hash()
-	// 	logs[i] = &logcopy
-	// }
-	// return logs, nil
-	return nil, nil
+func bloomFilter(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		var included bool
+		for _, addr := range addresses {
+			if types.BloomLookup(bloom, addr) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, sub := range topics {
+		included := len(sub) == 0 // empty rule set == wildcard
+		for _, topic := range sub {
+			if types.BloomLookup(bloom, topic) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return true
 }
 
 // filterLogs creates a slice of logs matching the given criteria.
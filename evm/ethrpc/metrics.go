@@ -6,6 +6,8 @@ const (
 	TypeLbl       = "type"
 	TypeCountLbl  = "count"
 	TypeStatusLbl = "status"
+	ReasonLbl     = "reason"
+	MethodLbl     = "method"
 )
 
 var (
@@ -39,10 +41,21 @@ var (
 		},
 		[]string{TypeLbl},
 	)
+
+	RPCGatewayThrottledCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "reddio",
+			Subsystem: "rpc_gateway",
+			Name:      "throttled_counter",
+			Help:      "Total number of the calls rejected by the RPC gateway",
+		},
+		[]string{ReasonLbl, MethodLbl},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(EthApiBackendCounter)
 	prometheus.MustRegister(EthApiBackendDuration)
 	prometheus.MustRegister(TransactionAPICounter)
+	prometheus.MustRegister(RPCGatewayThrottledCounter)
 }
@@ -0,0 +1,325 @@
+package ethrpc
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/sirupsen/logrus"
+	yutypes "github.com/yu-org/yu/core/types"
+	ytime "github.com/yu-org/yu/utils/time"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+// pendingRecommit is how long the changes of the txpool are batched before the pending
+// block is rebuilt, a block appended to the chain rebuilds it at once.
+const pendingRecommit = 200 * time.Millisecond
+
+// pendingBlock is the speculative block of the executable txns of the txpool on top of
+// the end block, it is executed on a copy of the state of the end block.
+type pendingBlock struct {
+	key      common.Hash // the hash of the end block and of the txns of the txpool
+	yuBlock  *yutypes.Block
+	block    *types.Block
+	receipts types.Receipts
+	state    *state.StateDB
+}
+
+// pendingCache keeps the pending block, it is rebuilt in the background by loop and the
+// requests are served with the cached one.
+type pendingCache struct {
+	// build returns the pending block on top of the end block, or prev if neither the end
+	// block nor the txpool changed since prev was built.
+	build func(prev *pendingBlock) (*pendingBlock, error)
+
+	// buildMu serializes the builds, so that an older build never replaces a newer one.
+	buildMu sync.Mutex
+	mu      sync.Mutex
+	pending *pendingBlock
+}
+
+// pending returns the pending block with a copy of its state, the cached state is not safe
+// for concurrent use.
+func (e *EthAPIBackend) pending() (*pendingBlock, error) {
+	head, err := e.chain.Chain.GetEndCompactBlock()
+	if err != nil {
+		return nil, err
+	}
+	return e.pendingCache.get(common.Hash(head.Hash))
+}
+
+// get returns a copy of the cached pending block. It is only built by the caller if it is
+// not on top of head yet, i.e. before loop has built the first one or caught up with head.
+func (c *pendingCache) get(head common.Hash) (*pendingBlock, error) {
+	c.mu.Lock()
+	p := c.pending
+	c.mu.Unlock()
+	if p == nil || p.block.ParentHash() != head {
+		var err error
+		if p, err = c.rebuild(); err != nil {
+			return nil, err
+		}
+	}
+	cpy := *p
+	cpy.state = p.state.Copy()
+	return &cpy, nil
+}
+
+func (c *pendingCache) rebuild() (*pendingBlock, error) {
+	c.buildMu.Lock()
+	defer c.buildMu.Unlock()
+	c.mu.Lock()
+	prev := c.pending
+	c.mu.Unlock()
+	p, err := c.build(prev)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.pending = p
+	c.mu.Unlock()
+	return p, nil
+}
+
+// startPendingLoop subscribes to the chain and the txpool events of the backend before the
+// pending block is rebuilt on them by loop in the background.
+func (e *EthAPIBackend) startPendingLoop() {
+	chainCh := make(chan core.ChainEvent, chainEvChanSize)
+	chainSub := e.SubscribeChainEvent(chainCh)
+	txsCh := make(chan core.NewTxsEvent, txChanSize)
+	txsSub := e.SubscribeNewTxsEvent(txsCh)
+	droppedCh := make(chan DroppedTxEvent, txChanSize)
+	droppedSub := e.SubscribeDroppedTxsEvent(droppedCh)
+	go e.pendingCache.loop(chainCh, txsCh, droppedCh, chainSub, txsSub, droppedSub)
+}
+
+// loop rebuilds the pending block once a block is appended to the chain, and pendingRecommit
+// after the first change of the txpool since the last build.
+func (c *pendingCache) loop(chainCh <-chan core.ChainEvent, txsCh <-chan core.NewTxsEvent, droppedCh <-chan DroppedTxEvent, subs ...event.Subscription) {
+	errCh := make(chan error, len(subs))
+	for _, sub := range subs {
+		defer sub.Unsubscribe()
+		go func(sub event.Subscription) {
+			errCh <- <-sub.Err()
+		}(sub)
+	}
+	var recommit <-chan time.Time
+	rebuild := func() {
+		recommit = nil
+		if _, err := c.rebuild(); err != nil {
+			logrus.Errorf("[Pending] Failed to build the pending block: %v", err)
+		}
+	}
+	for {
+		select {
+		case <-chainCh:
+			rebuild()
+		case <-txsCh:
+			if recommit == nil {
+				recommit = time.After(pendingRecommit)
+			}
+		case <-droppedCh:
+			if recommit == nil {
+				recommit = time.After(pendingRecommit)
+			}
+		case <-recommit:
+			rebuild()
+		case err := <-errCh:
+			if err != nil {
+				logrus.Errorf("[Pending] subscription failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// buildLatestPending builds the pending block of the txns of the txpool on top of the end
+// block, prev is returned if neither of them changed.
+func (e *EthAPIBackend) buildLatestPending(prev *pendingBlock) (*pendingBlock, error) {
+	head, err := e.chain.Chain.GetEndCompactBlock()
+	if err != nil {
+		return nil, err
+	}
+	stxns, err := e.chain.Pool.GetAllTxns()
+	if err != nil {
+		return nil, err
+	}
+	key := pendingKey(head, stxns)
+	if prev != nil && prev.key == key {
+		return prev, nil
+	}
+	p, err := e.buildPending(head, stxns)
+	if err != nil {
+		return nil, err
+	}
+	p.key = key
+	return p, nil
+}
+
+func pendingKey(head *yutypes.CompactBlock, stxns []*yutypes.SignedTxn) common.Hash {
+	data := make([]byte, 0, (len(stxns)+1)*common.HashLength)
+	data = append(data, head.Hash.Bytes()...)
+	for _, stxn := range stxns {
+		data = append(data, stxn.TxnHash.Bytes()...)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// buildPending executes the txns of the txpool on top of head.
+func (e *EthAPIBackend) buildPending(head *yutypes.CompactBlock, stxns []*yutypes.SignedTxn) (*pendingBlock, error) {
+	var (
+		chainCfg = e.ChainConfig()
+		number   = new(big.Int).SetUint64(uint64(head.Height) + 1)
+		now      = ytime.NowTsU64()
+		signer   = types.MakeSigner(chainCfg, number, now)
+	)
+	ordered, txs := orderPendingTxns(stxns, signer)
+	yuBlock := &yutypes.Block{
+		Header: &yutypes.Header{
+			PrevHash:  head.Hash,
+			Height:    head.Height + 1,
+			Timestamp: now,
+			LeiLimit:  head.LeiLimit,
+		},
+		Txns: ordered,
+	}
+	solidity := e.chain.GetTripodInstance(SolidityTripod).(*evm.Solidity)
+	env, err := solidity.NewPendingEnv(yuBlock)
+	if err != nil {
+		return nil, err
+	}
+	ethTxs, receipts := applyPendingTxns(env, yuBlock, txs, signer)
+
+	statedb := env.StateDB()
+	header := &types.Header{
+		ParentHash: common.Hash(head.Hash),
+		Difficulty: new(big.Int),
+		Number:     number,
+		GasLimit:   yuBlock.LeiLimit,
+		GasUsed:    yuBlock.LeiUsed,
+		Time:       now,
+		BaseFee:    env.BaseFee(),
+		Root:       statedb.IntermediateRoot(chainCfg.IsEIP158(number)),
+	}
+	return &pendingBlock{
+		yuBlock:  yuBlock,
+		block:    types.NewBlock(header, ethTxs, nil, receipts, trie.NewStackTrie(nil)),
+		receipts: receipts,
+		state:    statedb,
+	}, nil
+}
+
+// orderPendingTxns orders the txns of the txpool for the pending block, and returns the eth
+// txns of them. The txns of a sender are ordered by their nonces, the txns of the same nonce
+// by their tip caps, and the senders in the descending order of the tip caps of their first
+// txns, then of their addresses. The txns which can't be decoded are left out.
+func orderPendingTxns(stxns []*yutypes.SignedTxn, signer types.Signer) ([]*yutypes.SignedTxn, map[*yutypes.SignedTxn]*types.Transaction) {
+	var (
+		senders = make(map[common.Address][]*yutypes.SignedTxn)
+		txs     = make(map[*yutypes.SignedTxn]*types.Transaction, len(stxns))
+	)
+	for _, stxn := range stxns {
+		tx, err := YuTxn2EthTxn(stxn)
+		if err != nil {
+			continue
+		}
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			continue
+		}
+		txs[stxn] = tx
+		senders[sender] = append(senders[sender], stxn)
+	}
+	addrs := make([]common.Address, 0, len(senders))
+	for sender, list := range senders {
+		sort.Slice(list, func(i, j int) bool {
+			a, b := txs[list[i]], txs[list[j]]
+			if a.Nonce() != b.Nonce() {
+				return a.Nonce() < b.Nonce()
+			}
+			if cmp := a.GasTipCapCmp(b); cmp != 0 {
+				return cmp > 0
+			}
+			return bytes.Compare(list[i].TxnHash.Bytes(), list[j].TxnHash.Bytes()) < 0
+		})
+		addrs = append(addrs, sender)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if cmp := txs[senders[addrs[i]][0]].GasTipCapCmp(txs[senders[addrs[j]][0]]); cmp != 0 {
+			return cmp > 0
+		}
+		return bytes.Compare(addrs[i].Bytes(), addrs[j].Bytes()) < 0
+	})
+	ordered := make([]*yutypes.SignedTxn, 0, len(txs))
+	for _, sender := range addrs {
+		ordered = append(ordered, senders[sender]...)
+	}
+	return ordered, txs
+}
+
+// pendingEnv executes the txns of the pending block, it is implemented by evm.TraceEnv.
+type pendingEnv interface {
+	ApplyTxn(index int, hooks *tracing.Hooks) (*types.Receipt, error)
+	StateDB() *state.StateDB
+}
+
+// applyPendingTxns executes the ordered txns of the block on env, and keeps the executed
+// ones in the block. The txns of a nonce below the next one of their sender are left out,
+// e.g. the txns already in the chain or replaced. The txns after a gap of nonces, the txns
+// rejected and the txns exceeding the block gas limit are left out with the following
+// txns of their senders.
+func applyPendingTxns(env pendingEnv, yuBlock *yutypes.Block, txs map[*yutypes.SignedTxn]*types.Transaction, signer types.Signer) ([]*types.Transaction, types.Receipts) {
+	var (
+		gasUsed  uint64
+		included = make(yutypes.SignedTxns, 0, len(yuBlock.Txns))
+		ethTxs   = make([]*types.Transaction, 0, len(yuBlock.Txns))
+		receipts = make(types.Receipts, 0, len(yuBlock.Txns))
+		nonces   = make(map[common.Address]uint64)
+		skipped  = make(map[common.Address]bool)
+	)
+	for i, stxn := range yuBlock.Txns {
+		tx := txs[stxn]
+		sender, _ := types.Sender(signer, tx)
+		if skipped[sender] {
+			continue
+		}
+		nonce, ok := nonces[sender]
+		if !ok {
+			nonce = env.StateDB().GetNonce(sender)
+		}
+		if tx.Nonce() < nonce {
+			continue
+		}
+		if tx.Nonce() > nonce || gasUsed+tx.Gas() > yuBlock.LeiLimit {
+			skipped[sender] = true
+			continue
+		}
+		receipt, err := env.ApplyTxn(i, nil)
+		if err != nil {
+			skipped[sender] = true
+			continue
+		}
+		nonces[sender] = nonce + 1
+		gasUsed += receipt.GasUsed
+		receipt.CumulativeGasUsed = gasUsed
+		receipt.TransactionIndex = uint(len(receipts))
+		receipt.BlockNumber = new(big.Int).SetUint64(uint64(yuBlock.Height))
+		included = append(included, stxn)
+		ethTxs = append(ethTxs, tx)
+		receipts = append(receipts, receipt)
+	}
+	yuBlock.Txns = included
+	yuBlock.LeiUsed = gasUsed
+	return ethTxs, receipts
+}
@@ -0,0 +1,219 @@
+package ethrpc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	yutypes "github.com/yu-org/yu/core/types"
+)
+
+// testPendingEnv executes every txn with the gas of a transfer, except the rejected ones.
+type testPendingEnv struct {
+	block  *yutypes.Block
+	state  *state.StateDB
+	reject map[common.Hash]bool
+}
+
+func (env *testPendingEnv) ApplyTxn(index int, hooks *tracing.Hooks) (*types.Receipt, error) {
+	hash := common.Hash(env.block.Txns[index].TxnHash)
+	if env.reject[hash] {
+		return nil, errors.New("rejected")
+	}
+	return &types.Receipt{TxHash: hash, GasUsed: params.TxGas}, nil
+}
+
+func (env *testPendingEnv) StateDB() *state.StateDB {
+	return env.state
+}
+
+// newTestPendingTxns signs the txns of the key with the nonces and the gas prices, in gwei.
+func newTestPendingTxns(t *testing.T, key *ecdsa.PrivateKey, txns ...[2]uint64) []*types.Transaction {
+	txs := make([]*types.Transaction, 0, len(txns))
+	for _, txn := range txns {
+		txs = append(txs, newTestEthTxn(t, key, txn[0], int64(txn[1])*params.GWei))
+	}
+	return txs
+}
+
+func TestOrderPendingTxns(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	// the senders of the same tip cap are ordered by their addresses.
+	if bytes.Compare(crypto.PubkeyToAddress(keys[1].PublicKey).Bytes(), crypto.PubkeyToAddress(keys[2].PublicKey).Bytes()) > 0 {
+		keys[1], keys[2] = keys[2], keys[1]
+	}
+	var txs []*types.Transaction
+	txs = append(txs, newTestPendingTxns(t, keys[2], [2]uint64{1, 1}, [2]uint64{0, 2})...)
+	txs = append(txs, newTestPendingTxns(t, keys[1], [2]uint64{0, 2})...)
+	txs = append(txs, newTestPendingTxns(t, keys[0], [2]uint64{1, 3}, [2]uint64{0, 3}, [2]uint64{1, 4})...)
+	expected := []*types.Transaction{txs[4], txs[5], txs[3], txs[2], txs[1], txs[0]}
+
+	signer := types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID)
+	for i := 0; i < 10; i++ {
+		stxns := make([]*yutypes.SignedTxn, 0, len(txs))
+		for _, j := range rand.Perm(len(txs)) {
+			stxns = append(stxns, newTestYuTxn(t, txs[j]))
+		}
+		ordered, ethTxs := orderPendingTxns(stxns, signer)
+		if len(ordered) != len(expected) || len(ethTxs) != len(expected) {
+			t.Fatalf("Expected %d txns, but got %d", len(expected), len(ordered))
+		}
+		for j, stxn := range ordered {
+			if ethTxs[stxn].Hash() != expected[j].Hash() {
+				t.Fatalf("Expected txn %d to be %s, but got %s", j, expected[j].Hash().Hex(), ethTxs[stxn].Hash().Hex())
+			}
+		}
+	}
+}
+
+func TestApplyPendingTxns(t *testing.T) {
+	aliceKey, _ := crypto.GenerateKey()
+	bobKey, _ := crypto.GenerateKey()
+	carolKey, _ := crypto.GenerateKey()
+	alice := crypto.PubkeyToAddress(aliceKey.PublicKey)
+	sdb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	sdb.SetNonce(alice, 1)
+
+	var txs []*types.Transaction
+	// the nonce 0 of alice is in the chain, the nonce 1 is replaced and the nonce 3 is missing.
+	txs = append(txs, newTestPendingTxns(t, aliceKey, [2]uint64{0, 3}, [2]uint64{1, 5}, [2]uint64{1, 3}, [2]uint64{2, 3}, [2]uint64{4, 3})...)
+	// the first txn of bob is rejected.
+	txs = append(txs, newTestPendingTxns(t, bobKey, [2]uint64{0, 2}, [2]uint64{1, 2})...)
+	// the txns of carol exceed the gas limit of the block.
+	txs = append(txs, newTestPendingTxns(t, carolKey, [2]uint64{0, 1})...)
+	stxns := make([]*yutypes.SignedTxn, 0, len(txs))
+	for _, tx := range txs {
+		stxns = append(stxns, newTestYuTxn(t, tx))
+	}
+
+	signer := types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID)
+	ordered, ethTxs := orderPendingTxns(stxns, signer)
+	yuBlock := &yutypes.Block{Header: &yutypes.Header{Height: 5, LeiLimit: 2*params.TxGas + 1}, Txns: ordered}
+	env := &testPendingEnv{block: yuBlock, state: sdb, reject: map[common.Hash]bool{txs[5].Hash(): true}}
+	included, receipts := applyPendingTxns(env, yuBlock, ethTxs, signer)
+
+	expected := []*types.Transaction{txs[1], txs[3]}
+	if len(included) != len(expected) || len(yuBlock.Txns) != len(expected) || len(receipts) != len(expected) {
+		t.Fatalf("Expected the txns of the nonces 1 and 2 of alice, but got %v", txnNonces(included))
+	}
+	for i, tx := range expected {
+		if included[i].Hash() != tx.Hash() || common.Hash(yuBlock.Txns[i].TxnHash) != tx.Hash() {
+			t.Fatalf("Expected txn %d to be %s, but got %s", i, tx.Hash().Hex(), included[i].Hash().Hex())
+		}
+		r := receipts[i]
+		if r.TxHash != tx.Hash() || r.TransactionIndex != uint(i) || r.CumulativeGasUsed != uint64(i+1)*params.TxGas || r.BlockNumber.Uint64() != 5 {
+			t.Fatalf("Expected the receipt %d of txn %s, but got %+v", i, tx.Hash().Hex(), r)
+		}
+	}
+	if yuBlock.LeiUsed != 2*params.TxGas {
+		t.Fatalf("Expected gas used %d, but got %d", 2*params.TxGas, yuBlock.LeiUsed)
+	}
+}
+
+// testPendingBuilder builds the pending blocks on top of head, and counts the builds.
+type testPendingBuilder struct {
+	mu     sync.Mutex
+	head   common.Hash
+	builds int
+}
+
+func (b *testPendingBuilder) build(prev *pendingBlock) (*pendingBlock, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.builds++
+	sdb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	return &pendingBlock{
+		block: types.NewBlockWithHeader(&types.Header{ParentHash: b.head, Number: big.NewInt(int64(b.builds))}),
+		state: sdb,
+	}, nil
+}
+
+func (b *testPendingBuilder) setHead(head common.Hash) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.head = head
+}
+
+func (b *testPendingBuilder) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.builds
+}
+
+// waitPending waits until the cache holds the pending block of the nth build.
+func waitPending(t *testing.T, c *pendingCache, n int64) {
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		p := c.pending
+		c.mu.Unlock()
+		if p != nil && p.block.Number().Int64() >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the pending block of build %d", n)
+		}
+	}
+}
+
+func TestPendingCache(t *testing.T) {
+	b := &testPendingBuilder{head: common.Hash{0x01}}
+	e := &EthAPIBackend{}
+	e.pendingCache.build = b.build
+
+	// the first pending block is built by the caller.
+	p, err := e.pendingCache.get(common.Hash{0x01})
+	if err != nil || b.count() != 1 {
+		t.Fatalf("Expected the pending block to be built once, but got %d builds, %v", b.count(), err)
+	}
+	// the cached block is served with a copy of its state.
+	p2, err := e.pendingCache.get(common.Hash{0x01})
+	if err != nil || b.count() != 1 || p2.block != p.block || p2.state == p.state {
+		t.Fatalf("Expected the cached pending block with a copy of its state, but got %d builds, %v", b.count(), err)
+	}
+	// the block which is not on top of the head is rebuilt.
+	b.setHead(common.Hash{0x02})
+	if p, err = e.pendingCache.get(common.Hash{0x02}); err != nil || p.block.ParentHash() != (common.Hash{0x02}) || b.count() != 2 {
+		t.Fatalf("Expected the pending block on top of the new head, but got %d builds, %v", b.count(), err)
+	}
+
+	e.startPendingLoop()
+	// the appended blocks rebuild the pending block at once.
+	b.setHead(common.Hash{0x03})
+	e.chainFeed.Send(core.ChainEvent{Hash: common.Hash{0x03}})
+	waitPending(t, &e.pendingCache, 3)
+	if p, err = e.pendingCache.get(common.Hash{0x03}); err != nil || p.block.ParentHash() != (common.Hash{0x03}) || b.count() != 3 {
+		t.Fatalf("Expected the pending block built in the background, but got %d builds, %v", b.count(), err)
+	}
+
+	// the changes of the txpool are batched.
+	start := time.Now()
+	key, _ := crypto.GenerateKey()
+	for i := 0; i < 3; i++ {
+		e.txsFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{newTestEthTxn(t, key, uint64(i), params.GWei)}})
+	}
+	e.droppedFeed.Send(DroppedTxEvent{Reason: DroppedReplaced})
+	waitPending(t, &e.pendingCache, 4)
+	if elapsed := time.Since(start); elapsed < pendingRecommit {
+		t.Fatalf("Expected the pending block to be rebuilt after %v, but got %v", pendingRecommit, elapsed)
+	}
+	time.Sleep(2 * pendingRecommit)
+	if b.count() != 4 {
+		t.Fatalf("Expected the changes to be batched into 1 build, but got %d", b.count()-3)
+	}
+}
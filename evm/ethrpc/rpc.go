@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
@@ -28,9 +29,10 @@ type EthRPC struct {
 	rpcServer *rpc.Server
 }
 
-func StartupEthRPC(chain *kernel.Kernel, cfg *evm.GethConfig) {
+// StartupEthRPC serves the eth RPC of the chain, syncMode is the sync mode of the kernel.
+func StartupEthRPC(chain *kernel.Kernel, cfg *evm.GethConfig, syncMode int) {
 	if cfg.EnableEthRPC {
-		rpcSrv, err := NewEthRPC(chain, cfg)
+		rpcSrv, err := NewEthRPC(chain, cfg, syncMode)
 		if err != nil {
 			logrus.Fatalf("init EthRPC server failed, %v", err)
 		}
@@ -45,7 +47,7 @@ func StartupEthRPC(chain *kernel.Kernel, cfg *evm.GethConfig) {
 	}
 }
 
-func NewEthRPC(chain *kernel.Kernel, cfg *evm.GethConfig) (*EthRPC, error) {
+func NewEthRPC(chain *kernel.Kernel, cfg *evm.GethConfig, syncMode int) (*EthRPC, error) {
 	s := &EthRPC{
 		chain:     chain,
 		cfg:       cfg,
@@ -56,8 +58,19 @@ func NewEthRPC(chain *kernel.Kernel, cfg *evm.GethConfig) (*EthRPC, error) {
 		allowUnprotectedTxs: true,
 		chain:               chain,
 		ethChainCfg:         cfg.ChainConfig,
+		cfg:                 cfg,
+		bloomRequests:       make(chan chan *bloombits.Retrieval),
 	}
-	backend.gasPriceCache = NewEthGasPrice(backend)
+	backend.gasPriceCache = NewEthGasPrice(backend, cfg.GasPriceCheckBlocks, cfg.GasPricePercentile)
+	backend.sync = newSyncTracker(chain, cfg.SyncUpstream, syncMode)
+	backend.startBloomHandlers(evm.BloomSectionSize)
+	solidity := chain.GetTripodInstance(SolidityTripod).(*evm.Solidity)
+	go backend.chainEventLoop(solidity)
+	if pool, ok := chain.Pool.(*evm.TxPool); ok {
+		backend.subscribeTxPool(pool)
+	}
+	backend.pendingCache.build = backend.buildLatestPending
+	backend.startPendingLoop()
 
 	apis := GetAPIs(backend)
 	for _, api := range apis {
@@ -67,8 +80,18 @@ func NewEthRPC(chain *kernel.Kernel, cfg *evm.GethConfig) (*EthRPC, error) {
 		}
 	}
 
+	gw, err := newGateway(&cfg.RPCGateway, apis)
+	if err != nil {
+		return nil, err
+	}
+	handler := chainMiddlewares(s.rpcServer, gw.Middleware, logRequestResponse)
+	if cfg.EnableEthWS {
+		handler = wsOrHTTPHandler(wsHandler(s.rpcServer, gw, cfg.WSOrigins), handler)
+	}
 	mux := http.NewServeMux()
-	mux.Handle("/", logRequestResponse(s.rpcServer))
+	mux.Handle("/", handler)
+	mux.Handle("/health", backend.sync.healthHandler(cfg.HealthMaxBlocksBehind, false))
+	mux.Handle("/ready", backend.sync.healthHandler(cfg.HealthMaxBlocksBehind, true))
 
 	s.srv = &http.Server{
 		Addr:        net.JoinHostPort(cfg.EthHost, cfg.EthPort),
@@ -99,6 +122,22 @@ func (s *EthRPC) Serve(ctx context.Context) error {
 	}
 }
 
+// wsOrHTTPHandler serves the websocket upgrade requests with ws, the others with next.
+func wsOrHTTPHandler(ws, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isWebsocket(r) {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isWebsocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
 func logRequestResponse(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//ip := getIP(r)
@@ -131,29 +170,3 @@ func (r *responseRecorder) Write(b []byte) (int, error) {
 	r.body.Write(b)
 	return r.ResponseWriter.Write(b)
 }
-
-func getIP(r *http.Request) string {
-	cfConnectingIP := r.Header.Get("CF-Connecting-IP")
-	if cfConnectingIP != "" {
-		return cfConnectingIP
-	}
-
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	xri := r.Header.Get("X-Real-Ip")
-	if xri != "" {
-		return xri
-	}
-
-	ip := r.RemoteAddr
-	if colon := strings.LastIndex(ip, ":"); colon != -1 {
-		ip = ip[:colon]
-	}
-	return ip
-}
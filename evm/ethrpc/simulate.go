@@ -0,0 +1,538 @@
+package ethrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip1559"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	yutypes "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+const (
+	// maxSimulateBlocks is the max number of blocks simulated by a single eth_simulateV1 call.
+	maxSimulateBlocks = 256
+	// simulateTimestampIncrement is the default increment of the timestamps of the simulated blocks.
+	simulateTimestampIncrement = 12
+)
+
+var (
+	// transferTopic is keccak256("Transfer(address,address,uint256)")
+	transferTopic = common.HexToHash("ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	// transferAddress is the address of the ETH transfer logs, see ERC-7528.
+	transferAddress = common.HexToAddress("0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE")
+)
+
+// SimBlock is a block of calls simulated by eth_simulateV1, on top of the state and block
+// overrides.
+type SimBlock struct {
+	BlockOverrides *BlockOverrides   `json:"blockOverrides"`
+	StateOverrides *StateOverride    `json:"stateOverrides"`
+	Calls          []TransactionArgs `json:"calls"`
+}
+
+// SimOpts are the inputs of eth_simulateV1.
+type SimOpts struct {
+	BlockStateCalls        []SimBlock `json:"blockStateCalls"`
+	TraceTransfers         bool       `json:"traceTransfers"`
+	Validation             bool       `json:"validation"`
+	ReturnFullTransactions bool       `json:"returnFullTransactions"`
+}
+
+// simCallResult is the result of a simulated call.
+type simCallResult struct {
+	ReturnValue hexutil.Bytes  `json:"returnData"`
+	Logs        []*types.Log   `json:"logs"`
+	GasUsed     hexutil.Uint64 `json:"gasUsed"`
+	Status      hexutil.Uint64 `json:"status"`
+	Error       *simCallError  `json:"error,omitempty"`
+}
+
+type simCallError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+	Data    string `json:"data,omitempty"`
+}
+
+// newSimCallResult converts the execution result of a call.
+func newSimCallResult(result *core.ExecutionResult, logs []*types.Log) *simCallResult {
+	callRes := &simCallResult{
+		ReturnValue: result.Return(),
+		Logs:        logs,
+		GasUsed:     hexutil.Uint64(result.UsedGas),
+		Status:      hexutil.Uint64(types.ReceiptStatusSuccessful),
+	}
+	if result.Failed() {
+		callRes.Status = hexutil.Uint64(types.ReceiptStatusFailed)
+		callRes.Logs = []*types.Log{}
+		if errors.Is(result.Err, vm.ErrExecutionReverted) {
+			revertErr := evm.NewRevertError(result.Revert())
+			callRes.Error = &simCallError{Message: revertErr.Error(), Code: revertErr.ErrorCode(), Data: revertErr.ErrorData().(string)}
+		} else {
+			callRes.Error = &simCallError{Message: result.Err.Error(), Code: -32015}
+		}
+	}
+	if callRes.Logs == nil {
+		callRes.Logs = []*types.Log{}
+	}
+	return callRes
+}
+
+// simTracer collects the logs of a simulated call, and the ETH transfers as logs if
+// traceTransfers is set. The logs of the reverted frames are dropped.
+type simTracer struct {
+	logs           [][]*types.Log
+	count          int
+	traceTransfers bool
+	blockNumber    uint64
+	txHash         common.Hash
+	txIdx          uint
+}
+
+func (t *simTracer) Hooks() *tracing.Hooks {
+	return &tracing.Hooks{
+		OnEnter: t.onEnter,
+		OnExit:  t.onExit,
+		OnLog:   t.onLog,
+	}
+}
+
+func (t *simTracer) onEnter(depth int, typ byte, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.logs = append(t.logs, make([]*types.Log, 0))
+	if t.traceTransfers && vm.OpCode(typ) != vm.DELEGATECALL && value != nil && value.Sign() > 0 {
+		topics := []common.Hash{transferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}
+		t.captureLog(transferAddress, topics, common.BigToHash(value).Bytes())
+	}
+}
+
+func (t *simTracer) onExit(depth int, output []byte, gasUsed uint64, err error, reverted bool) {
+	if depth == 0 {
+		if reverted {
+			t.logs[0] = nil
+		}
+		return
+	}
+	size := len(t.logs)
+	if size <= 1 {
+		return
+	}
+	// pop the logs of the call, they are kept by its caller unless it is reverted.
+	call := t.logs[size-1]
+	t.logs = t.logs[:size-1]
+	if !reverted {
+		t.logs[size-2] = append(t.logs[size-2], call...)
+	}
+}
+
+func (t *simTracer) onLog(log *types.Log) {
+	t.captureLog(log.Address, log.Topics, log.Data)
+}
+
+func (t *simTracer) captureLog(address common.Address, topics []common.Hash, data []byte) {
+	t.logs[len(t.logs)-1] = append(t.logs[len(t.logs)-1], &types.Log{
+		Address:     address,
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: t.blockNumber,
+		TxHash:      t.txHash,
+		TxIndex:     t.txIdx,
+		Index:       uint(t.count),
+	})
+	t.count++
+}
+
+func (t *simTracer) reset(txHash common.Hash, txIdx uint) {
+	t.logs = nil
+	t.txHash = txHash
+	t.txIdx = txIdx
+}
+
+func (t *simTracer) Logs() []*types.Log {
+	if len(t.logs) == 0 {
+		return nil
+	}
+	return t.logs[0]
+}
+
+// simulator executes the calls on a copy of the state, the state is not committed.
+type simulator struct {
+	b        Backend
+	state    *state.StateDB
+	base     *types.Header
+	chainCtx core.ChainContext
+	// headers are the simulated blocks before the current one.
+	headers        []*types.Header
+	gasRemaining   uint64
+	traceTransfers bool
+	validate       bool
+	fullTx         bool
+}
+
+// SimulateV1 executes series of calls in the simulated blocks on top of the given block.
+// The calls of a block see the state changes of the previous calls and blocks.
+func (s *BlockChainAPI) SimulateV1(ctx context.Context, opts SimOpts, blockNrOrHash *rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	if len(opts.BlockStateCalls) == 0 {
+		return nil, errors.New("empty input")
+	} else if len(opts.BlockStateCalls) > maxSimulateBlocks {
+		return nil, fmt.Errorf("too many blocks, want at most %d", maxSimulateBlocks)
+	}
+	if blockNrOrHash == nil {
+		n := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		blockNrOrHash = &n
+	}
+	statedb, base, err := s.b.StateAndHeaderByNumberOrHash(ctx, *blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	sim := &simulator{
+		b:              s.b,
+		state:          statedb,
+		base:           base,
+		chainCtx:       NewChainContext(ctx, s.b),
+		gasRemaining:   s.b.RPCGasCap(),
+		traceTransfers: opts.TraceTransfers,
+		validate:       opts.Validation,
+		fullTx:         opts.ReturnFullTransactions,
+	}
+	return sim.execute(ctx, opts.BlockStateCalls)
+}
+
+func (sim *simulator) execute(ctx context.Context, blocks []SimBlock) ([]map[string]interface{}, error) {
+	var (
+		results = make([]map[string]interface{}, len(blocks))
+		parent  = sim.base
+	)
+	for bi, block := range blocks {
+		header, err := sim.makeHeader(parent, block.BlockOverrides)
+		if err != nil {
+			return nil, err
+		}
+		if err = block.StateOverrides.Apply(sim.state); err != nil {
+			return nil, err
+		}
+		result, err := sim.processBlock(ctx, &block, header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", bi, err)
+		}
+		results[bi] = result
+		sim.headers = append(sim.headers, header)
+		parent = header
+	}
+	return results, nil
+}
+
+// makeHeader creates the header of the simulated block following parent, the number and
+// the timestamp increase by default and the overrides must not go backwards.
+func (sim *simulator) makeHeader(parent *types.Header, overrides *BlockOverrides) (*types.Header, error) {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  types.EmptyUncleHash,
+		Coinbase:   parent.Coinbase,
+		Difficulty: new(big.Int),
+		Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + simulateTimestampIncrement,
+	}
+	if overrides != nil {
+		if overrides.Number != nil {
+			if overrides.Number.ToInt().Cmp(parent.Number) <= 0 {
+				return nil, fmt.Errorf("block numbers must be in order: %d <= %d", overrides.Number.ToInt(), parent.Number)
+			}
+			header.Number = new(big.Int).Set(overrides.Number.ToInt())
+		}
+		if overrides.Time != nil {
+			if uint64(*overrides.Time) <= parent.Time {
+				return nil, fmt.Errorf("block timestamps must be in order: %d <= %d", *overrides.Time, parent.Time)
+			}
+			header.Time = uint64(*overrides.Time)
+		}
+		if overrides.GasLimit != nil {
+			header.GasLimit = uint64(*overrides.GasLimit)
+		}
+		if overrides.Coinbase != nil {
+			header.Coinbase = *overrides.Coinbase
+		}
+		if overrides.Difficulty != nil {
+			header.Difficulty = overrides.Difficulty.ToInt()
+		}
+		if overrides.Random != nil {
+			header.MixDigest = *overrides.Random
+		}
+		if overrides.BaseFee != nil {
+			header.BaseFee = overrides.BaseFee.ToInt()
+		}
+	}
+	if header.BaseFee == nil {
+		// the base fee is only charged in validation mode.
+		header.BaseFee = new(big.Int)
+		if sim.validate && parent.BaseFee != nil {
+			header.BaseFee = eip1559.CalcBaseFee(sim.b.ChainConfig(), parent)
+		}
+	}
+	return header, nil
+}
+
+// getHashFn resolves the hashes of the simulated blocks before the current one for BLOCKHASH,
+// and the hashes of the chain blocks up to the base block. The numbers skipped by the block
+// overrides have no block.
+func (sim *simulator) getHashFn() vm.GetHashFunc {
+	next := &types.Header{ParentHash: sim.base.Hash(), Number: new(big.Int).Add(sim.base.Number, big.NewInt(1))}
+	chainHash := core.GetHashFn(next, sim.chainCtx)
+	return func(n uint64) common.Hash {
+		if n <= sim.base.Number.Uint64() {
+			return chainHash(n)
+		}
+		for _, header := range sim.headers {
+			if header.Number.Uint64() == n {
+				return header.Hash()
+			}
+		}
+		return common.Hash{}
+	}
+}
+
+func (sim *simulator) processBlock(ctx context.Context, block *SimBlock, header *types.Header) (map[string]interface{}, error) {
+	blockCtx := core.NewEVMBlockContext(header, sim.chainCtx, &header.Coinbase)
+	block.BlockOverrides.Apply(&blockCtx)
+	blockCtx.GetHash = sim.getHashFn()
+
+	var (
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		gasUsed  uint64
+		txs      = make([]*types.Transaction, len(block.Calls))
+		senders  = make([]common.Address, len(block.Calls))
+		receipts = make([]*types.Receipt, len(block.Calls))
+		calls    = make([]*simCallResult, len(block.Calls))
+		tracer   = &simTracer{traceTransfers: sim.traceTransfers, blockNumber: header.Number.Uint64()}
+	)
+	for i := range block.Calls {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		args := &block.Calls[i]
+		tx, result, err := sim.applyCall(ctx, blockCtx, gp, args, tracer, i)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		gasUsed += result.UsedGas
+		txs[i], senders[i] = tx, args.from()
+		calls[i] = newSimCallResult(result, tracer.Logs())
+		receipt := &types.Receipt{
+			Type:              tx.Type(),
+			CumulativeGasUsed: gasUsed,
+			TxHash:            tx.Hash(),
+			GasUsed:           result.UsedGas,
+			Logs:              calls[i].Logs,
+			TransactionIndex:  uint(i),
+			Status:            uint64(calls[i].Status),
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipts[i] = receipt
+	}
+
+	header.GasUsed = gasUsed
+	header.Root = sim.state.IntermediateRoot(sim.b.ChainConfig().IsEIP158(header.Number))
+	header.TxHash = types.DeriveSha(types.Transactions(txs), trie.NewStackTrie(nil))
+	header.ReceiptHash = types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil))
+	header.Bloom = types.CreateBloom(receipts)
+	blockHash := header.Hash()
+	for _, call := range calls {
+		for _, log := range call.Logs {
+			log.BlockHash = blockHash
+		}
+	}
+
+	fields := RPCMarshalHeader(header)
+	if sim.fullTx {
+		rpcTxs := make([]*RPCTransaction, len(txs))
+		for i, tx := range txs {
+			rpcTxs[i] = newRPCTransaction(tx, blockHash, header.Number.Uint64(), header.Time, uint64(i), header.BaseFee, sim.b.ChainConfig())
+			// the simulated txns are not signed.
+			rpcTxs[i].From = senders[i]
+		}
+		fields["transactions"] = rpcTxs
+	} else {
+		hashes := make([]common.Hash, len(txs))
+		for i, tx := range txs {
+			hashes[i] = tx.Hash()
+		}
+		fields["transactions"] = hashes
+	}
+	fields["calls"] = calls
+	return fields, nil
+}
+
+// applyCall executes the call at index of the block on the state. The nonce of the sender
+// is checked and the fees are charged only in validation mode.
+func (sim *simulator) applyCall(ctx context.Context, blockCtx vm.BlockContext, gp *core.GasPool, args *TransactionArgs, tracer *simTracer, index int) (*types.Transaction, *core.ExecutionResult, error) {
+	if args.Nonce == nil {
+		nonce := hexutil.Uint64(sim.state.GetNonce(args.from()))
+		args.Nonce = &nonce
+	}
+	if args.Gas == nil {
+		gas := hexutil.Uint64(min(gp.Gas(), sim.gasRemaining))
+		args.Gas = &gas
+	}
+	if sim.gasRemaining > 0 && uint64(*args.Gas) > sim.gasRemaining {
+		return nil, nil, fmt.Errorf("gas limit %d exceeds the remaining gas cap %d of the simulation", *args.Gas, sim.gasRemaining)
+	}
+	if err := args.CallDefaults(0, blockCtx.BaseFee, sim.b.ChainConfig().ChainID); err != nil {
+		return nil, nil, err
+	}
+	tx := args.ToTransaction(nil, nil, nil)
+	msg := args.ToMessage(blockCtx.BaseFee)
+	msg.Nonce = uint64(*args.Nonce)
+	msg.SkipAccountChecks = !sim.validate
+
+	tracer.reset(tx.Hash(), uint(index))
+	hooks := tracer.Hooks()
+	sim.state.SetTxContext(tx.Hash(), index)
+	sim.state.SetLogger(hooks)
+	defer sim.state.SetLogger(nil)
+	evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), sim.state, sim.b.ChainConfig(), vm.Config{Tracer: hooks, NoBaseFee: !sim.validate})
+
+	// Cancel the execution once the timeout of the calls is exceeded.
+	callCtx, cancel := context.WithTimeout(ctx, sim.b.RPCEVMTimeout())
+	defer cancel()
+	go func() {
+		<-callCtx.Done()
+		evm.Cancel()
+	}()
+	result, err := core.ApplyMessage(evm, msg, gp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if evm.Cancelled() {
+		return nil, nil, fmt.Errorf("execution aborted (timeout = %v)", sim.b.RPCEVMTimeout())
+	}
+	sim.state.Finalise(true)
+	if sim.gasRemaining > 0 {
+		sim.gasRemaining -= result.UsedGas
+	}
+	return tx, result, nil
+}
+
+// Bundle is a list of calls executed by eth_callMany in the same block context.
+type Bundle struct {
+	Transactions  []TransactionArgs `json:"transactions"`
+	BlockOverride *BlockOverrides   `json:"blockOverride"`
+}
+
+// StateContext is the state eth_callMany executes the bundles on: the state of the block
+// after its txns before TransactionIndex, -1 means all of them.
+type StateContext struct {
+	BlockNumber      rpc.BlockNumberOrHash `json:"blockNumber"`
+	TransactionIndex *int                  `json:"transactionIndex"`
+}
+
+// CallMany executes the bundles of calls one after the other on the given state, the
+// calls see the state changes of the previous calls. It returns the return data or the
+// error of each call.
+func (s *BlockChainAPI) CallMany(ctx context.Context, bundles []Bundle, simulateContext StateContext, overrides *StateOverride) ([][]map[string]interface{}, error) {
+	if len(bundles) == 0 {
+		return nil, errors.New("empty input")
+	}
+	statedb, header, err := s.callManyState(ctx, simulateContext)
+	if err != nil {
+		return nil, err
+	}
+	if err = overrides.Apply(statedb); err != nil {
+		return nil, err
+	}
+	sim := &simulator{
+		b:            s.b,
+		state:        statedb,
+		base:         header,
+		chainCtx:     NewChainContext(ctx, s.b),
+		gasRemaining: s.b.RPCGasCap(),
+	}
+	results := make([][]map[string]interface{}, len(bundles))
+	for bi, bundle := range bundles {
+		blockCtx := core.NewEVMBlockContext(header, sim.chainCtx, nil)
+		bundle.BlockOverride.Apply(&blockCtx)
+		tracer := &simTracer{blockNumber: blockCtx.BlockNumber.Uint64()}
+		results[bi] = make([]map[string]interface{}, len(bundle.Transactions))
+		for i := range bundle.Transactions {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			gp := new(core.GasPool).AddGas(math.MaxUint64)
+			_, result, err := sim.applyCall(ctx, blockCtx, gp, &bundle.Transactions[i], tracer, i)
+			if err != nil {
+				results[bi][i] = map[string]interface{}{"error": err.Error()}
+				continue
+			}
+			if result.Failed() {
+				if errors.Is(result.Err, vm.ErrExecutionReverted) {
+					results[bi][i] = map[string]interface{}{"error": evm.NewRevertError(result.Revert()).Error()}
+				} else {
+					results[bi][i] = map[string]interface{}{"error": result.Err.Error()}
+				}
+				continue
+			}
+			results[bi][i] = map[string]interface{}{"value": hexutil.Bytes(result.Return())}
+		}
+	}
+	return results, nil
+}
+
+// callManyState opens the state of the block of the context, the txns of the block at and
+// after TransactionIndex are undone by re-executing the ones before it on the state of the
+// parent, in the block order.
+func (s *BlockChainAPI) callManyState(ctx context.Context, simulateContext StateContext) (*state.StateDB, *types.Header, error) {
+	if simulateContext.TransactionIndex == nil || *simulateContext.TransactionIndex < 0 {
+		statedb, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, simulateContext.BlockNumber)
+		if statedb == nil || err != nil {
+			return nil, nil, err
+		}
+		return statedb, header, nil
+	}
+	ethBlock, block, err := s.b.BlockByNumberOrHash(ctx, simulateContext.BlockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, errors.New("block not found")
+	}
+	index := *simulateContext.TransactionIndex
+	if index >= len(block.Txns) {
+		statedb, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, simulateContext.BlockNumber)
+		if statedb == nil || err != nil {
+			return nil, nil, err
+		}
+		return statedb, header, nil
+	}
+	env, err := s.b.NewTraceEnv(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = applyBlockPrefix(ctx, env, block, index); err != nil {
+		return nil, nil, err
+	}
+	return env.StateDB(), ethBlock.Header(), nil
+}
+
+// applyBlockPrefix applies the txns of the block before index on the state of env.
+func applyBlockPrefix(ctx context.Context, env *evm.TraceEnv, block *yutypes.Block, index int) error {
+	for i := 0; i < index && i < len(block.Txns); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// the txns rejected before their execution do not touch the state.
+		_, _ = env.ApplyTxn(i, nil)
+	}
+	return nil
+}
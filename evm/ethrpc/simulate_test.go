@@ -0,0 +1,278 @@
+package ethrpc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holiman/uint256"
+	yucommon "github.com/yu-org/yu/common"
+	yutypes "github.com/yu-org/yu/core/types"
+)
+
+const testSimHead = 10
+
+var (
+	testSimSender   = common.HexToAddress("0x0a")
+	testSimReceiver = common.HexToAddress("0x0b")
+)
+
+// testSimBackend serves the chain of the blocks up to testSimHead, the simulations run on
+// a copy of the state of the head.
+type testSimBackend struct {
+	Backend
+	headers []*types.Header
+	state   *state.StateDB
+}
+
+func newTestSimBackend() *testSimBackend {
+	b := &testSimBackend{}
+	parent := common.Hash{}
+	for i := int64(0); i <= testSimHead; i++ {
+		header := &types.Header{
+			ParentHash: parent,
+			Number:     big.NewInt(i),
+			GasLimit:   30000000,
+			Time:       uint64(100 + i),
+			Difficulty: new(big.Int),
+			BaseFee:    big.NewInt(params.GWei),
+		}
+		b.headers = append(b.headers, header)
+		parent = header.Hash()
+	}
+	b.state, _ = state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	b.state.AddBalance(testSimSender, uint256.NewInt(params.Ether), 0)
+	return b
+}
+
+func (b *testSimBackend) ChainConfig() *params.ChainConfig {
+	return params.AllEthashProtocolChanges
+}
+
+func (b *testSimBackend) RPCGasCap() uint64 {
+	return 50000000
+}
+
+func (b *testSimBackend) RPCEVMTimeout() time.Duration {
+	return 5 * time.Second
+}
+
+func (b *testSimBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, *yutypes.Header, error) {
+	if number == rpc.LatestBlockNumber {
+		number = testSimHead
+	}
+	if number < 0 || int(number) >= len(b.headers) {
+		return nil, nil, errors.New("header not found")
+	}
+	header := b.headers[number]
+	return header, &yutypes.Header{Height: yucommon.BlockNum(number), Hash: yucommon.Hash(header.Hash())}, nil
+}
+
+func (b *testSimBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	return b.state.Copy(), b.headers[testSimHead], nil
+}
+
+// testSimCode assembles the opcodes and the pushed data of a contract.
+func testSimCode(ops ...any) hexutil.Bytes {
+	var code []byte
+	for _, op := range ops {
+		switch op := op.(type) {
+		case vm.OpCode:
+			code = append(code, byte(op))
+		case common.Address:
+			code = append(append(code, byte(vm.PUSH20)), op.Bytes()...)
+		case int:
+			code = append(code, byte(vm.PUSH1), byte(op))
+		}
+	}
+	return code
+}
+
+// testSimReturnWord returns the word on the top of the stack.
+var testSimReturnWord = []any{0, vm.MSTORE, 32, 0, vm.RETURN}
+
+func testSimCall(from common.Address, to common.Address, value int64, input []byte) TransactionArgs {
+	args := TransactionArgs{From: &from, To: &to, Value: (*hexutil.Big)(big.NewInt(value))}
+	if input != nil {
+		args.Input = (*hexutil.Bytes)(&input)
+	}
+	return args
+}
+
+func testSimCalls(t *testing.T, result map[string]interface{}) []*simCallResult {
+	calls, ok := result["calls"].([]*simCallResult)
+	if !ok {
+		t.Fatalf("Expected the calls of the block, but got %v", result)
+	}
+	for i, call := range calls {
+		if call.Error != nil {
+			t.Fatalf("Expected call %d to succeed, but got %+v", i, call.Error)
+		}
+	}
+	return calls
+}
+
+func TestSimulateMultiBlock(t *testing.T) {
+	var (
+		balanceOf = common.HexToAddress("0x1001")
+		blockHash = common.HexToAddress("0x1002")
+	)
+	b := newTestSimBackend()
+	api := NewBlockChainAPI(b)
+	results, err := api.SimulateV1(context.Background(), SimOpts{BlockStateCalls: []SimBlock{
+		{
+			StateOverrides: &StateOverride{
+				balanceOf: {Code: ptr(testSimCode(append([]any{testSimReceiver, vm.BALANCE}, testSimReturnWord...)...))},
+				blockHash: {Code: ptr(testSimCode(append([]any{0, vm.CALLDATALOAD, vm.BLOCKHASH}, testSimReturnWord...)...))},
+			},
+			Calls: []TransactionArgs{testSimCall(testSimSender, testSimReceiver, 1000, nil)},
+		},
+		{
+			Calls: []TransactionArgs{
+				// the state of the previous block is carried over.
+				testSimCall(testSimSender, balanceOf, 0, nil),
+				testSimCall(testSimSender, testSimReceiver, 1000, nil),
+				testSimCall(testSimSender, balanceOf, 0, nil),
+				// the hashes of the simulated blocks and of the chain blocks are both resolved.
+				testSimCall(testSimSender, blockHash, 0, common.BigToHash(big.NewInt(testSimHead+1)).Bytes()),
+				testSimCall(testSimSender, blockHash, 0, common.BigToHash(big.NewInt(testSimHead)).Bytes()),
+				testSimCall(testSimSender, blockHash, 0, common.BigToHash(big.NewInt(testSimHead-1)).Bytes()),
+			},
+		},
+	}}, nil)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Expected the results of 2 blocks, but got %v, %v", results, err)
+	}
+	testSimCalls(t, results[0])
+	calls := testSimCalls(t, results[1])
+	for i, expected := range map[int]common.Hash{
+		0: common.BigToHash(big.NewInt(1000)),
+		2: common.BigToHash(big.NewInt(2000)),
+		3: results[0]["hash"].(common.Hash),
+		4: b.headers[testSimHead].Hash(),
+		5: b.headers[testSimHead-1].Hash(),
+	} {
+		if got := common.BytesToHash(calls[i].ReturnValue); got != expected {
+			t.Fatalf("Expected call %d to return %s, but got %s", i, expected.Hex(), got.Hex())
+		}
+	}
+	if results[1]["parentHash"] != results[0]["hash"] {
+		t.Fatalf("Expected the second block to follow the first one, but got parent %v", results[1]["parentHash"])
+	}
+	if results[1]["number"].(*hexutil.Big).ToInt().Int64() != testSimHead+2 {
+		t.Fatalf("Expected the number of the second block to be %d, but got %v", testSimHead+2, results[1]["number"])
+	}
+	// the state of the chain is not changed.
+	if balance := b.state.GetBalance(testSimReceiver); !balance.IsZero() {
+		t.Fatalf("Expected the state not to be changed, but got balance %v", balance)
+	}
+}
+
+func TestSimulateValidation(t *testing.T) {
+	api := NewBlockChainAPI(newTestSimBackend())
+	simulate := func(validation bool, call TransactionArgs) error {
+		_, err := api.SimulateV1(context.Background(), SimOpts{
+			Validation:      validation,
+			BlockStateCalls: []SimBlock{{Calls: []TransactionArgs{call}}},
+		}, nil)
+		return err
+	}
+
+	call := testSimCall(testSimSender, testSimReceiver, 1000, nil)
+	call.MaxFeePerGas = (*hexutil.Big)(big.NewInt(params.GWei))
+	call.Nonce = ptr(hexutil.Uint64(5))
+	if err := simulate(false, call); err != nil {
+		t.Fatalf("Expected the nonce not to be checked without validation, but got %v", err)
+	}
+	if err := simulate(true, call); !errors.Is(err, core.ErrNonceTooHigh) {
+		t.Fatalf("Expected %v, but got %v", core.ErrNonceTooHigh, err)
+	}
+
+	// the base fee of the simulated block follows the one of the head.
+	call = testSimCall(testSimSender, testSimReceiver, 1000, nil)
+	call.MaxFeePerGas = (*hexutil.Big)(big.NewInt(params.GWei / 2))
+	if err := simulate(false, call); err != nil {
+		t.Fatalf("Expected the base fee not to be charged without validation, but got %v", err)
+	}
+	if err := simulate(true, call); !errors.Is(err, core.ErrFeeCapTooLow) {
+		t.Fatalf("Expected %v, but got %v", core.ErrFeeCapTooLow, err)
+	}
+	call.MaxFeePerGas = (*hexutil.Big)(big.NewInt(params.GWei))
+	if err := simulate(true, call); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+}
+
+func TestSimulateLogs(t *testing.T) {
+	var (
+		caller   = common.HexToAddress("0x1001")
+		reverter = common.HexToAddress("0x1002")
+		topic    = common.BigToHash(big.NewInt(1))
+	)
+	b := newTestSimBackend()
+	api := NewBlockChainAPI(b)
+	callerBalance := (*hexutil.Big)(big.NewInt(10))
+	results, err := api.SimulateV1(context.Background(), SimOpts{
+		TraceTransfers: true,
+		BlockStateCalls: []SimBlock{{
+			StateOverrides: &StateOverride{
+				// the caller sends 1 wei to the reverter, then logs the topic.
+				caller: {
+					Code: ptr(testSimCode(0, 0, 0, 0, 1, reverter, vm.GAS, vm.CALL, vm.POP,
+						1, 0, 0, vm.LOG1, vm.STOP)),
+					Balance: ptr(callerBalance),
+				},
+				// the reverter logs, then reverts.
+				reverter: {Code: ptr(testSimCode(0, 0, vm.LOG0, 0, 0, vm.REVERT))},
+			},
+			Calls: []TransactionArgs{
+				testSimCall(testSimSender, testSimReceiver, 1000, nil),
+				testSimCall(testSimSender, caller, 0, nil),
+				testSimCall(testSimSender, reverter, 0, nil),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	calls := results[0]["calls"].([]*simCallResult)
+
+	// the transfers are traced as the logs of ERC-7528.
+	logs := calls[0].Logs
+	if len(logs) != 1 || logs[0].Address != transferAddress || len(logs[0].Topics) != 3 ||
+		logs[0].Topics[0] != transferTopic || logs[0].Topics[1] != common.BytesToHash(testSimSender.Bytes()) ||
+		logs[0].Topics[2] != common.BytesToHash(testSimReceiver.Bytes()) || new(big.Int).SetBytes(logs[0].Data).Int64() != 1000 {
+		t.Fatalf("Expected the transfer log of 1000 wei, but got %v", logs)
+	}
+	if logs[0].BlockHash != results[0]["hash"].(common.Hash) || logs[0].TxIndex != 0 {
+		t.Fatalf("Expected the log of the first txn of the block, but got %+v", logs[0])
+	}
+
+	// the logs and the transfer of the reverted frame are dropped.
+	logs = calls[1].Logs
+	if calls[1].Error != nil || len(logs) != 1 || logs[0].Address != caller || logs[0].Topics[0] != topic || logs[0].TxIndex != 1 {
+		t.Fatalf("Expected the log of the caller only, but got %v", logs)
+	}
+	if calls[2].Error == nil || calls[2].Status != hexutil.Uint64(types.ReceiptStatusFailed) || len(calls[2].Logs) != 0 {
+		t.Fatalf("Expected the reverted call without logs, but got %+v", calls[2])
+	}
+	if !strings.Contains(calls[2].Error.Message, vm.ErrExecutionReverted.Error()) {
+		t.Fatalf("Expected the revert error, but got %q", calls[2].Error.Message)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
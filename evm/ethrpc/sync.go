@@ -0,0 +1,194 @@
+package ethrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+	"github.com/yu-org/yu/apps/synchronizer"
+	"github.com/yu-org/yu/core/kernel"
+)
+
+const (
+	synchronizerTripod = "synchronizer"
+
+	// syncPollInterval is how often the head of the network is polled.
+	syncPollInterval = 3 * time.Second
+	syncPollTimeout  = 5 * time.Second
+)
+
+var errHeadUnknown = errors.New("the head of the network is unknown")
+
+// syncTracker follows the sync progress of the node. The current block is the end block of
+// the local chain, it grows while the yu synchronizer imports the history blocks and then
+// while the node follows the blocks of the validators. The highest block is the head of
+// the network: the head of the upstream node, e.g. the sequencer, if it is configured,
+// otherwise the head of the boot node the synchronizer syncs the history from in the full
+// sync mode. It is the local head if the node has neither, e.g. it is the first validator.
+type syncTracker struct {
+	chain *kernel.Kernel
+	// pollHead returns the head of the network, it is nil if the local head is the head.
+	pollHead func(ctx context.Context) (uint64, error)
+	// starting is the end block of the local chain when the tracker is created, before the
+	// history is synced.
+	starting uint64
+
+	mu      sync.RWMutex
+	highest uint64
+	headErr error
+}
+
+func newSyncTracker(chain *kernel.Kernel, upstream string, syncMode int) *syncTracker {
+	t := &syncTracker{chain: chain}
+	if block, err := chain.Chain.GetEndCompactBlock(); err == nil {
+		t.starting = uint64(block.Height)
+	}
+	switch {
+	case upstream != "":
+		t.pollHead = (&upstreamPoller{url: upstream}).head
+	case syncMode == synchronizer.FullSync && len(chain.P2pNetwork.GetBootNodes()) > 0:
+		t.pollHead = t.bootNodeHead
+	}
+	if t.pollHead != nil {
+		t.headErr = errHeadUnknown
+		go t.pollLoop()
+	}
+	return t
+}
+
+// pollLoop polls the head of the network every syncPollInterval.
+func (t *syncTracker) pollLoop() {
+	ticker := time.NewTicker(syncPollInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), syncPollTimeout)
+		head, err := t.pollHead(ctx)
+		cancel()
+		if err != nil {
+			logrus.Warnf("poll the head of the network failed: %v", err)
+		}
+		t.mu.Lock()
+		if err == nil {
+			t.highest = head
+		}
+		t.headErr = err
+		t.mu.Unlock()
+	}
+}
+
+// upstreamPoller polls the head of the upstream node with `eth_blockNumber`, the node
+// is dialed again on the next poll if the dial or the call fails.
+type upstreamPoller struct {
+	url    string
+	client *rpc.Client
+}
+
+func (p *upstreamPoller) head(ctx context.Context) (uint64, error) {
+	if p.client == nil {
+		client, err := rpc.DialContext(ctx, p.url)
+		if err != nil {
+			return 0, fmt.Errorf("dial the sync upstream %s: %v", p.url, err)
+		}
+		p.client = client
+	}
+	var head hexutil.Uint64
+	if err := p.client.CallContext(ctx, &head, "eth_blockNumber"); err != nil {
+		p.client.Close()
+		p.client = nil
+		return 0, err
+	}
+	return uint64(head), nil
+}
+
+// bootNodeHead asks the boot node for its head with the handshake of the synchronizer,
+// which answers the range of blocks the node misses.
+func (t *syncTracker) bootNodeHead(context.Context) (uint64, error) {
+	syncTri, ok := t.chain.GetTripodInstance(synchronizerTripod).(*synchronizer.Synchronizer)
+	if !ok {
+		return 0, errors.New("the synchronizer tripod is not found")
+	}
+	req, err := syncTri.NewHsReq(nil)
+	if err != nil {
+		return 0, err
+	}
+	byt, err := req.Encode()
+	if err != nil {
+		return 0, err
+	}
+	respByt, err := t.chain.P2pNetwork.RequestPeer(t.chain.P2pNetwork.GetBootNodes()[0], synchronizer.HandshakeCode, byt)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := synchronizer.DecodeHsResp(respByt)
+	if err != nil {
+		return 0, err
+	}
+	if resp.MissingRange == nil {
+		return uint64(req.Info.EndHeight), nil
+	}
+	return uint64(resp.MissingRange.EndHeight), nil
+}
+
+// progress returns the starting, the current and the highest block.
+func (t *syncTracker) progress() (starting, current, highest uint64, err error) {
+	block, err := t.chain.Chain.GetEndCompactBlock()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	current = uint64(block.Height)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.starting, current, max(t.highest, current), nil
+}
+
+// headError returns the error of the last poll of the head of the network.
+func (t *syncTracker) headError() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.headErr
+}
+
+// healthStatus is the body of the `/health` and `/ready` responses.
+type healthStatus struct {
+	CurrentBlock hexutil.Uint64 `json:"currentBlock"`
+	HighestBlock hexutil.Uint64 `json:"highestBlock"`
+	BlocksBehind uint64         `json:"blocksBehind"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// healthHandler answers 503 while the node is behind the highest block by more than
+// maxBehind blocks. If headRequired, it also answers 503 while the head of the network
+// is unknown, as the node can not tell whether it caught up.
+func (t *syncTracker) healthHandler(maxBehind uint64, headRequired bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, current, highest, err := t.progress()
+		if err == nil && headRequired && t.pollHead != nil {
+			err = t.headError()
+		}
+		status := healthStatus{
+			CurrentBlock: hexutil.Uint64(current),
+			HighestBlock: hexutil.Uint64(highest),
+			BlocksBehind: highest - current,
+		}
+		code := http.StatusOK
+		switch {
+		case err != nil:
+			status.Error = err.Error()
+			code = http.StatusServiceUnavailable
+		case status.BlocksBehind > maxBehind:
+			status.Error = "the node is behind"
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(status)
+	}
+}
@@ -0,0 +1,112 @@
+package ethrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	yucommon "github.com/yu-org/yu/common"
+	"github.com/yu-org/yu/core/env"
+	"github.com/yu-org/yu/core/kernel"
+	yutypes "github.com/yu-org/yu/core/types"
+)
+
+// testSyncChain is the local chain whose end block is at height, or fails with err.
+type testSyncChain struct {
+	yutypes.IBlockChain
+	height uint64
+	err    error
+}
+
+func (c *testSyncChain) GetEndCompactBlock() (*yutypes.CompactBlock, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &yutypes.CompactBlock{Header: &yutypes.Header{Height: yucommon.BlockNum(c.height)}}, nil
+}
+
+func checkHealth(t *testing.T, h http.HandlerFunc, code int, behind uint64) {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	status := new(healthStatus)
+	if err := json.Unmarshal(w.Body.Bytes(), status); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if w.Code != code || status.BlocksBehind != behind {
+		t.Fatalf("Expected status %d with %d blocks behind, but got %d, %+v", code, behind, w.Code, status)
+	}
+	if (code == http.StatusOK) != (status.Error == "") {
+		t.Fatalf("Expected the error only with status 503, but got %d, %q", w.Code, status.Error)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	chain := &testSyncChain{height: 10}
+	tracker := &syncTracker{chain: &kernel.Kernel{ChainEnv: &env.ChainEnv{Chain: chain}}}
+	// the node without the head of the network is the head.
+	checkHealth(t, tracker.healthHandler(0, false), http.StatusOK, 0)
+	checkHealth(t, tracker.healthHandler(0, true), http.StatusOK, 0)
+
+	tracker.pollHead = func(context.Context) (uint64, error) { return 0, nil }
+	tracker.highest = 20
+	checkHealth(t, tracker.healthHandler(5, false), http.StatusServiceUnavailable, 10)
+	checkHealth(t, tracker.healthHandler(10, true), http.StatusOK, 10)
+
+	// the node is not ready while the head of the network is unknown, but it is healthy.
+	tracker.headErr = errHeadUnknown
+	checkHealth(t, tracker.healthHandler(10, false), http.StatusOK, 10)
+	checkHealth(t, tracker.healthHandler(10, true), http.StatusServiceUnavailable, 10)
+
+	// the highest block is at least the current one.
+	tracker.headErr = nil
+	chain.height = 30
+	checkHealth(t, tracker.healthHandler(0, true), http.StatusOK, 0)
+
+	chain.err = errors.New("no end block")
+	checkHealth(t, tracker.healthHandler(10, false), http.StatusServiceUnavailable, 0)
+}
+
+type testUpstreamService struct {
+	head uint64
+	fail atomic.Bool
+}
+
+func (s *testUpstreamService) BlockNumber() (hexutil.Uint64, error) {
+	if s.fail.Load() {
+		return 0, errors.New("upstream failed")
+	}
+	return hexutil.Uint64(s.head), nil
+}
+
+func TestUpstreamPoller(t *testing.T) {
+	service := &testUpstreamService{head: 42}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", service); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	defer srv.Stop()
+
+	p := &upstreamPoller{url: ts.URL}
+	if head, err := p.head(context.Background()); err != nil || head != 42 {
+		t.Fatalf("Expected head 42, but got %d, %v", head, err)
+	}
+	client := p.client
+	service.fail.Store(true)
+	if _, err := p.head(context.Background()); err == nil || p.client != nil {
+		t.Fatalf("Expected the failed call to reset the client, but got %v", err)
+	}
+	// the upstream is dialed again on the next poll.
+	service.fail.Store(false)
+	service.head = 43
+	if head, err := p.head(context.Background()); err != nil || head != 43 || p.client == nil || p.client == client {
+		t.Fatalf("Expected head 43 from a new client, but got %d, %v", head, err)
+	}
+}
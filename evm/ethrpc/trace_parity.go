@@ -0,0 +1,345 @@
+package ethrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	yutypes "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+var errBlockNotFound = errors.New("block not found")
+
+// parityTrace is a frame of the flat call traces produced by the flatCallTracer.
+type parityTrace struct {
+	Action              *parityAction   `json:"action"`
+	BlockHash           *common.Hash    `json:"blockHash,omitempty"`
+	BlockNumber         *uint64         `json:"blockNumber,omitempty"`
+	Error               string          `json:"error,omitempty"`
+	Result              *parityResult   `json:"result,omitempty"`
+	Subtraces           int             `json:"subtraces"`
+	TraceAddress        []int           `json:"traceAddress"`
+	TransactionHash     *common.Hash    `json:"transactionHash,omitempty"`
+	TransactionPosition *uint64         `json:"transactionPosition,omitempty"`
+	Type                string          `json:"type"`
+	raw                 json.RawMessage // the frame as it is produced by the tracer
+}
+
+type parityAction struct {
+	From          *common.Address `json:"from,omitempty"`
+	To            *common.Address `json:"to,omitempty"`
+	Address       *common.Address `json:"address,omitempty"`
+	RefundAddress *common.Address `json:"refundAddress,omitempty"`
+}
+
+type parityResult struct {
+	Address *common.Address `json:"address,omitempty"`
+	Output  hexutil.Bytes   `json:"output,omitempty"`
+}
+
+func (t *parityTrace) UnmarshalJSON(input []byte) error {
+	type frame parityTrace
+	var dec frame
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*t = parityTrace(dec)
+	t.raw = append(json.RawMessage(nil), input...)
+	return nil
+}
+
+func (t *parityTrace) MarshalJSON() ([]byte, error) {
+	return t.raw, nil
+}
+
+// matches reports whether the frame is sent from one of the from addresses and
+// to one of the to addresses, an empty list matches any address.
+func (t *parityTrace) matches(from, to []common.Address) bool {
+	if t.Action == nil {
+		return len(from) == 0 && len(to) == 0
+	}
+	sender := t.Action.From
+	if sender == nil {
+		sender = t.Action.Address // selfdestruct
+	}
+	receiver := t.Action.To
+	if receiver == nil && t.Result != nil {
+		receiver = t.Result.Address // create
+	}
+	if receiver == nil {
+		receiver = t.Action.RefundAddress // selfdestruct
+	}
+	return includesAddress(from, sender) && includesAddress(to, receiver)
+}
+
+func includesAddress(addresses []common.Address, addr *common.Address) bool {
+	if len(addresses) == 0 {
+		return true
+	}
+	if addr == nil {
+		return false
+	}
+	for _, a := range addresses {
+		if a == *addr {
+			return true
+		}
+	}
+	return false
+}
+
+// TraceFilterArgs are the criteria of `trace_filter`.
+type TraceFilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"`
+	Count       *uint64          `json:"count"`
+}
+
+// traceReplayResult is the result of a txn replayed by `trace_replayBlockTransactions`.
+type traceReplayResult struct {
+	Output          hexutil.Bytes  `json:"output"`
+	StateDiff       interface{}    `json:"stateDiff"`
+	Trace           []*parityTrace `json:"trace"`
+	TransactionHash common.Hash    `json:"transactionHash"`
+	VmTrace         interface{}    `json:"vmTrace"`
+}
+
+// TraceAPI offers the parity style `trace_*` RPC methods. The flat call traces are read
+// from the db if they were recorded when the block was executed, the block is re-executed
+// on the state of its parent otherwise.
+type TraceAPI struct {
+	b Backend
+}
+
+// NewTraceAPI creates a new instance of TraceAPI.
+func NewTraceAPI(b Backend) *TraceAPI {
+	return &TraceAPI{b: b}
+}
+
+// Block returns the flat call traces of all the txns of the block.
+func (api *TraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*parityTrace, error) {
+	_, block, err := api.b.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	traces, err := api.blockTraces(ctx, block, -1)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*parityTrace, 0)
+	for _, txTraces := range traces {
+		results = append(results, txTraces...)
+	}
+	return results, nil
+}
+
+// Transaction returns the flat call traces of the txn.
+func (api *TraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*parityTrace, error) {
+	found, _, blockHash, _, _, err := api.b.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errTxNotFound
+	}
+	_, block, err := api.b.BlockByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	for i, stxn := range block.Txns {
+		if common.Hash(stxn.TxnHash) != hash {
+			continue
+		}
+		traces, err := api.blockTraces(ctx, block, i)
+		if err != nil {
+			return nil, err
+		}
+		return returnTraces(traces[i]), nil
+	}
+	return nil, errTxNotFound
+}
+
+// Filter returns the flat call traces of the block range matching the addresses,
+// `after` traces are skipped and at most `count` traces are returned.
+func (api *TraceAPI) Filter(ctx context.Context, args TraceFilterArgs) ([]*parityTrace, error) {
+	begin := rpc.LatestBlockNumber.Int64()
+	if args.FromBlock != nil {
+		begin = args.FromBlock.Int64()
+	}
+	end := rpc.LatestBlockNumber.Int64()
+	if args.ToBlock != nil {
+		end = args.ToBlock.Int64()
+	}
+	if begin == rpc.PendingBlockNumber.Int64() || end == rpc.PendingBlockNumber.Int64() {
+		return nil, errors.New("pending traces are not supported")
+	}
+	_, hdr, err := api.b.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if begin < 0 {
+		begin = int64(hdr.Height)
+	}
+	if end < 0 {
+		end = int64(hdr.Height)
+	}
+	if begin > end {
+		return nil, errInvalidBlockRange
+	}
+	if maxRange := api.b.RPCLogsMaxBlockRange(); maxRange > 0 && uint64(end-begin) > maxRange {
+		return nil, errExceedMaxBlockRange
+	}
+
+	var after, count uint64
+	if args.After != nil {
+		after = *args.After
+	}
+	if args.Count != nil {
+		count = *args.Count
+	}
+	results := make([]*parityTrace, 0)
+	for height := begin; height <= end; height++ {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, block, err := api.b.BlockByNumber(ctx, rpc.BlockNumber(height))
+		if err != nil {
+			return nil, err
+		}
+		if block == nil || len(block.Txns) == 0 {
+			continue
+		}
+		traces, err := api.blockTraces(ctx, block, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, txTraces := range traces {
+			for _, trace := range txTraces {
+				if !trace.matches(args.FromAddress, args.ToAddress) {
+					continue
+				}
+				if after > 0 {
+					after--
+					continue
+				}
+				results = append(results, trace)
+				if args.Count != nil && uint64(len(results)) >= count {
+					return results, nil
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// ReplayBlockTransactions replays all the txns of the block, only the "trace"
+// trace type is supported.
+func (api *TraceAPI) ReplayBlockTransactions(ctx context.Context, number rpc.BlockNumber, traceTypes []string) ([]*traceReplayResult, error) {
+	for _, typ := range traceTypes {
+		if typ != "trace" {
+			return nil, fmt.Errorf("trace type %s is not supported", typ)
+		}
+	}
+	_, block, err := api.b.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	traces, err := api.blockTraces(ctx, block, -1)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*traceReplayResult, len(block.Txns))
+	for i, stxn := range block.Txns {
+		result := &traceReplayResult{TransactionHash: common.Hash(stxn.TxnHash)}
+		if len(traces[i]) > 0 && traces[i][0].Result != nil {
+			result.Output = traces[i][0].Result.Output
+		}
+		if len(traceTypes) > 0 {
+			result.Trace = returnTraces(traces[i])
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// blockTraces returns the flat call traces of the txns of the block in the block order. If
+// they were not recorded, the txns are re-executed until the one at index, -1 means all of
+// them. The txns rejected before their execution have no trace.
+func (api *TraceAPI) blockTraces(ctx context.Context, block *yutypes.Block, index int) ([][]*parityTrace, error) {
+	traces := make([][]*parityTrace, len(block.Txns))
+	if len(block.Txns) == 0 {
+		return traces, nil
+	}
+	recorded, err := evm.ReadBlockTraces(api.b.ChainDb(), uint64(block.Height))
+	if err != nil {
+		return nil, err
+	}
+	if len(recorded) == len(block.Txns) {
+		for i, trace := range recorded {
+			if err = decodeTraces(trace, &traces[i]); err != nil {
+				return nil, err
+			}
+		}
+		return traces, nil
+	}
+
+	env, err := api.b.NewTraceEnv(block)
+	if err != nil {
+		return nil, err
+	}
+	for i := range block.Txns {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		tracer, err := evm.NewFlatCallTracer(block, i)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = env.ApplyTxn(i, tracer.Hooks); err == nil {
+			trace, err := tracer.GetResult()
+			if err != nil {
+				return nil, err
+			}
+			if err = decodeTraces(trace, &traces[i]); err != nil {
+				return nil, err
+			}
+		}
+		if i == index {
+			break
+		}
+	}
+	return traces, nil
+}
+
+func decodeTraces(trace json.RawMessage, traces *[]*parityTrace) error {
+	if len(trace) == 0 || string(trace) == "null" {
+		return nil
+	}
+	return json.Unmarshal(trace, traces)
+}
+
+// returnTraces is a helper that will return an empty trace array in case the given traces array is nil,
+// otherwise the given traces array is returned.
+func returnTraces(traces []*parityTrace) []*parityTrace {
+	if traces == nil {
+		return []*parityTrace{}
+	}
+	return traces
+}
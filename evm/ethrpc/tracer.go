@@ -0,0 +1,242 @@
+package ethrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	// register the native tracers: callTracer, prestateTracer, 4byteTracer...
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+	"github.com/ethereum/go-ethereum/rpc"
+	yutypes "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+const (
+	// defaultTraceTimeout is the amount of time a single transaction can execute
+	// by default before being forcefully aborted.
+	defaultTraceTimeout = 5 * time.Second
+)
+
+var errTxNotFound = errors.New("transaction not found")
+
+// TraceCallConfig is the config for traceCall API. It holds one more
+// field to override the state for tracing.
+type TraceCallConfig struct {
+	tracers.TraceConfig
+	StateOverrides *StateOverride
+	BlockOverrides *BlockOverrides
+}
+
+// txTraceResult is the result of a single transaction trace.
+type txTraceResult struct {
+	TxHash common.Hash `json:"txHash"`           // transaction hash
+	Result interface{} `json:"result,omitempty"` // Trace results produced by the tracer
+	Error  string      `json:"error,omitempty"`  // Trace failure produced by the tracer
+}
+
+// TracerAPI offers the `debug_trace*` RPC methods. The txns of a block are re-executed
+// on the state of its parent, in the block order.
+type TracerAPI struct {
+	b Backend
+}
+
+// NewTracerAPI creates a new instance of TracerAPI.
+func NewTracerAPI(b Backend) *TracerAPI {
+	return &TracerAPI{b: b}
+}
+
+// TraceTransaction returns the structured logs created during the execution of EVM
+// and returns them as a JSON object.
+func (api *TracerAPI) TraceTransaction(ctx context.Context, hash common.Hash, config *tracers.TraceConfig) (interface{}, error) {
+	found, _, blockHash, _, _, err := api.b.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errTxNotFound
+	}
+	_, block, err := api.b.BlockByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, stxn := range block.Txns {
+		if common.Hash(stxn.TxnHash) == hash {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, errTxNotFound
+	}
+
+	env, err := api.b.NewTraceEnv(block)
+	if err != nil {
+		return nil, err
+	}
+	for i := range block.Txns {
+		if i == index {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		// the txns rejected before their execution do not touch the state.
+		_, _ = env.ApplyTxn(i, nil)
+	}
+	return api.traceBlockTxn(ctx, env, block, index, config)
+}
+
+// TraceBlockByNumber returns the structured logs created during the execution of
+// EVM and returns them as a JSON object.
+func (api *TracerAPI) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *tracers.TraceConfig) ([]*txTraceResult, error) {
+	_, block, err := api.b.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceBlock(ctx, block, config)
+}
+
+// TraceBlockByHash returns the structured logs created during the execution of
+// EVM and returns them as a JSON object.
+func (api *TracerAPI) TraceBlockByHash(ctx context.Context, hash common.Hash, config *tracers.TraceConfig) ([]*txTraceResult, error) {
+	_, block, err := api.b.BlockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceBlock(ctx, block, config)
+}
+
+// traceBlock traces all the txns of the block in the block order.
+func (api *TracerAPI) traceBlock(ctx context.Context, block *yutypes.Block, config *tracers.TraceConfig) ([]*txTraceResult, error) {
+	if block == nil {
+		return nil, errors.New("block not found")
+	}
+	env, err := api.b.NewTraceEnv(block)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*txTraceResult, len(block.Txns))
+	for i := range block.Txns {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		txHash := common.Hash(block.Txns[i].TxnHash)
+		res, err := api.traceBlockTxn(ctx, env, block, i, config)
+		if err != nil {
+			results[i] = &txTraceResult{TxHash: txHash, Error: err.Error()}
+			continue
+		}
+		results[i] = &txTraceResult{TxHash: txHash, Result: res}
+	}
+	return results, nil
+}
+
+// traceBlockTxn applies the txn at index of the block on the state of env with the tracer of config.
+func (api *TracerAPI) traceBlockTxn(ctx context.Context, env *evm.TraceEnv, block *yutypes.Block, index int, config *tracers.TraceConfig) (interface{}, error) {
+	txctx := &tracers.Context{
+		BlockHash:   common.Hash(block.Hash),
+		BlockNumber: new(big.Int).SetUint64(uint64(block.Height)),
+		TxIndex:     index,
+		TxHash:      common.Hash(block.Txns[index].TxnHash),
+	}
+	return traceWithTimeout(ctx, config, txctx, func(tracer *tracers.Tracer) error {
+		_, err := env.ApplyTxn(index, tracer.Hooks)
+		return err
+	})
+}
+
+// TraceCall lets you trace a given eth_call. It collects the structured logs
+// created during the execution of EVM if the given transaction was added on
+// top of the provided block and returns them as a JSON object.
+func (api *TracerAPI) TraceCall(ctx context.Context, args TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) (interface{}, error) {
+	statedb, header, err := api.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	vmctx := core.NewEVMBlockContext(header, NewChainContext(ctx, api.b), nil)
+	var traceConfig *tracers.TraceConfig
+	if config != nil {
+		if err = config.StateOverrides.Apply(statedb); err != nil {
+			return nil, err
+		}
+		config.BlockOverrides.Apply(&vmctx)
+		traceConfig = &config.TraceConfig
+	}
+	if err = args.CallDefaults(api.b.RPCGasCap(), vmctx.BaseFee, api.b.ChainConfig().ChainID); err != nil {
+		return nil, err
+	}
+	msg := args.ToMessage(vmctx.BaseFee)
+	tx := args.ToTransaction(nil, nil, nil)
+	return traceWithTimeout(ctx, traceConfig, new(tracers.Context), func(tracer *tracers.Tracer) error {
+		return api.applyCall(statedb, vmctx, msg, tx, tracer)
+	})
+}
+
+func (api *TracerAPI) applyCall(statedb *state.StateDB, vmctx vm.BlockContext, msg *core.Message, tx *types.Transaction, tracer *tracers.Tracer) error {
+	vmenv := vm.NewEVM(vmctx, vm.TxContext{GasPrice: big.NewInt(0)}, statedb, api.b.ChainConfig(), vm.Config{Tracer: tracer.Hooks, NoBaseFee: true})
+	statedb.SetLogger(tracer.Hooks)
+	statedb.SetTxContext(common.Hash{}, 0)
+	var usedGas uint64
+	_, err := core.ApplyTransactionWithEVM(msg, api.b.ChainConfig(), new(core.GasPool).AddGas(msg.GasLimit), statedb, vmctx.BlockNumber, common.Hash{}, tx, &usedGas, vmenv)
+	return err
+}
+
+// traceWithTimeout creates the tracer of the config, the struct logger by default, and runs
+// apply with it. The tracer is stopped once the timeout of the config is exceeded.
+func traceWithTimeout(ctx context.Context, config *tracers.TraceConfig, txctx *tracers.Context, apply func(tracer *tracers.Tracer) error) (interface{}, error) {
+	if config == nil {
+		config = &tracers.TraceConfig{}
+	}
+	var (
+		tracer  *tracers.Tracer
+		err     error
+		timeout = defaultTraceTimeout
+	)
+	if config.Tracer == nil {
+		structLogger := logger.NewStructLogger(config.Config)
+		tracer = &tracers.Tracer{
+			Hooks:     structLogger.Hooks(),
+			GetResult: structLogger.GetResult,
+			Stop:      structLogger.Stop,
+		}
+	} else {
+		// only the built-in tracers are served, the js tracers are not registered.
+		if tracers.DefaultDirectory.IsJS(*config.Tracer) {
+			return nil, fmt.Errorf("tracer %s not found", *config.Tracer)
+		}
+		tracer, err = tracers.DefaultDirectory.New(*config.Tracer, txctx, config.TracerConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Timeout != nil {
+		if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+	go func() {
+		<-deadlineCtx.Done()
+		if errors.Is(deadlineCtx.Err(), context.DeadlineExceeded) {
+			tracer.Stop(errors.New("execution timeout"))
+		}
+	}()
+	defer cancel()
+
+	if err = apply(tracer); err != nil {
+		return nil, fmt.Errorf("tracing failed: %w", err)
+	}
+	return tracer.GetResult()
+}
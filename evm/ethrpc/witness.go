@@ -0,0 +1,95 @@
+package ethrpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+// executionWitnessResult is the execution witness of a block as it is returned by
+// `debug_executionWitness`. Witness is the versioned binary encoding the other fields
+// are decoded from, the provers may consume it as is.
+type executionWitnessResult struct {
+	Version      hexutil.Uint64       `json:"version"`
+	BlockNumber  hexutil.Uint64       `json:"blockNumber"`
+	ParentRoot   common.Hash          `json:"parentRoot"`
+	State        []hexutil.Bytes      `json:"state"`
+	Codes        []hexutil.Bytes      `json:"codes"`
+	BlockHashes  []witnessBlockHash   `json:"blockHashes"`
+	Transactions []witnessTransaction `json:"transactions"`
+	Witness      hexutil.Bytes        `json:"witness"`
+}
+
+type witnessBlockHash struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// witnessTransaction is a txn of the block in the block order, Raw is the binary
+// encoding of the signed eth txn.
+type witnessTransaction struct {
+	Hash  common.Hash    `json:"hash"`
+	Index hexutil.Uint64 `json:"index"`
+	Raw   hexutil.Bytes  `json:"raw"`
+}
+
+// ExecutionWitness returns the execution witness of the block, the pre-state trie nodes,
+// the codes, the block hashes and the ordered txns a stateless verifier needs to
+// re-execute the block. It is only available if the block was executed with record_witness.
+func (api *DebugAPI) ExecutionWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*executionWitnessResult, error) {
+	if number, ok := blockNrOrHash.Number(); ok && number == rpc.PendingBlockNumber {
+		return nil, fmt.Errorf("the execution witness of the pending block is not supported")
+	}
+	_, block, err := api.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	raw := evm.ReadRawExecutionWitness(api.b.ChainDb(), uint64(block.Height))
+	if raw == nil {
+		return nil, fmt.Errorf("the execution witness of block #%d is not recorded", block.Height)
+	}
+	witness, err := evm.DecodeWitness(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &executionWitnessResult{
+		Version:      hexutil.Uint64(raw[0]),
+		BlockNumber:  hexutil.Uint64(witness.BlockNumber),
+		ParentRoot:   witness.ParentRoot,
+		State:        make([]hexutil.Bytes, len(witness.State)),
+		Codes:        make([]hexutil.Bytes, len(witness.Codes)),
+		BlockHashes:  make([]witnessBlockHash, len(witness.BlockHashes)),
+		Transactions: make([]witnessTransaction, len(witness.Txns)),
+		Witness:      raw,
+	}
+	for i, node := range witness.State {
+		result.State[i] = node
+	}
+	for i, code := range witness.Codes {
+		result.Codes[i] = code
+	}
+	for i, bh := range witness.BlockHashes {
+		result.BlockHashes[i] = witnessBlockHash{Number: hexutil.Uint64(bh.Number), Hash: bh.Hash}
+	}
+	for i, txn := range witness.Txns {
+		tx, err := txRequest2EthTxn(txn.Request)
+		if err != nil {
+			return nil, err
+		}
+		enc, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		result.Transactions[i] = witnessTransaction{Hash: txn.Hash, Index: hexutil.Uint64(txn.Index), Raw: enc}
+	}
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package ethrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	wsReadBuffer  = 1024
+	wsWriteBuffer = 1024
+	// wsReadLimit caps the size of a websocket message.
+	wsReadLimit = 32 * 1024 * 1024
+	// the connections are pinged every wsPingInterval, and closed if nothing is read
+	// from them for wsPongTimeout.
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 2 * wsPingInterval
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsHandler serves the RPC over websocket. The connections are authenticated by the
+// gateway when they are upgraded, and the gateway checks every message like an http
+// request of the client, the rejected messages are answered with the errors and never
+// reach the RPC server. The response size is not capped over websocket.
+func wsHandler(srv *rpc.Server, g *gateway, allowedOrigins []string) http.Handler {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  wsReadBuffer,
+		WriteBufferSize: wsWriteBuffer,
+		CheckOrigin:     wsOriginChecker(allowedOrigins),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, status, code, reason, msg := g.authenticate(r)
+		if status != 0 {
+			g.throttled(reason, []rpcCall{{}})
+			writeRPCErrors(w, status, []rpcCall{{}}, false, code, msg)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logrus.Debugf("websocket upgrade failed: %v", err)
+			return
+		}
+		conn.SetReadLimit(wsReadLimit)
+		wc := &wsConn{Conn: conn, gateway: g, client: c}
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		go wc.pingLoop()
+		srv.ServeCodec(rpc.NewFuncCodec(conn, wc.encode, wc.decode), 0)
+	})
+}
+
+// wsOriginChecker accepts the requests without an Origin header, which are not sent by
+// browsers, and the listed origins, "*" accepts every origin.
+func wsOriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range allowedOrigins {
+			if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+				return true
+			}
+		}
+		logrus.Debugf("websocket origin %s is not allowed", origin)
+		return false
+	}
+}
+
+// wsConn is a websocket connection whose messages are checked by the gateway.
+type wsConn struct {
+	*websocket.Conn
+	gateway *gateway
+	client  *gatewayClient
+
+	// mu guards the writes, the rejections are written besides the responses of the server.
+	mu sync.Mutex
+}
+
+func (c *wsConn) encode(v any, isErrorResponse bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.WriteJSON(v)
+}
+
+// pingLoop pings the connection until a write fails, e.g. once it is closed.
+func (c *wsConn) pingLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		err := c.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// decode reads the next message which is not rejected by the gateway.
+func (c *wsConn) decode(v any) error {
+	for {
+		var msg json.RawMessage
+		if err := c.SetReadDeadline(time.Now().Add(wsPongTimeout)); err != nil {
+			return err
+		}
+		if err := c.ReadJSON(&msg); err != nil {
+			return err
+		}
+		calls, batch, ok := parseCalls(msg)
+		if ok {
+			if status, code, reason, errMsg := c.gateway.checkCalls(c.client, calls, batch); status != 0 {
+				c.reject(reason, calls, batch, code, errMsg)
+				continue
+			}
+		}
+		return json.Unmarshal(msg, v)
+	}
+}
+
+func (c *wsConn) reject(reason string, calls []rpcCall, batch bool, code int, msg string) {
+	c.gateway.throttled(reason, calls)
+	if resp := rpcErrors(calls, batch, code, msg); resp != nil {
+		if err := c.encode(resp, true); err != nil {
+			logrus.Debugf("websocket write failed: %v", err)
+		}
+	}
+}
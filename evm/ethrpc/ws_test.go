@@ -0,0 +1,138 @@
+package ethrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+type testEchoService struct{}
+
+func (testEchoService) Echo(s string) string {
+	return s
+}
+
+type testRPCResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newTestWSServer(t *testing.T, cfg *evm.RPCGatewayConfig, allowedOrigins []string) *httptest.Server {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("test", testEchoService{}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	g, err := newGateway(cfg, []rpc.API{{Namespace: "test", Service: testEchoService{}}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ts := httptest.NewServer(wsHandler(srv, g, allowedOrigins))
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Stop()
+	})
+	return ts
+}
+
+func TestWSHandler(t *testing.T) {
+	ts := newTestWSServer(t, &evm.RPCGatewayConfig{
+		MaxBatchSize:  2,
+		RequireAPIKey: true,
+		APIKeys:       []evm.RPCAPIKey{{Key: "key", Deny: []string{"eth_*"}}},
+	}, nil)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	// the connections are authenticated when they are upgraded.
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected the connection without an API key to be unauthorized, but got %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?"+apiKeyQuery+"=key", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer conn.Close()
+
+	call := func(msg string) []byte {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		return data
+	}
+	checkError := func(data []byte, code int) {
+		resp := new(testRPCResponse)
+		if err := json.Unmarshal(data, resp); err != nil || resp.Error == nil || resp.Error.Code != code {
+			t.Fatalf("Expected error code %d, but got %s", code, data)
+		}
+	}
+
+	resp1 := new(testRPCResponse)
+	if err = json.Unmarshal(call(`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["hi"]}`), resp1); err != nil || string(resp1.Result) != `"hi"` {
+		t.Fatalf("Expected the echo of hi, but got %+v, %v", resp1, err)
+	}
+	// every message is checked by the gateway, the rejected ones are answered on the connection.
+	checkError(call(`{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"}`), errCodeMethodDenied)
+	var batch []testRPCResponse
+	if err = json.Unmarshal(call(`[{"jsonrpc":"2.0","id":3,"method":"test_echo","params":["a"]},{"jsonrpc":"2.0","id":4,"method":"test_echo","params":["b"]},{"jsonrpc":"2.0","id":5,"method":"test_echo","params":["c"]}]`), &batch); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(batch) != 3 || batch[0].Error == nil || batch[0].Error.Code != errCodeLimitExceeded || string(batch[2].ID) != "5" {
+		t.Fatalf("Expected the batch to be rejected, but got %+v", batch)
+	}
+	// the connection is still served after the rejections.
+	resp1 = new(testRPCResponse)
+	if err = json.Unmarshal(call(`{"jsonrpc":"2.0","id":6,"method":"test_echo","params":["again"]}`), resp1); err != nil || string(resp1.Result) != `"again"` {
+		t.Fatalf("Expected the echo of again, but got %+v, %v", resp1, err)
+	}
+}
+
+func TestWSOriginChecker(t *testing.T) {
+	for i, c := range []struct {
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{nil, "", true},
+		{nil, "https://example.com", false},
+		{[]string{"https://example.com/"}, "https://example.com", true},
+		{[]string{"https://example.com"}, "https://EXAMPLE.com", true},
+		{[]string{"https://example.com"}, "https://evil.com", false},
+		{[]string{"*"}, "https://evil.com", true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if ok := wsOriginChecker(c.allowed)(r); ok != c.ok {
+			t.Fatalf("Expected origin %q of case %d allowed %v, but got %v", c.origin, i, c.ok, ok)
+		}
+	}
+
+	// the upgrades from the origins which are not allowed are refused.
+	ts := newTestWSServer(t, &evm.RPCGatewayConfig{}, []string{"https://example.com"})
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{"https://evil.com"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected the upgrade to be forbidden, but got %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{"https://example.com"}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	conn.Close()
+}
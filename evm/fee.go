@@ -0,0 +1,142 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip1559"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+// calcBaseFee calculates the base fee of the block from the gas used by its parent and the
+// base fee in the header of its parent, see EIP-1559. The parents without a base fee were
+// executed before the fee market, the block is then the first of the fee market.
+func (s *Solidity) calcBaseFee(block *yu_types.Block) (*big.Int, error) {
+	if s.cfg.NoBaseFee {
+		return new(big.Int), nil
+	}
+	if s.ChainEnv == nil || s.Chain == nil {
+		return big.NewInt(params.InitialBaseFee), nil
+	}
+	parent, err := s.Chain.GetCompactBlock(block.PrevHash)
+	if err != nil {
+		return nil, fmt.Errorf("get the parent of Block(%d): %v", block.Height, err)
+	}
+	parentBaseFee, err := HeaderBaseFee(parent.Header)
+	if err != nil {
+		return nil, err
+	}
+	if parentBaseFee == nil {
+		return big.NewInt(params.InitialBaseFee), nil
+	}
+	if err = CheckBaseFeeGasLimit(parent.LeiLimit); err != nil {
+		return nil, fmt.Errorf("parent of Block(%d): %w", block.Height, err)
+	}
+	parentHeader := &types.Header{
+		Number:   new(big.Int).SetUint64(uint64(parent.Height)),
+		GasLimit: parent.LeiLimit,
+		GasUsed:  parent.LeiUsed,
+		BaseFee:  parentBaseFee,
+	}
+	return eip1559.CalcBaseFee(s.cfg.ChainConfig, parentHeader), nil
+}
+
+// CheckBaseFeeGasLimit checks that the gas limit of the blocks leaves a non-zero gas target
+// to the base fee, which targets half of it.
+func CheckBaseFeeGasLimit(gasLimit uint64) error {
+	if gasLimit < params.DefaultElasticityMultiplier {
+		return fmt.Errorf("the gas limit of the blocks must be at least %d with the base fee enabled, but got %d", params.DefaultElasticityMultiplier, gasLimit)
+	}
+	return nil
+}
+
+// BaseFee returns the base fee of the block being executed.
+func (s *Solidity) BaseFee() *big.Int {
+	s.Lock()
+	defer s.Unlock()
+	return new(big.Int).Set(s.cfg.BaseFee)
+}
+
+// headerBaseFeePrefix marks the Extra of the headers carrying the base fee of their block,
+// it is followed by the version of the encoding and the big-endian bytes of the base fee.
+var headerBaseFeePrefix = []byte("reddio/basefee")
+
+const headerBaseFeeVersion = 1
+
+// SetHeaderBaseFee records the base fee the block is executed with in the Extra of its header.
+func SetHeaderBaseFee(header *yu_types.Header, baseFee *big.Int) {
+	extra := make([]byte, 0, len(headerBaseFeePrefix)+1+len(baseFee.Bytes()))
+	extra = append(extra, headerBaseFeePrefix...)
+	extra = append(extra, headerBaseFeeVersion)
+	header.Extra = append(extra, baseFee.Bytes()...)
+}
+
+// HeaderBaseFee returns the base fee the block was executed with. It is nil if the header
+// does not carry one, i.e. the block was executed before the fee market, with the constant
+// base fee params.InitialBaseFee.
+func HeaderBaseFee(header *yu_types.Header) (*big.Int, error) {
+	if !bytes.HasPrefix(header.Extra, headerBaseFeePrefix) {
+		return nil, nil
+	}
+	data := header.Extra[len(headerBaseFeePrefix):]
+	if len(data) == 0 || data[0] != headerBaseFeeVersion {
+		return nil, fmt.Errorf("unknown base fee encoding %x in the header of Block(%d)", data, header.Height)
+	}
+	return new(big.Int).SetBytes(data[1:]), nil
+}
+
+// ExecutedBaseFee returns the base fee the block was executed with, the blocks executed
+// before the fee market were executed with params.InitialBaseFee.
+func ExecutedBaseFee(header *yu_types.Header) (*big.Int, error) {
+	baseFee, err := HeaderBaseFee(header)
+	if err != nil || baseFee != nil {
+		return baseFee, err
+	}
+	return big.NewInt(params.InitialBaseFee), nil
+}
+
+// GasFeeCaps returns the fee cap and the tip cap of the txn.
+// They are both the gas price for the txns before EIP-1559.
+func (tr *TxRequest) GasFeeCaps() (feeCap, tipCap *big.Int) {
+	feeCap = tr.GasPrice
+	if feeCap == nil {
+		feeCap = new(big.Int)
+	}
+	tipCap = feeCap
+	if len(tr.OriginArgs) == 0 {
+		return
+	}
+	txArgs := &TempTransactionArgs{}
+	if err := json.Unmarshal(tr.OriginArgs, txArgs); err != nil || txArgs.MaxFeePerGas == nil {
+		return
+	}
+	feeCap = txArgs.MaxFeePerGas.ToInt()
+	tipCap = new(big.Int)
+	if txArgs.MaxPriorityFeePerGas != nil {
+		tipCap = txArgs.MaxPriorityFeePerGas.ToInt()
+	}
+	return
+}
+
+// effectiveGasPrice checks the fee caps of the txn against the base fee. It returns the
+// gas price paid by the txn and the tip of it, which is paid to the coinbase.
+// The base fee part of the gas price is burned.
+func effectiveGasPrice(req *TxRequest, baseFee *big.Int) (gasPrice, tip *big.Int, err error) {
+	feeCap, tipCap := req.GasFeeCaps()
+	if feeCap.Cmp(tipCap) < 0 {
+		return nil, nil, fmt.Errorf("%w: address %v, maxPriorityFeePerGas: %s, maxFeePerGas: %s", core.ErrTipAboveFeeCap,
+			req.Origin.Hex(), tipCap, feeCap)
+	}
+	if feeCap.Cmp(baseFee) < 0 {
+		return nil, nil, fmt.Errorf("%w: address %v, maxFeePerGas: %s, baseFee: %s", core.ErrFeeCapTooLow,
+			req.Origin.Hex(), feeCap, baseFee)
+	}
+	tip = math.BigMin(tipCap, new(big.Int).Sub(feeCap, baseFee))
+	return new(big.Int).Add(baseFee, tip), tip, nil
+}
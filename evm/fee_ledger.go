@@ -0,0 +1,144 @@
+package evm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/holiman/uint256"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+var blockFeesPrefix = []byte("reddio-block-fees-")
+
+// TxFee is the fee paid by a txn. The net fee, charged minus refunded, is split
+// into the burnt base fee and the tip paid to the coinbase.
+// The amounts are in wei and encoded as decimal strings.
+type TxFee struct {
+	TxHash   common.Hash  `json:"txHash"`
+	GasUsed  uint64       `json:"gasUsed"`
+	GasPrice *uint256.Int `json:"gasPrice"`
+	Charged  *uint256.Int `json:"charged"`
+	Refunded *uint256.Int `json:"refunded"`
+	Burnt    *uint256.Int `json:"burnt"`
+	Tip      *uint256.Int `json:"tip"`
+}
+
+func newTxFee(txHash common.Hash, gasLimit, remainGas uint64, gasPrice, tip, baseFee *big.Int) *TxFee {
+	gasUsed := gasLimit - remainGas
+	price := uint256.MustFromBig(gasPrice)
+	return &TxFee{
+		TxHash:   txHash,
+		GasUsed:  gasUsed,
+		GasPrice: price,
+		Charged:  new(uint256.Int).Mul(price, uint256.NewInt(gasLimit)),
+		Refunded: new(uint256.Int).Mul(price, uint256.NewInt(remainGas)),
+		Burnt:    new(uint256.Int).Mul(uint256.MustFromBig(baseFee), uint256.NewInt(gasUsed)),
+		Tip:      new(uint256.Int).Mul(uint256.MustFromBig(tip), uint256.NewInt(gasUsed)),
+	}
+}
+
+// NetFee returns the fee charged minus the fee refunded.
+func (f *TxFee) NetFee() *uint256.Int {
+	return new(uint256.Int).Sub(f.Charged, f.Refunded)
+}
+
+// BlockFees is the fee ledger of a block, it is the result of the `reddio_blockFees` RPC call.
+type BlockFees struct {
+	BlockHeight    uint64         `json:"blockHeight"`
+	Coinbase       common.Address `json:"coinbase"`
+	BaseFee        *uint256.Int   `json:"baseFee"`
+	TotalFees      *uint256.Int   `json:"totalFees"`
+	BurntFees      *uint256.Int   `json:"burntFees"`
+	CoinbaseReward *uint256.Int   `json:"coinbaseReward"`
+	Txns           []*TxFee       `json:"txns"`
+}
+
+// newBlockFees sums up the fees of the txns in the block order. A txn can be executed more
+// than once by the parallel executor, only the fee of its last execution is kept in txFees,
+// so the ledger does not depend on how the txns were scheduled.
+func newBlockFees(block *yu_types.Block, coinbase common.Address, baseFee *big.Int, txFees map[common.Hash]*TxFee) *BlockFees {
+	fees := &BlockFees{
+		BlockHeight:    uint64(block.Height),
+		Coinbase:       coinbase,
+		BaseFee:        uint256.MustFromBig(baseFee),
+		TotalFees:      new(uint256.Int),
+		BurntFees:      new(uint256.Int),
+		CoinbaseReward: new(uint256.Int),
+		Txns:           make([]*TxFee, 0, len(block.Txns)),
+	}
+	for _, stxn := range block.Txns {
+		fee, ok := txFees[common.Hash(stxn.TxnHash)]
+		if !ok {
+			continue
+		}
+		fees.TotalFees.Add(fees.TotalFees, fee.NetFee())
+		fees.BurntFees.Add(fees.BurntFees, fee.Burnt)
+		fees.CoinbaseReward.Add(fees.CoinbaseReward, fee.Tip)
+		fees.Txns = append(fees.Txns, fee)
+	}
+	return fees
+}
+
+// TxFees returns a copy of the fees recorded for the txns of the block being executed.
+func (s *Solidity) TxFees() map[common.Hash]*TxFee {
+	s.Lock()
+	defer s.Unlock()
+	fees := make(map[common.Hash]*TxFee, len(s.txFees))
+	for txHash, fee := range s.txFees {
+		fees[txHash] = fee
+	}
+	return fees
+}
+
+func (s *Solidity) SetTxFees(fees map[common.Hash]*TxFee) {
+	s.Lock()
+	defer s.Unlock()
+	s.txFees = make(map[common.Hash]*TxFee, len(fees))
+	for txHash, fee := range fees {
+		s.txFees[txHash] = fee
+	}
+}
+
+// BlockFees returns the fee ledger of the block being executed.
+func (s *Solidity) BlockFees(block *yu_types.Block) *BlockFees {
+	s.Lock()
+	defer s.Unlock()
+	return newBlockFees(block, s.cfg.Coinbase, s.cfg.BaseFee, s.txFees)
+}
+
+func blockFeesKey(height uint64) []byte {
+	key := make([]byte, len(blockFeesPrefix)+8)
+	copy(key, blockFeesPrefix)
+	binary.BigEndian.PutUint64(key[len(blockFeesPrefix):], height)
+	return key
+}
+
+func WriteBlockFees(db ethdb.KeyValueWriter, fees *BlockFees) error {
+	byt, err := json.Marshal(fees)
+	if err != nil {
+		return err
+	}
+	return db.Put(blockFeesKey(fees.BlockHeight), byt)
+}
+
+// ReadBlockFees returns the fee ledger of the block, it is nil if the block is not found.
+func ReadBlockFees(db ethdb.KeyValueReader, height uint64) (*BlockFees, error) {
+	key := blockFeesKey(height)
+	// the dbs do not share a not found error, it is told by Has.
+	has, err := db.Has(key)
+	if err != nil || !has {
+		return nil, err
+	}
+	byt, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	fees := new(BlockFees)
+	if err = json.Unmarshal(byt, fees); err != nil {
+		return nil, err
+	}
+	return fees, nil
+}
@@ -0,0 +1,142 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+	yu_common "github.com/yu-org/yu/common"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+func TestEffectiveGasPrice(t *testing.T) {
+	baseFee := big.NewInt(100)
+
+	legacy := &TxRequest{GasPrice: big.NewInt(150)}
+	gasPrice, tip, err := effectiveGasPrice(legacy, baseFee)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if gasPrice.Int64() != 150 || tip.Int64() != 50 {
+		t.Fatalf("Expected gas price 150 and tip 50, but got %v and %v", gasPrice, tip)
+	}
+
+	args, _ := json.Marshal(&TempTransactionArgs{
+		MaxFeePerGas:         (*hexutil.Big)(big.NewInt(130)),
+		MaxPriorityFeePerGas: (*hexutil.Big)(big.NewInt(20)),
+	})
+	dynamic := &TxRequest{GasPrice: big.NewInt(130), OriginArgs: args}
+	gasPrice, tip, err = effectiveGasPrice(dynamic, baseFee)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if gasPrice.Int64() != 120 || tip.Int64() != 20 {
+		t.Fatalf("Expected gas price 120 and tip 20, but got %v and %v", gasPrice, tip)
+	}
+
+	_, _, err = effectiveGasPrice(&TxRequest{GasPrice: big.NewInt(99)}, baseFee)
+	if !errors.Is(err, core.ErrFeeCapTooLow) {
+		t.Fatalf("Expected ErrFeeCapTooLow, but got %v", err)
+	}
+}
+
+func TestBlockFees(t *testing.T) {
+	baseFee, tip := big.NewInt(100), big.NewInt(20)
+	gasPrice := new(big.Int).Add(baseFee, tip)
+	block := &yu_types.Block{
+		Header: &yu_types.Header{Height: 1},
+		Txns: yu_types.SignedTxns{
+			{TxnHash: yu_common.Hash{0x0a}},
+			{TxnHash: yu_common.Hash{0x0b}},
+		},
+	}
+	txFees := map[common.Hash]*TxFee{
+		{0x0a}: newTxFee(common.Hash{0x0a}, 50000, 29000, gasPrice, tip, baseFee),
+		{0x0b}: newTxFee(common.Hash{0x0b}, 21000, 0, gasPrice, tip, baseFee),
+		// the fee of a txn which is not in the block is ignored.
+		{0x0c}: newTxFee(common.Hash{0x0c}, 21000, 0, gasPrice, tip, baseFee),
+	}
+
+	fee := txFees[common.Hash{0x0a}]
+	if fee.NetFee().Uint64() != 21000*120 {
+		t.Fatalf("Expected net fee %d, but got %v", 21000*120, fee.NetFee())
+	}
+	fees := newBlockFees(block, common.Address{}, baseFee, txFees)
+	if len(fees.Txns) != 2 || fees.Txns[0].TxHash != (common.Hash{0x0a}) {
+		t.Fatalf("Expected the fees of the 2 txns in the block order, but got %d", len(fees.Txns))
+	}
+	if fees.BurntFees.Uint64() != 42000*100 || fees.CoinbaseReward.Uint64() != 42000*20 {
+		t.Fatalf("Expected burnt fees %d and coinbase reward %d, but got %v and %v", 42000*100, 42000*20, fees.BurntFees, fees.CoinbaseReward)
+	}
+	if fees.TotalFees.Uint64() != 42000*120 {
+		t.Fatalf("Expected total fees %d, but got %v", 42000*120, fees.TotalFees)
+	}
+}
+
+// failingReader fails every read of the db.
+type failingReader struct {
+	ethdb.KeyValueReader
+}
+
+func (failingReader) Get([]byte) ([]byte, error) { return nil, errors.New("db closed") }
+
+func TestReadBlockFees(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	if fees, err := ReadBlockFees(db, 1); fees != nil || err != nil {
+		t.Fatalf("Expected no fees of a missing block, but got %v, %v", fees, err)
+	}
+	fees := &BlockFees{BlockHeight: 1, TotalFees: uint256.NewInt(42)}
+	if err := WriteBlockFees(db, fees); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	read, err := ReadBlockFees(db, 1)
+	if err != nil || read == nil || read.TotalFees.Uint64() != 42 {
+		t.Fatalf("Expected the fees of the block, but got %v, %v", read, err)
+	}
+	if _, err = ReadBlockFees(failingReader{db}, 1); err == nil {
+		t.Fatalf("Expected the error of the db")
+	}
+}
+
+func TestHeaderBaseFee(t *testing.T) {
+	header := &yu_types.Header{Height: 1}
+	baseFee, err := HeaderBaseFee(header)
+	if err != nil || baseFee != nil {
+		t.Fatalf("Expected no base fee, but got %v, %v", baseFee, err)
+	}
+	if baseFee, err = ExecutedBaseFee(header); err != nil || baseFee.Int64() != params.InitialBaseFee {
+		t.Fatalf("Expected the initial base fee, but got %v, %v", baseFee, err)
+	}
+
+	for _, fee := range []int64{0, 875000000} {
+		SetHeaderBaseFee(header, big.NewInt(fee))
+		if baseFee, err = ExecutedBaseFee(header); err != nil || baseFee.Int64() != fee {
+			t.Fatalf("Expected base fee %d, but got %v, %v", fee, baseFee, err)
+		}
+	}
+
+	// the Extra without the prefix does not carry a base fee.
+	header.Extra = []byte("875000000")
+	if baseFee, err = HeaderBaseFee(header); err != nil || baseFee != nil {
+		t.Fatalf("Expected no base fee, but got %v, %v", baseFee, err)
+	}
+	header.Extra = append(append([]byte{}, headerBaseFeePrefix...), headerBaseFeeVersion+1, 1)
+	if _, err = HeaderBaseFee(header); err == nil {
+		t.Fatalf("Expected an unknown base fee encoding error")
+	}
+
+	if err = CheckBaseFeeGasLimit(0); err == nil {
+		t.Fatalf("Expected an error for the gas limit 0")
+	}
+	if err = CheckBaseFeeGasLimit(params.DefaultElasticityMultiplier); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+}
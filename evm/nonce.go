@@ -0,0 +1,120 @@
+package evm
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+// checkNonce makes sure the nonce of the txn is the next nonce of its sender.
+func checkNonce(req *TxRequest, stateDB vm.StateDB) error {
+	stNonce := stateDB.GetNonce(req.Origin)
+	if req.Nonce < stNonce {
+		return fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooLow,
+			req.Origin.Hex(), req.Nonce, stNonce)
+	}
+	if req.Nonce > stNonce {
+		return fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooHigh,
+			req.Origin.Hex(), req.Nonce, stNonce)
+	}
+	if stNonce == math.MaxUint64 {
+		return fmt.Errorf("%w: address %v, nonce: %d", core.ErrNonceMax,
+			req.Origin.Hex(), stNonce)
+	}
+	return nil
+}
+
+func checkIntrinsicGas(cfg *GethConfig, req *TxRequest) error {
+	rules := cfg.ChainConfig.Rules(cfg.BlockNumber, cfg.Random != nil, cfg.Time)
+	gas, err := core.IntrinsicGas(req.Input, req.TxAccessList(), req.Address == nil, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	if err != nil {
+		return err
+	}
+	if req.GasLimit < gas {
+		return fmt.Errorf("%w: have %d, want %d", core.ErrIntrinsicGas, req.GasLimit, gas)
+	}
+	return nil
+}
+
+// checkPoolNonce rejects the txns whose nonce is already used when they enter the txpool.
+// The txns whose nonce is too high stay queued in the txpool, see PackFilter.
+func (s *Solidity) checkPoolNonce(req *TxRequest) error {
+	s.Lock()
+	defer s.Unlock()
+	stNonce := s.ethState.StateDB().GetNonce(req.Origin)
+	if req.Nonce < stNonce {
+		return fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooLow,
+			req.Origin.Hex(), req.Nonce, stNonce)
+	}
+	return nil
+}
+
+// PackFilter only packs the txns whose nonce follows the nonce of their sender, the
+// txns with a nonce gap are left in the txpool until the gap is filled.
+// The txns whose nonce is too low are packed and rejected in execution.
+// A txn which would fail the preCheck of its execution is packed and rejected as well, but
+// it does not use its nonce, so the later txns of its sender are left in the txpool instead
+// of being rejected with a nonce too high.
+// The next nonces are reset when the block is committed.
+func (s *Solidity) PackFilter(stxn *yu_types.SignedTxn) bool {
+	req := new(TxRequest)
+	if err := stxn.BindJson(req); err != nil {
+		return true
+	}
+	s.Lock()
+	defer s.Unlock()
+	next, ok := s.packNonces[req.Origin]
+	if !ok {
+		next = s.ethState.StateDB().GetNonce(req.Origin)
+	}
+	if req.Nonce > next {
+		return false
+	}
+	if req.Nonce == next && s.packCheck(req) == nil {
+		s.packNonces[req.Origin] = next + 1
+	}
+	return true
+}
+
+// packCheck runs the checks of preCheck which do not depend on the other txns of the block.
+// The balance of the sender must pay for the gas of the txn after the max cost of its txns
+// packed before, since only its own txns can spend the balance of an EOA.
+func (s *Solidity) packCheck(req *TxRequest) error {
+	stateDB := s.ethState.StateDB()
+	codeHash := stateDB.GetCodeHash(req.Origin)
+	if codeHash != (common.Hash{}) && codeHash != types.EmptyCodeHash {
+		return core.ErrSenderNoEOA
+	}
+	if err := checkIntrinsicGas(s.cfg, req); err != nil {
+		return err
+	}
+	feeCap, _ := req.GasFeeCaps()
+	if feeCap.Cmp(s.cfg.BaseFee) < 0 {
+		return core.ErrFeeCapTooLow
+	}
+	spent, ok := s.packCosts[req.Origin]
+	if !ok {
+		spent = new(big.Int)
+	}
+	cost := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(req.GasLimit))
+	cost.Add(cost, spent)
+	if stateDB.GetBalance(req.Origin).ToBig().Cmp(cost) < 0 {
+		return core.ErrInsufficientFunds
+	}
+	if req.Value != nil {
+		cost.Add(cost, req.Value)
+	}
+	s.packCosts[req.Origin] = cost
+	return nil
+}
+
+func (s *Solidity) resetPackNonces() {
+	s.packNonces = make(map[common.Address]uint64)
+	s.packCosts = make(map[common.Address]*big.Int)
+}
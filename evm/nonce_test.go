@@ -0,0 +1,81 @@
+package evm
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+	yu_common "github.com/yu-org/yu/common"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+func newTestPackTxn(t *testing.T, sender common.Address, nonce uint64, value int64) *yu_types.SignedTxn {
+	to := common.HexToAddress("0x1001")
+	byt, err := json.Marshal(&TxRequest{
+		Origin:   sender,
+		Address:  &to,
+		Nonce:    nonce,
+		GasLimit: params.TxGas,
+		GasPrice: big.NewInt(params.GWei),
+		Value:    big.NewInt(value),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return &yu_types.SignedTxn{
+		TxnHash: yu_common.BytesToHash(append(sender.Bytes(), byte(nonce))),
+		Raw:     &yu_types.UnsignedTxn{WrCall: &yu_common.WrCall{Params: string(byt)}},
+	}
+}
+
+func TestPackFilter(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0x0a")
+		bob   = common.HexToAddress("0x0b")
+		gas   = int64(params.TxGas * params.GWei)
+	)
+	db := rawdb.NewMemoryDatabase()
+	sdb, _ := state.New(types.EmptyRootHash, state.NewDatabaseWithNodeDB(db, triedb.NewDatabase(db, triedb.HashDefaults)), nil)
+	// alice can only pay for the gas and the value of its first txn.
+	sdb.AddBalance(alice, uint256.NewInt(uint64(gas+1000)), 0)
+	sdb.AddBalance(bob, uint256.NewInt(params.Ether), 0)
+	sdb.SetNonce(bob, 2)
+	s := NewStatelessSolidity(&GethConfig{
+		ChainConfig: params.AllEthashProtocolChanges,
+		Random:      &common.Hash{},
+		BaseFee:     big.NewInt(params.GWei),
+	}, sdb)
+
+	for i, c := range []struct {
+		stxn   *yu_types.SignedTxn
+		packed bool
+	}{
+		{newTestPackTxn(t, alice, 0, 1000), true},
+		// the txn fails buying its gas, it is packed and rejected without using its nonce.
+		{newTestPackTxn(t, alice, 1, 0), true},
+		// the later txns of alice stay in the txpool.
+		{newTestPackTxn(t, alice, 2, 0), false},
+		{newTestPackTxn(t, bob, 1, 0), true},
+		{newTestPackTxn(t, bob, 2, 0), true},
+		// the nonce 3 of bob is missing.
+		{newTestPackTxn(t, bob, 4, 0), false},
+		{newTestPackTxn(t, bob, 3, 0), true},
+	} {
+		if packed := s.PackFilter(c.stxn); packed != c.packed {
+			t.Fatalf("Expected txn %d packed %v, but got %v", i, c.packed, packed)
+		}
+	}
+
+	// the pack state is reset when the block is committed.
+	s.resetPackNonces()
+	if !s.PackFilter(newTestPackTxn(t, bob, 2, 0)) || s.PackFilter(newTestPackTxn(t, bob, 4, 0)) {
+		t.Fatalf("Expected the pack nonce of bob to be reset to 2")
+	}
+}
@@ -0,0 +1,447 @@
+package pending_state
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+type overlayAccount struct {
+	exist bool
+	// created means the account is (re)created in this txn, so the storage
+	// of the base is not visible any more.
+	created        bool
+	selfDestructed bool
+	balance        *uint256.Int
+	nonce          uint64
+	codeHash       common.Hash
+	code           []byte
+	codeLoaded     bool
+	storage        map[common.Hash]common.Hash
+
+	balanceDirty bool
+	nonceDirty   bool
+	codeDirty    bool
+}
+
+// OverlayStateDB is a copy-on-write state for a single transaction. Reads go
+// through to the shared base state and only the transaction's own writes are
+// kept in the overlay, until they are applied by MergeInto.
+// Overlays over the same base must share the same baseMu.
+type OverlayStateDB struct {
+	base   *state.StateDB
+	baseMu *sync.Mutex
+
+	accounts  map[common.Address]*overlayAccount
+	transient map[common.Address]map[common.Hash]common.Hash
+	alAddrs   map[common.Address]struct{}
+	alSlots   map[common.Address]map[common.Hash]struct{}
+	refund    uint64
+	preimages map[common.Hash][]byte
+
+	thash   common.Hash
+	txIndex int
+	logs    map[common.Hash][]*types.Log
+	logSize uint
+
+	// journal holds the undo functions of all the changes, a snapshot is
+	// the length of the journal.
+	journal []func()
+}
+
+func NewOverlayStateDB(base *state.StateDB, baseMu *sync.Mutex) *OverlayStateDB {
+	return &OverlayStateDB{
+		base:      base,
+		baseMu:    baseMu,
+		accounts:  make(map[common.Address]*overlayAccount),
+		transient: make(map[common.Address]map[common.Hash]common.Hash),
+		alAddrs:   make(map[common.Address]struct{}),
+		alSlots:   make(map[common.Address]map[common.Hash]struct{}),
+		preimages: make(map[common.Hash][]byte),
+		logs:      make(map[common.Hash][]*types.Log),
+		journal:   make([]func(), 0),
+	}
+}
+
+// Base returns the shared base state of the overlay.
+func (o *OverlayStateDB) Base() *state.StateDB {
+	return o.base
+}
+
+func (o *OverlayStateDB) account(addr common.Address) *overlayAccount {
+	if acc, ok := o.accounts[addr]; ok {
+		return acc
+	}
+	o.baseMu.Lock()
+	acc := &overlayAccount{
+		exist:    o.base.Exist(addr),
+		balance:  new(uint256.Int).Set(o.base.GetBalance(addr)),
+		nonce:    o.base.GetNonce(addr),
+		codeHash: o.base.GetCodeHash(addr),
+		storage:  make(map[common.Hash]common.Hash),
+	}
+	o.baseMu.Unlock()
+	o.accounts[addr] = acc
+	return acc
+}
+
+// mutable journals the account before it is changed. It creates the account
+// if it does not exist yet, like getOrNewStateObject does.
+func (o *OverlayStateDB) mutable(addr common.Address) *overlayAccount {
+	acc := o.account(addr)
+	prev := *acc
+	o.journal = append(o.journal, func() { *acc = prev })
+	if !acc.exist {
+		acc.exist = true
+		acc.created = true
+		acc.codeHash = types.EmptyCodeHash
+		acc.code = nil
+		acc.codeLoaded = true
+	}
+	return acc
+}
+
+func (o *OverlayStateDB) CreateAccount(addr common.Address) {
+	acc := o.account(addr)
+	prev := *acc
+	o.journal = append(o.journal, func() { *acc = prev })
+	// the balance is carried over, same as state.StateDB
+	balance := acc.balance
+	if !acc.exist {
+		balance = new(uint256.Int)
+	}
+	*acc = overlayAccount{
+		exist:        true,
+		created:      true,
+		balance:      balance,
+		codeHash:     types.EmptyCodeHash,
+		codeLoaded:   true,
+		storage:      make(map[common.Hash]common.Hash),
+		balanceDirty: true,
+	}
+}
+
+func (o *OverlayStateDB) SubBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) {
+	acc := o.mutable(addr)
+	acc.balance = new(uint256.Int).Sub(acc.balance, amount)
+	acc.balanceDirty = true
+}
+
+func (o *OverlayStateDB) AddBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) {
+	acc := o.mutable(addr)
+	acc.balance = new(uint256.Int).Add(acc.balance, amount)
+	acc.balanceDirty = true
+}
+
+func (o *OverlayStateDB) GetBalance(addr common.Address) *uint256.Int {
+	return o.account(addr).balance
+}
+
+func (o *OverlayStateDB) GetNonce(addr common.Address) uint64 {
+	return o.account(addr).nonce
+}
+
+func (o *OverlayStateDB) SetNonce(addr common.Address, nonce uint64) {
+	acc := o.mutable(addr)
+	acc.nonce = nonce
+	acc.nonceDirty = true
+}
+
+func (o *OverlayStateDB) GetCodeHash(addr common.Address) common.Hash {
+	acc := o.account(addr)
+	if !acc.exist {
+		return common.Hash{}
+	}
+	return acc.codeHash
+}
+
+func (o *OverlayStateDB) GetCode(addr common.Address) []byte {
+	acc := o.account(addr)
+	if !acc.codeLoaded {
+		o.baseMu.Lock()
+		acc.code = o.base.GetCode(addr)
+		o.baseMu.Unlock()
+		acc.codeLoaded = true
+	}
+	return acc.code
+}
+
+func (o *OverlayStateDB) SetCode(addr common.Address, code []byte) {
+	acc := o.mutable(addr)
+	acc.code = code
+	acc.codeHash = crypto.Keccak256Hash(code)
+	acc.codeLoaded = true
+	acc.codeDirty = true
+}
+
+func (o *OverlayStateDB) GetCodeSize(addr common.Address) int {
+	return len(o.GetCode(addr))
+}
+
+func (o *OverlayStateDB) AddRefund(gas uint64) {
+	prev := o.refund
+	o.journal = append(o.journal, func() { o.refund = prev })
+	o.refund += gas
+}
+
+func (o *OverlayStateDB) SubRefund(gas uint64) {
+	prev := o.refund
+	o.journal = append(o.journal, func() { o.refund = prev })
+	if gas > o.refund {
+		panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", gas, o.refund))
+	}
+	o.refund -= gas
+}
+
+func (o *OverlayStateDB) GetRefund() uint64 {
+	return o.refund
+}
+
+// GetCommittedState returns the committed value of the slot in the base state.
+// The txns of a block are merged into the base without being finalised, so it is
+// the value at the start of the block, as in the serial execution.
+func (o *OverlayStateDB) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
+	if acc, ok := o.accounts[addr]; ok && acc.created {
+		return common.Hash{}
+	}
+	o.baseMu.Lock()
+	defer o.baseMu.Unlock()
+	return o.base.GetCommittedState(addr, key)
+}
+
+func (o *OverlayStateDB) GetState(addr common.Address, key common.Hash) common.Hash {
+	if acc, ok := o.accounts[addr]; ok {
+		if value, ok := acc.storage[key]; ok {
+			return value
+		}
+		if acc.created {
+			return common.Hash{}
+		}
+	}
+	o.baseMu.Lock()
+	defer o.baseMu.Unlock()
+	return o.base.GetState(addr, key)
+}
+
+func (o *OverlayStateDB) SetState(addr common.Address, key common.Hash, value common.Hash) {
+	acc := o.mutable(addr)
+	storage := acc.storage
+	prev, dirty := storage[key]
+	o.journal = append(o.journal, func() {
+		if dirty {
+			storage[key] = prev
+		} else {
+			delete(storage, key)
+		}
+	})
+	storage[key] = value
+}
+
+func (o *OverlayStateDB) GetStorageRoot(addr common.Address) common.Hash {
+	if acc, ok := o.accounts[addr]; ok && acc.created {
+		return types.EmptyRootHash
+	}
+	o.baseMu.Lock()
+	defer o.baseMu.Unlock()
+	return o.base.GetStorageRoot(addr)
+}
+
+func (o *OverlayStateDB) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return o.transient[addr][key]
+}
+
+func (o *OverlayStateDB) SetTransientState(addr common.Address, key, value common.Hash) {
+	prev := o.GetTransientState(addr, key)
+	if prev == value {
+		return
+	}
+	o.journal = append(o.journal, func() { o.setTransientState(addr, key, prev) })
+	o.setTransientState(addr, key, value)
+}
+
+func (o *OverlayStateDB) setTransientState(addr common.Address, key, value common.Hash) {
+	slots, ok := o.transient[addr]
+	if !ok {
+		slots = make(map[common.Hash]common.Hash)
+		o.transient[addr] = slots
+	}
+	slots[key] = value
+}
+
+func (o *OverlayStateDB) SelfDestruct(addr common.Address) {
+	if !o.account(addr).exist {
+		return
+	}
+	acc := o.mutable(addr)
+	acc.selfDestructed = true
+	acc.balance = new(uint256.Int)
+	acc.balanceDirty = true
+}
+
+func (o *OverlayStateDB) HasSelfDestructed(addr common.Address) bool {
+	return o.account(addr).selfDestructed
+}
+
+func (o *OverlayStateDB) Selfdestruct6780(addr common.Address) {
+	acc := o.account(addr)
+	if acc.exist && acc.created {
+		o.SelfDestruct(addr)
+	}
+}
+
+func (o *OverlayStateDB) Exist(addr common.Address) bool {
+	return o.account(addr).exist
+}
+
+func (o *OverlayStateDB) Empty(addr common.Address) bool {
+	acc := o.account(addr)
+	return !acc.exist || (acc.nonce == 0 && acc.balance.IsZero() && acc.codeHash == types.EmptyCodeHash)
+}
+
+func (o *OverlayStateDB) AddressInAccessList(addr common.Address) bool {
+	_, ok := o.alAddrs[addr]
+	return ok
+}
+
+func (o *OverlayStateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	_, addressOk = o.alAddrs[addr]
+	_, slotOk = o.alSlots[addr][slot]
+	return addressOk, slotOk
+}
+
+func (o *OverlayStateDB) AddAddressToAccessList(addr common.Address) {
+	if o.AddressInAccessList(addr) {
+		return
+	}
+	o.journal = append(o.journal, func() { delete(o.alAddrs, addr) })
+	o.alAddrs[addr] = struct{}{}
+}
+
+func (o *OverlayStateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	o.AddAddressToAccessList(addr)
+	if _, ok := o.alSlots[addr][slot]; ok {
+		return
+	}
+	slots, ok := o.alSlots[addr]
+	if !ok {
+		slots = make(map[common.Hash]struct{})
+		o.alSlots[addr] = slots
+	}
+	o.journal = append(o.journal, func() { delete(slots, slot) })
+	slots[slot] = struct{}{}
+}
+
+// Prepare resets the access list and the transient storage, the same as
+// state.StateDB.Prepare does.
+func (o *OverlayStateDB) Prepare(rules params.Rules, sender, coinbase common.Address, dest *common.Address, precompiles []common.Address, txAccesses types.AccessList) {
+	if rules.IsBerlin {
+		o.alAddrs = make(map[common.Address]struct{})
+		o.alSlots = make(map[common.Address]map[common.Hash]struct{})
+		o.AddAddressToAccessList(sender)
+		if dest != nil {
+			o.AddAddressToAccessList(*dest)
+		}
+		for _, addr := range precompiles {
+			o.AddAddressToAccessList(addr)
+		}
+		for _, el := range txAccesses {
+			o.AddAddressToAccessList(el.Address)
+			for _, key := range el.StorageKeys {
+				o.AddSlotToAccessList(el.Address, key)
+			}
+		}
+		if rules.IsShanghai {
+			o.AddAddressToAccessList(coinbase)
+		}
+	}
+	o.transient = make(map[common.Address]map[common.Hash]common.Hash)
+}
+
+func (o *OverlayStateDB) RevertToSnapshot(revid int) {
+	if revid < 0 || revid > len(o.journal) {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	for i := len(o.journal) - 1; i >= revid; i-- {
+		o.journal[i]()
+	}
+	o.journal = o.journal[:revid]
+}
+
+func (o *OverlayStateDB) Snapshot() int {
+	return len(o.journal)
+}
+
+func (o *OverlayStateDB) AddLog(log *types.Log) {
+	thash := o.thash
+	o.journal = append(o.journal, func() {
+		logs := o.logs[thash]
+		if len(logs) == 1 {
+			delete(o.logs, thash)
+		} else {
+			o.logs[thash] = logs[:len(logs)-1]
+		}
+		o.logSize--
+	})
+	log.TxHash = o.thash
+	log.TxIndex = uint(o.txIndex)
+	log.Index = o.logSize
+	o.logs[thash] = append(o.logs[thash], log)
+	o.logSize++
+}
+
+func (o *OverlayStateDB) GetLogs(hash common.Hash, blockNumber uint64, blockHash common.Hash) []*types.Log {
+	logs := o.logs[hash]
+	for _, l := range logs {
+		l.BlockNumber = blockNumber
+		l.BlockHash = blockHash
+	}
+	return logs
+}
+
+func (o *OverlayStateDB) AddPreimage(hash common.Hash, preimage []byte) {
+	if _, ok := o.preimages[hash]; !ok {
+		pi := make([]byte, len(preimage))
+		copy(pi, preimage)
+		o.preimages[hash] = pi
+	}
+}
+
+func (o *OverlayStateDB) Preimages() map[common.Hash][]byte {
+	return o.preimages
+}
+
+func (o *OverlayStateDB) SetTxContext(thash common.Hash, ti int) {
+	o.thash = thash
+	o.txIndex = ti
+}
+
+// MergeInto applies the writes of the overlay to stateDB.
+func (o *OverlayStateDB) MergeInto(stateDB *state.StateDB) {
+	for addr, acc := range o.accounts {
+		if acc.created {
+			stateDB.CreateAccount(addr)
+		}
+		if acc.balanceDirty {
+			stateDB.SetBalance(addr, acc.balance, tracing.BalanceChangeTransfer)
+		}
+		if acc.nonceDirty {
+			stateDB.SetNonce(addr, acc.nonce)
+		}
+		if acc.codeDirty {
+			stateDB.SetCode(addr, acc.code)
+		}
+		for key, value := range acc.storage {
+			stateDB.SetState(addr, key, value)
+		}
+		if acc.selfDestructed {
+			stateDB.SelfDestruct(addr)
+		}
+	}
+}
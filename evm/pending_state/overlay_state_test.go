@@ -0,0 +1,224 @@
+package pending_state
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+func TestOverlayStateDB(t *testing.T) {
+	base, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb0")
+	slot := common.HexToHash("0x01")
+	base.SetBalance(alice, uint256.NewInt(100), tracing.BalanceChangeUnspecified)
+	base.SetState(alice, slot, common.HexToHash("0x02"))
+
+	overlay := NewOverlayStateDB(base, &sync.Mutex{})
+	if overlay.GetBalance(alice).Uint64() != 100 || overlay.GetState(alice, slot) != common.HexToHash("0x02") {
+		t.Fatalf("Expected overlay to read through to the base")
+	}
+
+	overlay.SubBalance(alice, uint256.NewInt(10), tracing.BalanceChangeTransfer)
+	snap := overlay.Snapshot()
+	overlay.AddBalance(bob, uint256.NewInt(10), tracing.BalanceChangeTransfer)
+	overlay.SetState(alice, slot, common.HexToHash("0x03"))
+	overlay.RevertToSnapshot(snap)
+	if overlay.Exist(bob) || overlay.GetState(alice, slot) != common.HexToHash("0x02") {
+		t.Fatalf("Expected changes after the snapshot to be reverted")
+	}
+	overlay.AddBalance(bob, uint256.NewInt(10), tracing.BalanceChangeTransfer)
+	overlay.SetNonce(alice, 1)
+	if base.GetBalance(alice).Uint64() != 100 || base.Exist(bob) {
+		t.Fatalf("Expected the base to be untouched before merge")
+	}
+
+	overlay.MergeInto(base)
+	if base.GetBalance(alice).Uint64() != 90 || base.GetBalance(bob).Uint64() != 10 || base.GetNonce(alice) != 1 {
+		t.Fatalf("Expected overlay writes to be merged into the base")
+	}
+	if base.GetState(alice, slot) != common.HexToHash("0x02") {
+		t.Fatalf("Expected untouched slot to keep its value")
+	}
+}
+
+func newTestOverlayBase(t *testing.T) *state.StateDB {
+	base, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return base
+}
+
+func TestOverlayReadAfterWrite(t *testing.T) {
+	base := newTestOverlayBase(t)
+	alice := common.HexToAddress("0xa1")
+	slot := common.HexToHash("0x01")
+	base.SetBalance(alice, uint256.NewInt(100), tracing.BalanceChangeUnspecified)
+	base.SetState(alice, slot, common.HexToHash("0x02"))
+	base.Finalise(true)
+
+	baseMu := &sync.Mutex{}
+	overlay := NewOverlayStateDB(base, baseMu)
+	code := []byte{0x60, 0x00}
+	overlay.AddBalance(alice, uint256.NewInt(5), tracing.BalanceChangeTransfer)
+	overlay.SetNonce(alice, 3)
+	overlay.SetCode(alice, code)
+	overlay.SetState(alice, slot, common.HexToHash("0x03"))
+	if overlay.GetBalance(alice).Uint64() != 105 || overlay.GetNonce(alice) != 3 {
+		t.Fatalf("Expected the overlay to read its own writes, but got balance %v nonce %d",
+			overlay.GetBalance(alice), overlay.GetNonce(alice))
+	}
+	if string(overlay.GetCode(alice)) != string(code) || overlay.GetCodeHash(alice) != crypto.Keccak256Hash(code) {
+		t.Fatalf("Expected the overlay to read its own code, but got %x", overlay.GetCode(alice))
+	}
+	if overlay.GetState(alice, slot) != common.HexToHash("0x03") {
+		t.Fatalf("Expected the overlay to read its own slot, but got %v", overlay.GetState(alice, slot))
+	}
+	if overlay.GetCommittedState(alice, slot) != common.HexToHash("0x02") {
+		t.Fatalf("Expected the committed slot to be the base one, but got %v", overlay.GetCommittedState(alice, slot))
+	}
+	// a merged txn is not finalised, the committed slot stays the one at the start of the block.
+	base.SetState(alice, slot, common.HexToHash("0x04"))
+	if overlay.GetCommittedState(alice, slot) != common.HexToHash("0x02") {
+		t.Fatalf("Expected the committed slot to be the finalised one, but got %v", overlay.GetCommittedState(alice, slot))
+	}
+	base.SetState(alice, slot, common.HexToHash("0x02"))
+
+	other := NewOverlayStateDB(base, baseMu)
+	if other.GetBalance(alice).Uint64() != 100 || other.GetNonce(alice) != 0 || other.GetState(alice, slot) != common.HexToHash("0x02") {
+		t.Fatalf("Expected the writes of an overlay to be invisible to the other overlays")
+	}
+	if base.GetBalance(alice).Uint64() != 100 || base.GetCodeSize(alice) != 0 {
+		t.Fatalf("Expected the base to be untouched before merge")
+	}
+}
+
+func TestOverlaySnapshotRevert(t *testing.T) {
+	base := newTestOverlayBase(t)
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb0")
+	slot := common.HexToHash("0x01")
+	base.SetBalance(alice, uint256.NewInt(100), tracing.BalanceChangeUnspecified)
+	base.SetState(alice, slot, common.HexToHash("0x02"))
+
+	overlay := NewOverlayStateDB(base, &sync.Mutex{})
+	overlay.SetTxContext(common.HexToHash("0x10"), 0)
+	outer := overlay.Snapshot()
+	overlay.SetState(alice, slot, common.HexToHash("0x03"))
+	overlay.AddRefund(10)
+	overlay.AddLog(&types.Log{Address: alice})
+
+	inner := overlay.Snapshot()
+	overlay.CreateAccount(bob)
+	overlay.SetCode(bob, []byte{0x60, 0x00})
+	overlay.SetState(alice, slot, common.HexToHash("0x04"))
+	overlay.SetTransientState(alice, slot, common.HexToHash("0x05"))
+	overlay.AddSlotToAccessList(bob, slot)
+	overlay.AddLog(&types.Log{Address: bob})
+
+	overlay.RevertToSnapshot(inner)
+	if overlay.Exist(bob) || overlay.GetCodeSize(bob) != 0 {
+		t.Fatalf("Expected the account created after the inner snapshot to be reverted")
+	}
+	if overlay.GetState(alice, slot) != common.HexToHash("0x03") {
+		t.Fatalf("Expected the slot of the outer snapshot, but got %v", overlay.GetState(alice, slot))
+	}
+	if overlay.GetTransientState(alice, slot) != (common.Hash{}) || overlay.AddressInAccessList(bob) {
+		t.Fatalf("Expected the transient state and the access list to be reverted")
+	}
+	if logs := overlay.GetLogs(common.HexToHash("0x10"), 1, common.Hash{}); len(logs) != 1 || logs[0].Address != alice {
+		t.Fatalf("Expected the log of the outer snapshot only, but got %v", logs)
+	}
+	if overlay.GetRefund() != 10 {
+		t.Fatalf("Expected refund 10, but got %d", overlay.GetRefund())
+	}
+
+	overlay.RevertToSnapshot(outer)
+	if overlay.GetState(alice, slot) != common.HexToHash("0x02") || overlay.GetRefund() != 0 {
+		t.Fatalf("Expected the base values after reverting the outer snapshot")
+	}
+	if logs := overlay.GetLogs(common.HexToHash("0x10"), 1, common.Hash{}); len(logs) != 0 {
+		t.Fatalf("Expected no logs, but got %v", logs)
+	}
+
+	overlay.MergeInto(base)
+	if base.GetState(alice, slot) != common.HexToHash("0x02") || base.Exist(bob) {
+		t.Fatalf("Expected the reverted writes not to be merged")
+	}
+}
+
+func TestOverlayDeletions(t *testing.T) {
+	base := newTestOverlayBase(t)
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb0")
+	carol := common.HexToAddress("0xc0")
+	slot := common.HexToHash("0x01")
+	for _, addr := range []common.Address{alice, bob, carol} {
+		base.SetBalance(addr, uint256.NewInt(100), tracing.BalanceChangeUnspecified)
+		base.SetState(addr, slot, common.HexToHash("0x02"))
+	}
+	base.Finalise(true)
+
+	overlay := NewOverlayStateDB(base, &sync.Mutex{})
+	// alice clears a slot of the base
+	overlay.SetState(alice, slot, common.Hash{})
+	if overlay.GetState(alice, slot) != (common.Hash{}) {
+		t.Fatalf("Expected the cleared slot to read zero, but got %v", overlay.GetState(alice, slot))
+	}
+	// bob is recreated, the storage of the base is not visible any more
+	overlay.CreateAccount(bob)
+	if overlay.GetState(bob, slot) != (common.Hash{}) || overlay.GetCommittedState(bob, slot) != (common.Hash{}) {
+		t.Fatalf("Expected the storage of the recreated account to be empty")
+	}
+	if overlay.GetStorageRoot(bob) != types.EmptyRootHash {
+		t.Fatalf("Expected the empty storage root, but got %v", overlay.GetStorageRoot(bob))
+	}
+	if overlay.GetBalance(bob).Uint64() != 100 {
+		t.Fatalf("Expected the balance to be carried over, but got %v", overlay.GetBalance(bob))
+	}
+	// carol self destructs
+	overlay.SelfDestruct(carol)
+	if !overlay.HasSelfDestructed(carol) || !overlay.GetBalance(carol).IsZero() {
+		t.Fatalf("Expected carol to be self destructed with no balance")
+	}
+	if base.GetState(alice, slot) != common.HexToHash("0x02") || base.GetState(bob, slot) != common.HexToHash("0x02") || !base.Exist(carol) {
+		t.Fatalf("Expected the base to be untouched before merge")
+	}
+
+	overlay.MergeInto(base)
+	base.Finalise(true)
+	if base.GetState(alice, slot) != (common.Hash{}) {
+		t.Fatalf("Expected the cleared slot to be merged, but got %v", base.GetState(alice, slot))
+	}
+	if base.GetState(bob, slot) != (common.Hash{}) || base.GetBalance(bob).Uint64() != 100 {
+		t.Fatalf("Expected the recreated account to be merged with an empty storage")
+	}
+	if base.Exist(carol) {
+		t.Fatalf("Expected the self destructed account to be deleted")
+	}
+}
+
+func TestStateDBWrapperOverlay(t *testing.T) {
+	base := newTestOverlayBase(t)
+	if db, err := NewStateDBWrapper(base).GetStateDB(); err != nil || db != base {
+		t.Fatalf("Expected the wrapped StateDB, but got %v", err)
+	}
+	wrapper := NewOverlayStateDBWrapper(NewOverlayStateDB(base, &sync.Mutex{}))
+	if _, err := wrapper.GetStateDB(); err != ErrOverlayStateDB {
+		t.Fatalf("Expected ErrOverlayStateDB, but got %v", err)
+	}
+	if _, ok := wrapper.GetOverlay(); !ok {
+		t.Fatalf("Expected the overlay")
+	}
+}
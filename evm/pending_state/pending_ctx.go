@@ -34,21 +34,10 @@ func NewStateContext(needCheck bool) *StateContext {
 }
 
 func (sctx *StateContext) IsConflict(tar *StateContext) bool {
-	if len(sctx.GetWriteState()) < 1 && len(sctx.GetWriteAddress()) < 1 &&
-		len(sctx.GetReadState()) < 1 && len(sctx.GetReadAddress()) < 1 {
-		return false
-	}
-	// write/write conflict of Address
-	if IsAddressConflict(sctx.GetWriteAddress(), tar.GetWriteAddress()) {
-		return true
-	}
-	// read/write conflict of Address
-	if IsAddressConflict(sctx.GetReadAddress(), tar.GetWriteAddress()) {
-		return true
-	}
-	// read/write conflict of Address
-	if IsAddressConflict(sctx.GetWriteAddress(), tar.GetReadAddress()) {
-		return true
+	for _, pair := range sctx.addressConflictPairs(tar) {
+		if IsAddressConflict(pair[0], pair[1]) {
+			return true
+		}
 	}
 
 	// write/write conflict of (Address, StateKey)
@@ -66,6 +55,60 @@ func (sctx *StateContext) IsConflict(tar *StateContext) bool {
 	return false
 }
 
+// addressConflictPairs returns the pairs of the address sets of sctx and tar which
+// conflict when they share an address. The balance, the nonce and the code conflict
+// on a write of either side. The account is created or destructed as a whole, so
+// writing it conflicts with any visit of the address, and reading its existence or
+// emptiness conflicts with a write of any field of it.
+func (sctx *StateContext) addressConflictPairs(tar *StateContext) [][2]map[common.Address]VisitTxnID {
+	pairs := make([][2]map[common.Address]VisitTxnID, 0)
+	readWrite := func(read, write, tarRead, tarWrite map[common.Address]VisitTxnID) {
+		pairs = append(pairs,
+			[2]map[common.Address]VisitTxnID{write, tarWrite},
+			[2]map[common.Address]VisitTxnID{read, tarWrite},
+			[2]map[common.Address]VisitTxnID{write, tarRead},
+		)
+	}
+	readWrite(sctx.GetReadAddress(), sctx.GetWriteAddress(), tar.GetReadAddress(), tar.GetWriteAddress())
+	readWrite(sctx.GetReadNonce(), sctx.GetWriteNonce(), tar.GetReadNonce(), tar.GetWriteNonce())
+	readWrite(sctx.GetReadBalance(), sctx.GetWriteBalance(), tar.GetReadBalance(), tar.GetWriteBalance())
+	readWrite(sctx.GetReadCode(), sctx.GetWriteCode(), tar.GetReadCode(), tar.GetWriteCode())
+	readWrite(sctx.GetReadAccount(), sctx.GetWriteAccount(), tar.GetReadAccount(), tar.GetWriteAccount())
+
+	fieldWrites := func(c *StateContext) []map[common.Address]VisitTxnID {
+		return []map[common.Address]VisitTxnID{c.GetWriteBalance(), c.GetWriteNonce(), c.GetWriteCode(), stateAddresses(c.GetWriteState())}
+	}
+	fieldReads := func(c *StateContext) []map[common.Address]VisitTxnID {
+		return []map[common.Address]VisitTxnID{c.GetReadBalance(), c.GetReadNonce(), c.GetReadCode(), stateAddresses(c.GetReadState())}
+	}
+	for _, fields := range [][]map[common.Address]VisitTxnID{fieldWrites(tar), fieldReads(tar)} {
+		for _, field := range fields {
+			pairs = append(pairs, [2]map[common.Address]VisitTxnID{sctx.GetWriteAccount(), field})
+		}
+	}
+	for _, fields := range [][]map[common.Address]VisitTxnID{fieldWrites(sctx), fieldReads(sctx)} {
+		for _, field := range fields {
+			pairs = append(pairs, [2]map[common.Address]VisitTxnID{field, tar.GetWriteAccount()})
+		}
+	}
+	for _, field := range fieldWrites(tar) {
+		pairs = append(pairs, [2]map[common.Address]VisitTxnID{sctx.GetReadAccount(), field})
+	}
+	for _, field := range fieldWrites(sctx) {
+		pairs = append(pairs, [2]map[common.Address]VisitTxnID{field, tar.GetReadAccount()})
+	}
+	return pairs
+}
+
+// stateAddresses returns the addresses of the visited slots.
+func stateAddresses(m map[common.Address]map[common.Hash]VisitTxnID) map[common.Address]VisitTxnID {
+	addrs := make(map[common.Address]VisitTxnID, len(m))
+	for addr := range m {
+		addrs[addr] = nil
+	}
+	return addrs
+}
+
 func (sctx *StateContext) GetReadState() map[common.Address]map[common.Hash]VisitTxnID {
 	sctx.RLock()
 	defer sctx.RUnlock()
@@ -102,6 +145,78 @@ func (sctx *StateContext) GetReadAddress() map[common.Address]VisitTxnID {
 	return sctx.Read.Address
 }
 
+func (sctx *StateContext) GetWriteNonce() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Write.Nonce
+}
+
+func (sctx *StateContext) GetReadNonce() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Read.Nonce
+}
+
+func (sctx *StateContext) GetWriteBalance() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Write.Balance
+}
+
+func (sctx *StateContext) GetReadBalance() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Read.Balance
+}
+
+func (sctx *StateContext) GetWriteCode() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Write.Code
+}
+
+func (sctx *StateContext) GetReadCode() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Read.Code
+}
+
+func (sctx *StateContext) GetWriteAccount() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Write.Account
+}
+
+func (sctx *StateContext) GetReadAccount() map[common.Address]VisitTxnID {
+	sctx.RLock()
+	defer sctx.RUnlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	return sctx.Read.Account
+}
+
 func (sctx *StateContext) AddSlot2Address(slot slotToAddress) {
 	sctx.Lock()
 	defer sctx.Unlock()
@@ -164,6 +279,22 @@ func (sctx *StateContext) WriteAccount(addr common.Address, txnID int64) error {
 	return nil
 }
 
+// ReadAccount visits the existence or the emptiness of the account, which depend on
+// all the fields of it.
+func (sctx *StateContext) ReadAccount(addr common.Address, txnID int64) error {
+	sctx.Lock()
+	defer sctx.Unlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	if sctx.needCheck && sctx.ReadConflict(addr, txnID) {
+		sctx.meetConflict = true
+		return fmt.Errorf("conflict")
+	}
+	sctx.Read.VisitAccount(addr, txnID)
+	return nil
+}
+
 func (sctx *StateContext) WriteBalance(addr common.Address, txnID int64) error {
 	sctx.Lock()
 	defer sctx.Unlock()
@@ -192,6 +323,34 @@ func (sctx *StateContext) ReadBalance(addr common.Address, txnID int64) error {
 	return nil
 }
 
+func (sctx *StateContext) WriteNonce(addr common.Address, txnID int64) error {
+	sctx.Lock()
+	defer sctx.Unlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	if sctx.needCheck && sctx.WriteConflict(addr, txnID) {
+		sctx.meetConflict = true
+		return fmt.Errorf("conflict")
+	}
+	sctx.Write.VisitNonce(addr, txnID)
+	return nil
+}
+
+func (sctx *StateContext) ReadNonce(addr common.Address, txnID int64) error {
+	sctx.Lock()
+	defer sctx.Unlock()
+	if sctx.needCheck && sctx.meetConflict {
+		panic(errors.New("meet conflict already"))
+	}
+	if sctx.needCheck && sctx.ReadConflict(addr, txnID) {
+		sctx.meetConflict = true
+		return fmt.Errorf("conflict")
+	}
+	sctx.Read.VisitNonce(addr, txnID)
+	return nil
+}
+
 func (sctx *StateContext) WriteCode(addr common.Address, txnID int64) error {
 	sctx.Lock()
 	defer sctx.Unlock()
@@ -253,6 +412,7 @@ type VisitedAddress struct {
 	Address map[common.Address]VisitTxnID
 	Account map[common.Address]VisitTxnID
 	Balance map[common.Address]VisitTxnID
+	Nonce   map[common.Address]VisitTxnID
 	Code    map[common.Address]VisitTxnID
 	State   map[common.Address]map[common.Hash]VisitTxnID
 }
@@ -262,6 +422,7 @@ func NewVisitedAddress() *VisitedAddress {
 		Address: make(map[common.Address]VisitTxnID),
 		Account: make(map[common.Address]VisitTxnID),
 		Balance: make(map[common.Address]VisitTxnID),
+		Nonce:   make(map[common.Address]VisitTxnID),
 		Code:    make(map[common.Address]VisitTxnID),
 		State:   make(map[common.Address]map[common.Hash]VisitTxnID),
 	}
@@ -283,6 +444,10 @@ func (v *VisitedAddress) GetBalanceVisitedTxn(addr common.Address) VisitTxnID {
 	return v.Balance[addr]
 }
 
+func (v *VisitedAddress) VisitNonce(addr common.Address, txnID int64) {
+	v.Nonce = txnVisitAddrMap(v.Nonce, addr, txnID)
+}
+
 func (v *VisitedAddress) VisitCode(addr common.Address, txnID int64) {
 	v.Code = txnVisitAddrMap(v.Code, addr, txnID)
 }
@@ -379,3 +544,85 @@ func txnVisitHashMap(m map[common.Hash]VisitTxnID, hash common.Hash, txnID int64
 	m[hash][txnID] = struct{}{}
 	return m
 }
+
+// ConflictKey is an address, or a storage slot of an address, which is
+// visited by two conflicting txns.
+type ConflictKey struct {
+	Address common.Address
+	Slot    common.Hash
+	IsSlot  bool
+}
+
+// ConflictKeys returns the keys which make sctx and tar conflict, they are
+// checked the same way as IsConflict.
+func (sctx *StateContext) ConflictKeys(tar *StateContext) []ConflictKey {
+	keys := make([]ConflictKey, 0)
+	seen := make(map[ConflictKey]struct{})
+	add := func(key ConflictKey) {
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	addressPairs := sctx.addressConflictPairs(tar)
+	for _, pair := range addressPairs {
+		for addr := range pair[0] {
+			if _, ok := pair[1][addr]; ok {
+				add(ConflictKey{Address: addr})
+			}
+		}
+	}
+	statePairs := [][2]map[common.Address]map[common.Hash]VisitTxnID{
+		{sctx.GetWriteState(), tar.GetWriteState()},
+		{sctx.GetReadState(), tar.GetWriteState()},
+		{sctx.GetWriteState(), tar.GetReadState()},
+	}
+	for _, pair := range statePairs {
+		for addr, slots := range pair[0] {
+			tarSlots, ok := pair[1][addr]
+			if !ok {
+				continue
+			}
+			for slot := range slots {
+				if _, ok := tarSlots[slot]; ok {
+					add(ConflictKey{Address: addr, Slot: slot, IsSlot: true})
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// Merge adds the read and write sets of tar into sctx.
+func (sctx *StateContext) Merge(tar *StateContext) {
+	sctx.Lock()
+	defer sctx.Unlock()
+	tar.RLock()
+	defer tar.RUnlock()
+	sctx.Read.Merge(tar.Read)
+	sctx.Write.Merge(tar.Write)
+}
+
+func (v *VisitedAddress) Merge(tar *VisitedAddress) {
+	mergeAddr := func(m, t map[common.Address]VisitTxnID) map[common.Address]VisitTxnID {
+		for addr, ids := range t {
+			for id := range ids {
+				m = txnVisitAddrMap(m, addr, id)
+			}
+		}
+		return m
+	}
+	v.Address = mergeAddr(v.Address, tar.Address)
+	v.Account = mergeAddr(v.Account, tar.Account)
+	v.Balance = mergeAddr(v.Balance, tar.Balance)
+	v.Nonce = mergeAddr(v.Nonce, tar.Nonce)
+	v.Code = mergeAddr(v.Code, tar.Code)
+	for addr, slots := range tar.State {
+		for slot, ids := range slots {
+			for id := range ids {
+				v.VisitState(addr, slot, id)
+			}
+		}
+	}
+}
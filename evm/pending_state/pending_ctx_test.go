@@ -0,0 +1,125 @@
+package pending_state
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestStateContextNonceConflict(t *testing.T) {
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb0")
+
+	first := NewStateContext(false)
+	if err := first.ReadNonce(alice, 1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := first.WriteNonce(alice, 1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	other := NewStateContext(false)
+	if err := other.ReadNonce(bob, 2); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if first.IsConflict(other) {
+		t.Fatalf("Expected txns of different origins not to conflict")
+	}
+
+	same := NewStateContext(false)
+	if err := same.ReadNonce(alice, 3); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !first.IsConflict(same) {
+		t.Fatalf("Expected txns of the same origin to conflict on the nonce")
+	}
+	keys := first.ConflictKeys(same)
+	if len(keys) != 1 || keys[0] != (ConflictKey{Address: alice}) {
+		t.Fatalf("Expected the origin to be the conflict key, but got %v", keys)
+	}
+}
+
+func TestStateContextBalanceConflict(t *testing.T) {
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb0")
+
+	first := NewStateContext(false)
+	if err := first.WriteBalance(alice, 1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	other := NewStateContext(false)
+	if err := other.WriteBalance(bob, 2); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if first.IsConflict(other) {
+		t.Fatalf("Expected the balances of different accounts not to conflict")
+	}
+
+	same := NewStateContext(false)
+	if err := same.ReadBalance(alice, 3); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !first.IsConflict(same) || !same.IsConflict(first) {
+		t.Fatalf("Expected the read and the write of a balance to conflict")
+	}
+	keys := first.ConflictKeys(same)
+	if len(keys) != 1 || keys[0] != (ConflictKey{Address: alice}) {
+		t.Fatalf("Expected the account to be the conflict key, but got %v", keys)
+	}
+
+	code := NewStateContext(false)
+	if err := code.WriteCode(bob, 4); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	reader := NewStateContext(false)
+	if err := reader.ReadCode(bob, 5); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !code.IsConflict(reader) || len(code.ConflictKeys(reader)) != 1 {
+		t.Fatalf("Expected the read and the write of a code to conflict")
+	}
+}
+
+func TestStateContextAccountConflict(t *testing.T) {
+	alice := common.HexToAddress("0xa1")
+	slot := common.HexToHash("0x01")
+
+	// Exist and Empty read the account, a funding of it changes them.
+	checker := NewStateContext(false)
+	if err := checker.ReadAccount(alice, 1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	funder := NewStateContext(false)
+	if err := funder.WriteBalance(alice, 2); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !checker.IsConflict(funder) || !funder.IsConflict(checker) {
+		t.Fatalf("Expected the read of the account to conflict with the write of its balance")
+	}
+	if keys := funder.ConflictKeys(checker); len(keys) != 1 || keys[0] != (ConflictKey{Address: alice}) {
+		t.Fatalf("Expected the account to be the conflict key, but got %v", keys)
+	}
+	reader := NewStateContext(false)
+	if err := reader.ReadBalance(alice, 3); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if checker.IsConflict(reader) {
+		t.Fatalf("Expected the reads of an account not to conflict")
+	}
+
+	// a destructed account conflicts with the reads of its storage.
+	destructor := NewStateContext(false)
+	if err := destructor.SelfDestruct(alice, 4); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	slotReader := NewStateContext(false)
+	if err := slotReader.ReadState(alice, slot, 5); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !destructor.IsConflict(slotReader) || !slotReader.IsConflict(destructor) {
+		t.Fatalf("Expected the write of the account to conflict with the read of its slot")
+	}
+	if keys := slotReader.ConflictKeys(destructor); len(keys) != 1 || keys[0] != (ConflictKey{Address: alice}) {
+		t.Fatalf("Expected the account to be the conflict key, but got %v", keys)
+	}
+}
@@ -55,10 +55,16 @@ func (psw *PendingStateWrapper) GetBalance(address common.Address) *uint256.Int
 }
 
 func (psw *PendingStateWrapper) GetNonce(address common.Address) uint64 {
+	if err := psw.sCtx.ReadNonce(address, psw.TxnID); err != nil {
+		panic(err)
+	}
 	return psw.statedb.GetNonce(address)
 }
 
 func (psw *PendingStateWrapper) SetNonce(address common.Address, u uint64) {
+	if err := psw.sCtx.WriteNonce(address, psw.TxnID); err != nil {
+		panic(err)
+	}
 	psw.statedb.SetNonce(address, u)
 }
 
@@ -103,6 +109,9 @@ func (psw *PendingStateWrapper) GetRefund() uint64 {
 }
 
 func (psw *PendingStateWrapper) GetCommittedState(address common.Address, hash common.Hash) common.Hash {
+	if err := psw.sCtx.ReadState(address, hash, psw.TxnID); err != nil {
+		panic(err)
+	}
 	return psw.statedb.GetCommittedState(address, hash)
 }
 
@@ -140,6 +149,9 @@ func (psw *PendingStateWrapper) SelfDestruct(address common.Address) {
 }
 
 func (psw *PendingStateWrapper) HasSelfDestructed(address common.Address) bool {
+	if err := psw.sCtx.ReadAccount(address, psw.TxnID); err != nil {
+		panic(err)
+	}
 	return psw.statedb.HasSelfDestructed(address)
 }
 
@@ -151,10 +163,16 @@ func (psw *PendingStateWrapper) Selfdestruct6780(address common.Address) {
 }
 
 func (psw *PendingStateWrapper) Exist(address common.Address) bool {
+	if err := psw.sCtx.ReadAccount(address, psw.TxnID); err != nil {
+		panic(err)
+	}
 	return psw.statedb.Exist(address)
 }
 
 func (psw *PendingStateWrapper) Empty(address common.Address) bool {
+	if err := psw.sCtx.ReadAccount(address, psw.TxnID); err != nil {
+		panic(err)
+	}
 	return psw.statedb.Empty(address)
 }
 
@@ -205,10 +223,14 @@ func (psw *PendingStateWrapper) SetTxContext(txHash common.Hash, txIndex int) {
 	psw.statedb.SetTxContext(txHash, txIndex)
 }
 
-func (psw *PendingStateWrapper) GetStateDB() *state.StateDB {
+func (psw *PendingStateWrapper) GetStateDB() (*state.StateDB, error) {
 	return psw.statedb.GetStateDB()
 }
 
+func (psw *PendingStateWrapper) GetLogs(hash common.Hash, blockNumber uint64, blockHash common.Hash) []*types.Log {
+	return psw.statedb.GetLogs(hash, blockNumber, blockHash)
+}
+
 func (psw *PendingStateWrapper) GetCtx() *StateContext {
 	return psw.sCtx
 }
@@ -222,14 +244,35 @@ func (psw *PendingStateWrapper) MergeInto(stateDB *state.StateDB, sender common.
 		pre := psw.sCtx.prepareParams
 		stateDB.Prepare(pre.rules, pre.sender, pre.coinbase, pre.dest, pre.precompiles, pre.txAccesses)
 	}
+	if overlay, ok := psw.statedb.GetOverlay(); ok {
+		overlay.MergeInto(stateDB)
+	} else {
+		psw.mergeWritesInto(stateDB, sender)
+	}
+	for _, addr := range psw.sCtx.addAddressToList {
+		stateDB.AddAddressToAccessList(addr)
+	}
+	for _, sd := range psw.sCtx.addSlotToAddress {
+		stateDB.AddSlotToAccessList(sd.addr, sd.slot)
+	}
+	for _, log := range psw.AllLogs() {
+		stateDB.AddLog(log)
+	}
+	for hash, bs := range psw.statedb.AllPreimages() {
+		stateDB.AddPreimage(hash, bs)
+	}
+}
+
+func (psw *PendingStateWrapper) mergeWritesInto(stateDB *state.StateDB, sender common.Address) {
 	for addr := range psw.sCtx.Write.Account {
 		if psw.statedb.Exist(addr) {
 			stateDB.CreateAccount(addr)
 		}
 	}
-
 	stateDB.SetNonce(sender, psw.statedb.GetNonce(sender))
-
+	for addr := range psw.sCtx.Write.Nonce {
+		stateDB.SetNonce(addr, psw.statedb.GetNonce(addr))
+	}
 	for addr := range psw.sCtx.Write.Balance {
 		stateDB.SetBalance(addr, psw.statedb.GetBalance(addr), tracing.BalanceChangeTransfer)
 	}
@@ -241,16 +284,4 @@ func (psw *PendingStateWrapper) MergeInto(stateDB *state.StateDB, sender common.
 			stateDB.SetState(addr, key, psw.statedb.GetState(addr, key))
 		}
 	}
-	for _, addr := range psw.sCtx.addAddressToList {
-		stateDB.AddAddressToAccessList(addr)
-	}
-	for _, sd := range psw.sCtx.addSlotToAddress {
-		stateDB.AddSlotToAccessList(sd.addr, sd.slot)
-	}
-	for _, log := range psw.AllLogs() {
-		stateDB.AddLog(log)
-	}
-	for hash, bs := range psw.statedb.AllPreimages() {
-		stateDB.AddPreimage(hash, bs)
-	}
 }
@@ -1,20 +1,31 @@
 package pending_state
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/holiman/uint256"
 )
 
+// stateBackend is the state under a StateDBWrapper, either a whole
+// *state.StateDB or an *OverlayStateDB.
+type stateBackend interface {
+	vm.StateDB
+	SetTxContext(thash common.Hash, ti int)
+	GetLogs(hash common.Hash, blockNumber uint64, blockHash common.Hash) []*types.Log
+	Preimages() map[common.Hash][]byte
+}
+
 // StateDBWrapper provides a pending state for a transaction.
 type StateDBWrapper struct {
 	sync.RWMutex
-	state *state.StateDB
+	state stateBackend
 }
 
 func NewStateDBWrapper(db *state.StateDB) *StateDBWrapper {
@@ -23,16 +34,44 @@ func NewStateDBWrapper(db *state.StateDB) *StateDBWrapper {
 	}
 }
 
+func NewOverlayStateDBWrapper(overlay *OverlayStateDB) *StateDBWrapper {
+	return &StateDBWrapper{
+		state: overlay,
+	}
+}
+
 func (s *StateDBWrapper) SetTxContext(txHash common.Hash, txIndex int) {
 	s.Lock()
 	defer s.Unlock()
 	s.state.SetTxContext(txHash, txIndex)
 }
 
-func (s *StateDBWrapper) GetStateDB() *state.StateDB {
+// ErrOverlayStateDB is returned by GetStateDB on an overlay, its base state misses the
+// writes of the txn and is shared by the other txns, use GetOverlay instead.
+var ErrOverlayStateDB = errors.New("the state is an overlay, it has no StateDB of its own")
+
+// GetStateDB returns the wrapped state, it fails if the state is an overlay.
+func (s *StateDBWrapper) GetStateDB() (*state.StateDB, error) {
+	s.RLock()
+	defer s.RUnlock()
+	db, ok := s.state.(*state.StateDB)
+	if !ok {
+		return nil, ErrOverlayStateDB
+	}
+	return db, nil
+}
+
+func (s *StateDBWrapper) GetOverlay() (*OverlayStateDB, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	overlay, ok := s.state.(*OverlayStateDB)
+	return overlay, ok
+}
+
+func (s *StateDBWrapper) GetLogs(hash common.Hash, blockNumber uint64, blockHash common.Hash) []*types.Log {
 	s.RLock()
 	defer s.RUnlock()
-	return s.state
+	return s.state.GetLogs(hash, blockNumber, blockHash)
 }
 
 func (s *StateDBWrapper) CreateAccount(address common.Address) {
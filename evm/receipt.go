@@ -0,0 +1,80 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	yu_common "github.com/yu-org/yu/common"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+var blockBloomPrefix = []byte("reddio-block-bloom-")
+
+// FinalizeReceipts fills the fields of the evm receipts which depend on the whole block,
+// in the block order: cumulative gas used, logs bloom, transaction index and log indices.
+// Txns can be executed in parallel, so these fields can only be set after execution.
+// It returns the logs bloom and the gas used of the block.
+func FinalizeReceipts(block *yu_types.Block, receipts map[yu_common.Hash]*yu_types.Receipt) (types.Bloom, uint64, error) {
+	var (
+		cumulativeGasUsed uint64
+		logIndex          uint
+		blockHash         = common.Hash(block.Hash)
+		ethReceipts       = make(types.Receipts, 0, len(block.Txns))
+	)
+	for txIndex, stxn := range block.Txns {
+		receipt, ok := receipts[stxn.TxnHash]
+		if !ok || receipt.Extra == nil {
+			continue
+		}
+		ethReceipt := new(types.Receipt)
+		if err := json.Unmarshal(receipt.Extra, ethReceipt); err != nil {
+			return types.Bloom{}, 0, err
+		}
+
+		cumulativeGasUsed += ethReceipt.GasUsed
+		ethReceipt.CumulativeGasUsed = cumulativeGasUsed
+		ethReceipt.TransactionIndex = uint(txIndex)
+		ethReceipt.BlockHash = blockHash
+		for _, log := range ethReceipt.Logs {
+			log.TxHash = ethReceipt.TxHash
+			log.TxIndex = uint(txIndex)
+			log.BlockHash = blockHash
+			log.BlockNumber = uint64(block.Height)
+			log.Index = logIndex
+			logIndex++
+		}
+		ethReceipt.Bloom = types.CreateBloom(types.Receipts{ethReceipt})
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(ethReceipt); err != nil {
+			return types.Bloom{}, 0, err
+		}
+		receipt.Extra = buf.Bytes()
+		ethReceipts = append(ethReceipts, ethReceipt)
+	}
+	return types.CreateBloom(ethReceipts), cumulativeGasUsed, nil
+}
+
+func blockBloomKey(height uint64) []byte {
+	key := make([]byte, len(blockBloomPrefix)+8)
+	copy(key, blockBloomPrefix)
+	binary.BigEndian.PutUint64(key[len(blockBloomPrefix):], height)
+	return key
+}
+
+func WriteBlockBloom(db ethdb.KeyValueWriter, height uint64, bloom types.Bloom) error {
+	return db.Put(blockBloomKey(height), bloom.Bytes())
+}
+
+// ReadBlockBloom returns the logs bloom of the block, it is empty if the block is not found.
+func ReadBlockBloom(db ethdb.KeyValueReader, height uint64) types.Bloom {
+	data, err := db.Get(blockBloomKey(height))
+	if err != nil || len(data) != types.BloomByteLength {
+		return types.Bloom{}
+	}
+	return types.BytesToBloom(data)
+}
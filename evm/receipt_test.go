@@ -0,0 +1,84 @@
+package evm
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	yu_common "github.com/yu-org/yu/common"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+func newTestYuReceipt(t *testing.T, gasUsed uint64, logs ...*types.Log) *yu_types.Receipt {
+	if logs == nil {
+		logs = []*types.Log{}
+	}
+	byt, err := json.Marshal(&types.Receipt{
+		Status:      types.ReceiptStatusSuccessful,
+		GasUsed:     gasUsed,
+		Logs:        logs,
+		BlockNumber: big.NewInt(1),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return &yu_types.Receipt{Extra: byt}
+}
+
+func TestFinalizeReceipts(t *testing.T) {
+	token := common.HexToAddress("0x01")
+	topic := common.HexToHash("0x0a")
+	block := &yu_types.Block{
+		Header: &yu_types.Header{Height: 1, Hash: yu_common.Hash{0x01}},
+		Txns: yu_types.SignedTxns{
+			{TxnHash: yu_common.Hash{0x0a}},
+			{TxnHash: yu_common.Hash{0x0b}},
+			{TxnHash: yu_common.Hash{0x0c}},
+		},
+	}
+	// the logs of each txn are indexed from 0 when they are executed in parallel.
+	receipts := map[yu_common.Hash]*yu_types.Receipt{
+		{0x0a}: newTestYuReceipt(t, 21000, &types.Log{Address: token, Topics: []common.Hash{topic}}),
+		{0x0b}: newTestYuReceipt(t, 30000),
+		{0x0c}: newTestYuReceipt(t, 50000, &types.Log{Address: token, Topics: []common.Hash{}}, &types.Log{Address: token, Topics: []common.Hash{}, Index: 1}),
+	}
+
+	bloom, gasUsed, err := FinalizeReceipts(block, receipts)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if gasUsed != 101000 {
+		t.Fatalf("Expected block gas used 101000, but got %d", gasUsed)
+	}
+	if !bloom.Test(token.Bytes()) || !bloom.Test(topic.Bytes()) {
+		t.Fatalf("Expected block bloom to contain the logs")
+	}
+
+	wantCumulative := []uint64{21000, 51000, 101000}
+	wantLogIndex := [][]uint{{0}, {}, {1, 2}}
+	for i, stxn := range block.Txns {
+		receipt := new(types.Receipt)
+		if err = json.Unmarshal(receipts[stxn.TxnHash].Extra, receipt); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if receipt.CumulativeGasUsed != wantCumulative[i] {
+			t.Fatalf("Expected cumulative gas %d, but got %d", wantCumulative[i], receipt.CumulativeGasUsed)
+		}
+		if receipt.TransactionIndex != uint(i) {
+			t.Fatalf("Expected txn index %d, but got %d", i, receipt.TransactionIndex)
+		}
+		if len(receipt.Logs) != len(wantLogIndex[i]) {
+			t.Fatalf("Expected %d logs, but got %d", len(wantLogIndex[i]), len(receipt.Logs))
+		}
+		for j, log := range receipt.Logs {
+			if log.Index != wantLogIndex[i][j] || log.TxIndex != uint(i) {
+				t.Fatalf("Expected log index %d, but got %d", wantLogIndex[i][j], log.Index)
+			}
+		}
+		if len(receipt.Logs) > 0 != receipt.Bloom.Test(token.Bytes()) {
+			t.Fatalf("Expected receipt bloom to match its logs")
+		}
+	}
+}
@@ -105,7 +105,13 @@ func (s *EthState) setTxContext(txHash common.Hash, txIdx int) {
 }
 
 func (s *EthState) StateAt(root common.Hash) (*state.StateDB, error) {
-	return state.New(root, s.stateCache, s.snaps)
+	sdb, err := state.New(root, s.stateCache, s.snaps)
+	if err != nil {
+		// the state trie can not be opened if its nodes are missing, e.g. the historical
+		// states of the path scheme or a root which was never committed.
+		return nil, fmt.Errorf("%w: root %s: %v", ErrStateUnavailable, root.Hex(), err)
+	}
+	return sdb, nil
 }
 
 func (s *EthState) GenesisCommit() (common.Hash, error) {
@@ -124,6 +130,8 @@ func (s *EthState) GenesisCommit() (common.Hash, error) {
 //	return err
 //}
 
+// Commit commits the state of the block and writes its trie nodes to the db. The trie nodes
+// are never pruned with the hash scheme, so the states of all the blocks stay readable.
 func (s *EthState) Commit(blockNum uint64) (common.Hash, error) {
 	s.stateDB.StopPrefetcher()
 	stateRoot, err := s.stateDB.Commit(blockNum, true)
@@ -0,0 +1,47 @@
+package evm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+func TestHistoricalStateReadable(t *testing.T) {
+	cfg := setDefaultEthStateConfig()
+	cfg.DbPath = t.TempDir()
+	// the snapshot is built before the db is closed.
+	cfg.SnapshotWait = true
+	ethState, err := NewEthState(cfg, types.EmptyRootHash)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer ethState.ethDB.Close()
+
+	alice := common.HexToAddress("0x0a")
+	roots := make([]common.Hash, 0)
+	for i := uint64(1); i <= 3; i++ {
+		ethState.AddBalance(alice, uint256.NewInt(1), tracing.BalanceChangeUnspecified)
+		root, err := ethState.Commit(i)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		roots = append(roots, root)
+	}
+	for i, root := range roots {
+		sdb, err := ethState.StateAt(root)
+		if err != nil {
+			t.Fatalf("Expected the state of block %d, but got %v", i+1, err)
+		}
+		if balance := sdb.GetBalance(alice); balance.Uint64() != uint64(i+1) {
+			t.Fatalf("Expected balance %d at block %d, but got %d", i+1, i+1, balance.Uint64())
+		}
+	}
+
+	if _, err = ethState.StateAt(common.HexToHash("0x01")); !errors.Is(err, ErrStateUnavailable) {
+		t.Fatalf("Expected ErrStateUnavailable, but got %v", err)
+	}
+}
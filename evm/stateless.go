@@ -0,0 +1,147 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/triedb"
+	yu_common "github.com/yu-org/yu/common"
+	"github.com/yu-org/yu/core/context"
+	yu_types "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm/pending_state"
+)
+
+// StatelessResult is the result of re-executing a block from its execution witness.
+type StatelessResult struct {
+	Height       uint64
+	TxnCount     int
+	FailedCount  int
+	ExpectedRoot common.Hash
+	ActualRoot   common.Hash
+}
+
+func (r *StatelessResult) Mismatch() bool {
+	return r.ExpectedRoot != r.ActualRoot
+}
+
+// NewStatelessState opens the state of the parent of the witnessed block on an in-memory
+// trie holding only the nodes and the codes of the witness.
+func NewStatelessState(witness *ExecutionWitness) (*state.StateDB, error) {
+	db := rawdb.NewMemoryDatabase()
+	for _, node := range witness.State {
+		rawdb.WriteLegacyTrieNode(db, crypto.Keccak256Hash(node), node)
+	}
+	for _, code := range witness.Codes {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(code), code)
+	}
+	sdb, err := state.New(witness.ParentRoot, state.NewDatabaseWithNodeDB(db, triedb.NewDatabase(db, triedb.HashDefaults)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWitnessIncomplete, err)
+	}
+	return sdb, nil
+}
+
+// NewStatelessSolidity creates the tripod on sdb, which is not backed by the db of the
+// node, e.g. the state of a witness. Nothing can be committed on it.
+func NewStatelessSolidity(cfg *GethConfig, sdb *state.StateDB) *Solidity {
+	cfg.State = sdb
+	s := NewSolidity(cfg)
+	s.ethState = &EthState{stateDB: sdb}
+	return s
+}
+
+// VerifyBlock re-executes the txns of the witness with ExecuteTxn on the state of the
+// witness, in the order they were executed, and compares the resulting state root with
+// the root of the header. Nothing is read from or written to the db of the node. The
+// chain config and the coinbase are the ones of cfg, as the headers do not carry the
+// coinbase. ErrWitnessIncomplete is returned if the execution needs what the witness
+// does not supply.
+func VerifyBlock(cfg *GethConfig, witness *ExecutionWitness, header *types.Header) (*StatelessResult, error) {
+	if header.Number == nil || header.Number.Uint64() != witness.BlockNumber {
+		return nil, fmt.Errorf("the witness of block #%d does not match the header of block #%v", witness.BlockNumber, header.Number)
+	}
+	sdb, err := NewStatelessState(witness)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &yu_types.Block{
+		Header: &yu_types.Header{
+			Height:    yu_common.BlockNum(witness.BlockNumber),
+			Timestamp: header.Time,
+			LeiLimit:  header.GasLimit,
+			StateRoot: yu_common.Hash(header.Root),
+		},
+		Txns: make(yu_types.SignedTxns, len(witness.Txns)),
+	}
+	if header.Difficulty != nil {
+		block.Difficulty = header.Difficulty.Uint64()
+	}
+	for _, txn := range witness.Txns {
+		if txn.Index >= uint64(len(block.Txns)) || block.Txns[txn.Index] != nil {
+			return nil, fmt.Errorf("invalid index %d of txn %s in the witness", txn.Index, txn.Hash.Hex())
+		}
+		block.Txns[txn.Index] = &yu_types.SignedTxn{
+			TxnHash: yu_common.Hash(txn.Hash),
+			Raw:     &yu_types.UnsignedTxn{WrCall: &yu_common.WrCall{Params: string(txn.Request)}},
+		}
+	}
+
+	blockHashes := make(map[uint64]common.Hash, len(witness.BlockHashes))
+	for _, bh := range witness.BlockHashes {
+		blockHashes[bh.Number] = bh.Hash
+	}
+	var missingHashes []uint64
+	cfg = cfg.Copy()
+	cfg.RecordTraces, cfg.RecordWitness = false, false
+	cfg.BlockNumber = new(big.Int).SetUint64(witness.BlockNumber)
+	cfg.GasLimit = block.LeiLimit
+	cfg.Time = block.Timestamp
+	cfg.Difficulty = new(big.Int).SetUint64(block.Difficulty)
+	cfg.BaseFee = new(big.Int)
+	if header.BaseFee != nil {
+		cfg.BaseFee.Set(header.BaseFee)
+	}
+	cfg.GetHashFn = func(n uint64) common.Hash {
+		hash, ok := blockHashes[n]
+		if !ok {
+			missingHashes = append(missingHashes, n)
+		}
+		return hash
+	}
+
+	s := NewStatelessSolidity(cfg, sdb)
+	result := &StatelessResult{
+		Height:       witness.BlockNumber,
+		TxnCount:     len(witness.Txns),
+		ExpectedRoot: header.Root,
+	}
+	for _, txn := range witness.Txns {
+		index := int(txn.Index)
+		ctx, err := context.NewWriteContext(block.Txns[index], block, index)
+		if err == nil {
+			ctx.ExtraInterface = pending_state.NewPendingStateWrapper(pending_state.NewStateDBWrapper(sdb), pending_state.NewStateContext(false), int64(index))
+			err = s.ExecuteTxn(ctx)
+		}
+		if err != nil {
+			result.FailedCount++
+		}
+	}
+	result.ActualRoot = s.IntermediateRoot(block)
+
+	if err = sdb.Error(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWitnessIncomplete, err)
+	}
+	if len(missingHashes) > 0 {
+		sort.Slice(missingHashes, func(i, j int) bool { return missingHashes[i] < missingHashes[j] })
+		return nil, fmt.Errorf("%w: the hashes of blocks %v", ErrWitnessIncomplete, missingHashes)
+	}
+	return result, nil
+}
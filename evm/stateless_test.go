@@ -0,0 +1,226 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+)
+
+func TestVerifyBlock(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x0a")
+		to       = common.HexToAddress("0x1001")
+		coinbase = common.HexToAddress("0x0c")
+	)
+	db := rawdb.NewMemoryDatabase()
+	tdb := triedb.NewDatabase(db, triedb.HashDefaults)
+	sdb, _ := state.New(types.EmptyRootHash, state.NewDatabaseWithNodeDB(db, tdb), nil)
+	sdb.AddBalance(sender, uint256.NewInt(params.Ether), 0)
+	// the other accounts make the proofs a part of the state.
+	for i := 0; i < 32; i++ {
+		sdb.AddBalance(common.BigToAddress(big.NewInt(int64(0x1000+i))), uint256.NewInt(uint64(i+1)), 0)
+	}
+	root, err := sdb.Commit(0, true)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err = tdb.Commit(root, false); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	txns := newTestWitnessTxns(sender, to, params.TxGas)
+	cfg := &GethConfig{
+		ChainConfig: params.AllEthashProtocolChanges,
+		Coinbase:    coinbase,
+		Random:      &common.Hash{},
+	}
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Time:       1,
+		GasLimit:   30000000,
+		Difficulty: big.NewInt(1),
+		BaseFee:    big.NewInt(params.GWei),
+	}
+
+	// the post state root is the one of the execution on the full state.
+	full := newFullWitness(db, root, txns)
+	result, err := VerifyBlock(cfg, full, header)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if result.FailedCount != 0 || result.ActualRoot == root {
+		t.Fatalf("Expected the txn to be executed, but got %+v", result)
+	}
+	header.Root = result.ActualRoot
+
+	pre, _ := state.New(root, state.NewDatabaseWithNodeDB(db, tdb), nil)
+	w := newWitnessRecorder()
+	for _, addr := range []common.Address{sender, to, coinbase} {
+		w.accounts[addr] = struct{}{}
+	}
+	nodes, codes, err := w.prove(pre, pre, root)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(nodes) >= len(full.State) {
+		t.Fatalf("Expected the proofs to be a part of the %d nodes, but got %d", len(full.State), len(nodes))
+	}
+	witness := &ExecutionWitness{BlockNumber: 1, ParentRoot: root, State: nodes, Codes: codes, Txns: txns}
+	result, err = VerifyBlock(cfg, witness, header)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if result.Mismatch() {
+		t.Fatalf("Expected state root %s, but got %s", result.ExpectedRoot.Hex(), result.ActualRoot.Hex())
+	}
+
+	header.Root = root
+	if result, err = VerifyBlock(cfg, witness, header); err != nil || !result.Mismatch() {
+		t.Fatalf("Expected a state root mismatch, but got %+v, %v", result, err)
+	}
+
+	// the account of the recipient is not proved.
+	delete(w.accounts, to)
+	witness.State, _, _ = w.prove(pre, pre, root)
+	if _, err = VerifyBlock(cfg, witness, header); !errors.Is(err, ErrWitnessIncomplete) {
+		t.Fatalf("Expected ErrWitnessIncomplete, but got %v", err)
+	}
+}
+
+// TestVerifyBlockCollapse clears a slot next to exactly one sibling, the branch of the two
+// slots collapses into the sibling, which is not on the path of the cleared slot.
+func TestVerifyBlockCollapse(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x0a")
+		contract = common.HexToAddress("0x1001")
+		coinbase = common.HexToAddress("0x0c")
+		cleared  = common.HexToHash("0x01")
+		sibling  = common.HexToHash("0x02")
+	)
+	db := rawdb.NewMemoryDatabase()
+	tdb := triedb.NewDatabase(db, triedb.HashDefaults)
+	sdb, _ := state.New(types.EmptyRootHash, state.NewDatabaseWithNodeDB(db, tdb), nil)
+	sdb.AddBalance(sender, uint256.NewInt(params.Ether), 0)
+	// SSTORE(1, 0)
+	sdb.SetCode(contract, []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 1, byte(vm.SSTORE), byte(vm.STOP)})
+	sdb.SetState(contract, cleared, common.HexToHash("0x11"))
+	sdb.SetState(contract, sibling, common.HexToHash("0x22"))
+	root, err := sdb.Commit(0, true)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err = tdb.Commit(root, false); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	txns := newTestWitnessTxns(sender, contract, 100000)
+	cfg := &GethConfig{
+		ChainConfig: params.AllEthashProtocolChanges,
+		Coinbase:    coinbase,
+		Random:      &common.Hash{},
+	}
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Time:       1,
+		GasLimit:   30000000,
+		Difficulty: big.NewInt(1),
+		BaseFee:    big.NewInt(params.GWei),
+	}
+	result, err := VerifyBlock(cfg, newFullWitness(db, root, txns), header)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if result.FailedCount != 0 {
+		t.Fatalf("Expected the txn to be executed, but got %+v", result)
+	}
+	header.Root = result.ActualRoot
+
+	pre, _ := state.New(root, state.NewDatabaseWithNodeDB(db, tdb), nil)
+	w := newWitnessRecorder()
+	for _, addr := range []common.Address{sender, contract, coinbase} {
+		w.accounts[addr] = struct{}{}
+	}
+	w.slots[contract] = map[common.Hash]struct{}{cleared: {}}
+
+	// the proof of the cleared slot does not hold its sibling.
+	nodes, codes, err := w.prove(pre, pre, root)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	witness := &ExecutionWitness{BlockNumber: 1, ParentRoot: root, State: nodes, Codes: codes, Txns: txns}
+	if _, err = VerifyBlock(cfg, witness, header); !errors.Is(err, ErrWitnessIncomplete) {
+		t.Fatalf("Expected ErrWitnessIncomplete, but got %v", err)
+	}
+
+	post := pre.Copy()
+	post.SetState(contract, cleared, common.Hash{})
+	if witness.State, _, err = w.prove(pre, post, root); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(witness.State) != len(nodes)+1 {
+		t.Fatalf("Expected the sibling to be added to the %d nodes, but got %d", len(nodes), len(witness.State))
+	}
+	result, err = VerifyBlock(cfg, witness, header)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if result.Mismatch() {
+		t.Fatalf("Expected state root %s, but got %s", result.ExpectedRoot.Hex(), result.ActualRoot.Hex())
+	}
+}
+
+// newTestWitnessTxns returns a txn of the sender calling to with the gas limit.
+func newTestWitnessTxns(sender, to common.Address, gasLimit uint64) []WitnessTxn {
+	var (
+		gas      = hexutil.Uint64(gasLimit)
+		gasPrice = big.NewInt(2 * params.GWei)
+		value    = big.NewInt(1000)
+		nonce    = hexutil.Uint64(0)
+	)
+	args, _ := json.Marshal(&TempTransactionArgs{
+		From:     &sender,
+		To:       &to,
+		Gas:      &gas,
+		GasPrice: (*hexutil.Big)(gasPrice),
+		Value:    (*hexutil.Big)(value),
+		Nonce:    &nonce,
+	})
+	req, _ := json.Marshal(&TxRequest{
+		Origin:     sender,
+		Address:    &to,
+		GasLimit:   gasLimit,
+		GasPrice:   gasPrice,
+		Value:      value,
+		V:          big.NewInt(27),
+		R:          big.NewInt(1),
+		S:          big.NewInt(1),
+		OriginArgs: args,
+	})
+	return []WitnessTxn{{Hash: common.HexToHash("0x01"), Request: req}}
+}
+
+// newFullWitness returns the witness holding every trie node of the db.
+func newFullWitness(db ethdb.Iteratee, root common.Hash, txns []WitnessTxn) *ExecutionWitness {
+	full := &ExecutionWitness{BlockNumber: 1, ParentRoot: root, Txns: txns}
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if crypto.Keccak256Hash(it.Value()) == common.BytesToHash(it.Key()) {
+			full.State = append(full.State, common.CopyBytes(it.Value()))
+		}
+	}
+	return full
+}
@@ -0,0 +1,209 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	// register the flatCallTracer
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/sirupsen/logrus"
+	"github.com/yu-org/yu/core/context"
+	yu_types "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm/pending_state"
+)
+
+var blockTracesPrefix = []byte("reddio-block-traces-")
+
+// TraceEnv re-executes the txns of a committed block on the state of its parent,
+// the same way as the serial executor does. The coinbase is rewarded once the block
+// is committed, so the tips are not credited while the txns are re-executed.
+type TraceEnv struct {
+	s     *Solidity
+	block *yu_types.Block
+	cfg   *GethConfig
+	state *state.StateDB
+}
+
+// NewTraceEnv opens the state of the parent of the block with the block configs
+// the block was executed with.
+func (s *Solidity) NewTraceEnv(block *yu_types.Block) (*TraceEnv, error) {
+	if block.Height == 0 {
+		return nil, ErrGenesisNotTraceable
+	}
+	baseFee, err := ExecutedBaseFee(block.Header)
+	if err != nil {
+		return nil, err
+	}
+	return s.newTraceEnv(block, baseFee)
+}
+
+// NewPendingEnv opens the state of the parent of the pending block, a block built on top
+// of the end block which is never committed. Its base fee follows its parent.
+func (s *Solidity) NewPendingEnv(block *yu_types.Block) (*TraceEnv, error) {
+	baseFee, err := s.calcBaseFee(block)
+	if err != nil {
+		return nil, err
+	}
+	return s.newTraceEnv(block, baseFee)
+}
+
+func (s *Solidity) newTraceEnv(block *yu_types.Block, baseFee *big.Int) (*TraceEnv, error) {
+	parent, err := s.Chain.GetCompactBlock(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	sdb, err := s.StateAt(common.Hash(parent.StateRoot))
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	cfg := s.cfg.Copy()
+	s.Unlock()
+	cfg.BlockNumber = new(big.Int).SetUint64(uint64(block.Height))
+	cfg.GasLimit = block.LeiLimit
+	cfg.Time = block.Timestamp
+	cfg.Difficulty = new(big.Int).SetUint64(block.Difficulty)
+	cfg.BaseFee = baseFee
+	cfg.State = sdb
+	return &TraceEnv{s: s, block: block, cfg: cfg, state: sdb}, nil
+}
+
+// BaseFee returns the base fee the txns are executed with.
+func (env *TraceEnv) BaseFee() *big.Int {
+	return env.cfg.BaseFee
+}
+
+// StateDB returns the state with the txns applied so far.
+func (env *TraceEnv) StateDB() *state.StateDB {
+	return env.state
+}
+
+// ApplyTxn executes the txn at index in the block and returns its receipt. The txn is
+// traced by the hooks if they are not nil. The error is only returned if the txn is
+// rejected before its execution, e.g. because of its nonce.
+func (env *TraceEnv) ApplyTxn(index int, hooks *tracing.Hooks) (*types.Receipt, error) {
+	ctx, err := context.NewWriteContext(env.block.Txns[index], env.block, index)
+	if err != nil {
+		return nil, err
+	}
+	cfg := *env.cfg
+	cfg.EVMConfig.Tracer = hooks
+	env.state.SetLogger(hooks)
+	defer env.state.SetLogger(nil)
+
+	ctx.ExtraInterface = pending_state.NewPendingStateWrapper(pending_state.NewStateDBWrapper(env.state), pending_state.NewStateContext(false), int64(index))
+	_, err = env.s.applyTxn(ctx, &cfg)
+	return endTxn(ctx, hooks, err)
+}
+
+// endTxn returns the receipt emitted by the execution of the txn and ends its trace.
+// The error is only returned if the txn is rejected before its execution.
+func endTxn(ctx *context.WriteContext, hooks *tracing.Hooks, err error) (*types.Receipt, error) {
+	if ctx.Extra == nil {
+		if err == nil {
+			err = ErrNotFoundReceipt
+		}
+		if hooks != nil && hooks.OnTxEnd != nil {
+			hooks.OnTxEnd(nil, err)
+		}
+		return nil, err
+	}
+	receipt := new(types.Receipt)
+	if err = json.NewDecoder(bytes.NewReader(ctx.Extra)).Decode(receipt); err != nil {
+		return nil, err
+	}
+	if hooks != nil && hooks.OnTxEnd != nil {
+		hooks.OnTxEnd(receipt, nil)
+	}
+	return receipt, nil
+}
+
+// NewFlatCallTracer creates the parity style flat call tracer of the txn at index in the block.
+func NewFlatCallTracer(block *yu_types.Block, index int) (*tracers.Tracer, error) {
+	txctx := &tracers.Context{
+		BlockHash:   common.Hash(block.Hash),
+		BlockNumber: new(big.Int).SetUint64(uint64(block.Height)),
+		TxIndex:     index,
+		TxHash:      common.Hash(block.Txns[index].TxnHash),
+	}
+	return tracers.DefaultDirectory.New("flatCallTracer", txctx, json.RawMessage(`{"convertParityErrors":true}`))
+}
+
+// recordTxTrace keeps the flat call trace of the txn executed by ExecuteTxn,
+// the traces of the block are stored once it is committed.
+func (s *Solidity) recordTxTrace(ctx *context.WriteContext, tracer *tracers.Tracer, err error) {
+	if _, err = endTxn(ctx, tracer.Hooks, err); err != nil {
+		return
+	}
+	trace, err := tracer.GetResult()
+	if err != nil {
+		logrus.Warnf("Solidity failed to trace txn(%s), error: %v", ctx.GetTxnHash().String(), err)
+		return
+	}
+	s.txTraces[common.Hash(ctx.GetTxnHash())] = trace
+}
+
+// TxTraces returns a copy of the traces recorded for the txns of the block being executed.
+func (s *Solidity) TxTraces() map[common.Hash]json.RawMessage {
+	s.Lock()
+	defer s.Unlock()
+	traces := make(map[common.Hash]json.RawMessage, len(s.txTraces))
+	for txHash, trace := range s.txTraces {
+		traces[txHash] = trace
+	}
+	return traces
+}
+
+func (s *Solidity) SetTxTraces(traces map[common.Hash]json.RawMessage) {
+	s.Lock()
+	defer s.Unlock()
+	s.txTraces = make(map[common.Hash]json.RawMessage, len(traces))
+	for txHash, trace := range traces {
+		s.txTraces[txHash] = trace
+	}
+}
+
+func blockTracesKey(height uint64) []byte {
+	key := make([]byte, len(blockTracesPrefix)+8)
+	copy(key, blockTracesPrefix)
+	binary.BigEndian.PutUint64(key[len(blockTracesPrefix):], height)
+	return key
+}
+
+// WriteBlockTraces stores the flat call traces of the txns in the block order,
+// the trace of a txn rejected before its execution is null.
+func WriteBlockTraces(db ethdb.KeyValueWriter, block *yu_types.Block, txTraces map[common.Hash]json.RawMessage) error {
+	traces := make([]json.RawMessage, len(block.Txns))
+	for i, stxn := range block.Txns {
+		traces[i] = txTraces[common.Hash(stxn.TxnHash)]
+	}
+	byt, err := json.Marshal(traces)
+	if err != nil {
+		return err
+	}
+	return db.Put(blockTracesKey(uint64(block.Height)), byt)
+}
+
+// ReadBlockTraces returns the flat call traces of the txns of the block,
+// it is nil if they were not recorded when the block was executed.
+func ReadBlockTraces(db ethdb.KeyValueReader, height uint64) ([]json.RawMessage, error) {
+	byt, err := db.Get(blockTracesKey(height))
+	if err != nil {
+		return nil, nil
+	}
+	var traces []json.RawMessage
+	if err = json.Unmarshal(byt, &traces); err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
@@ -0,0 +1,37 @@
+package evm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	yu_common "github.com/yu-org/yu/common"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+func TestBlockTraces(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	traces, err := ReadBlockTraces(db, 1)
+	if err != nil || traces != nil {
+		t.Fatalf("Expected no traces, but got %v, %v", traces, err)
+	}
+
+	block := &yu_types.Block{Header: &yu_types.Header{Height: 1}}
+	block.Txns = yu_types.SignedTxns{
+		&yu_types.SignedTxn{TxnHash: yu_common.Hash{1}},
+		&yu_types.SignedTxn{TxnHash: yu_common.Hash{2}},
+	}
+	// the second txn was rejected before its execution.
+	trace := json.RawMessage(`[{"type":"call"}]`)
+	if err = WriteBlockTraces(db, block, map[common.Hash]json.RawMessage{{1}: trace}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	traces, err = ReadBlockTraces(db, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(traces) != 2 || string(traces[0]) != string(trace) || string(traces[1]) != "null" {
+		t.Fatalf("Expected the traces in the block order, but got %s", traces)
+	}
+}
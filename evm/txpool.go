@@ -0,0 +1,184 @@
+package evm
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtxpool "github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/event"
+	yu_common "github.com/yu-org/yu/common"
+	"github.com/yu-org/yu/core/txpool"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+type senderNonce struct {
+	sender common.Address
+	nonce  uint64
+}
+
+// poolTxn is the indexed part of a txn of the txpool.
+type poolTxn struct {
+	stxn   *yu_types.SignedTxn
+	feeCap *big.Int
+	tipCap *big.Int
+}
+
+// ReplacedTxnEvent is posted when a txn of the txpool is replaced by a txn with the same
+// sender and nonce.
+type ReplacedTxnEvent struct {
+	Replaced    *yu_types.SignedTxn
+	Replacement yu_common.Hash
+}
+
+// NewTxnEvent is posted when a txn is added into the txpool.
+type NewTxnEvent struct {
+	Txn *yu_types.SignedTxn
+}
+
+// TxPool wraps the txpool of the kernel to index its txns by sender and nonce.
+// The txns which cannot be decoded are kept in the txpool without an index.
+type TxPool struct {
+	txpool.ItxPool
+	// priceBump is the minimum price bump in percent to replace a txn.
+	priceBump uint64
+
+	mu     sync.RWMutex
+	nonces map[common.Address]map[uint64]*poolTxn
+	hashes map[yu_common.Hash]senderNonce
+
+	replacedFeed event.Feed
+	newTxnFeed   event.Feed
+}
+
+func NewTxPool(pool txpool.ItxPool, priceBump uint64) *TxPool {
+	return &TxPool{
+		ItxPool:   pool,
+		priceBump: priceBump,
+		nonces:    make(map[common.Address]map[uint64]*poolTxn),
+		hashes:    make(map[yu_common.Hash]senderNonce),
+	}
+}
+
+// Insert adds the txn to the txpool. A txn of the txpool with the same sender and nonce is
+// replaced if both the fee cap and the tip cap are bumped by priceBump percent, otherwise
+// the txn is rejected as underpriced. The replaced txn is only evicted once the txn is added.
+// The txns added from the RPC and from the p2p network are both posted to SubscribeNewTxns.
+func (p *TxPool) Insert(stxn *yu_types.SignedTxn) error {
+	req := new(TxRequest)
+	if err := stxn.BindJson(req); err != nil {
+		return p.ItxPool.Insert(stxn)
+	}
+	replaced, err := p.insert(stxn, req)
+	if err != nil {
+		return err
+	}
+	if replaced != nil {
+		p.replacedFeed.Send(ReplacedTxnEvent{Replaced: replaced, Replacement: stxn.TxnHash})
+	}
+	p.newTxnFeed.Send(NewTxnEvent{Txn: stxn})
+	return nil
+}
+
+func (p *TxPool) insert(stxn *yu_types.SignedTxn, req *TxRequest) (replaced *yu_types.SignedTxn, err error) {
+	feeCap, tipCap := req.GasFeeCaps()
+	ptxn := &poolTxn{stxn: stxn, feeCap: feeCap, tipCap: tipCap}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old, ok := p.nonces[req.Origin][req.Nonce]
+	if ok && old.stxn.TxnHash == stxn.TxnHash {
+		return nil, ErrAlreadyKnown
+	}
+	if ok && !priceBumped(old, ptxn, p.priceBump) {
+		return nil, gethtxpool.ErrReplaceUnderpriced
+	}
+	if err = p.ItxPool.Insert(stxn); err != nil {
+		return nil, err
+	}
+	if ok {
+		replaced = old.stxn
+		hashes := []yu_common.Hash{replaced.TxnHash}
+		p.unindex(hashes)
+		if err = p.ItxPool.ResetByHashes(hashes); err != nil {
+			return nil, err
+		}
+	}
+	nonces, ok := p.nonces[req.Origin]
+	if !ok {
+		nonces = make(map[uint64]*poolTxn)
+		p.nonces[req.Origin] = nonces
+	}
+	nonces[req.Nonce] = ptxn
+	p.hashes[stxn.TxnHash] = senderNonce{sender: req.Origin, nonce: req.Nonce}
+	return replaced, nil
+}
+
+// priceBumped reports whether the fee cap and the tip cap of txn are higher than the ones
+// of old by at least priceBump percent.
+func priceBumped(old, txn *poolTxn, priceBump uint64) bool {
+	if old.feeCap.Cmp(txn.feeCap) >= 0 || old.tipCap.Cmp(txn.tipCap) >= 0 {
+		return false
+	}
+	a := big.NewInt(100 + int64(priceBump))
+	aFeeCap := new(big.Int).Mul(a, old.feeCap)
+	aTip := a.Mul(a, old.tipCap)
+	b := big.NewInt(100)
+	thresholdFeeCap := aFeeCap.Div(aFeeCap, b)
+	thresholdTip := aTip.Div(aTip, b)
+	return txn.feeCap.Cmp(thresholdFeeCap) >= 0 && txn.tipCap.Cmp(thresholdTip) >= 0
+}
+
+func (p *TxPool) Reset(txns yu_types.SignedTxns) error {
+	return p.ResetByHashes(txns.Hashes())
+}
+
+func (p *TxPool) ResetByHashes(hashes []yu_common.Hash) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unindex(hashes)
+	return p.ItxPool.ResetByHashes(hashes)
+}
+
+func (p *TxPool) unindex(hashes []yu_common.Hash) {
+	for _, hash := range hashes {
+		sn, ok := p.hashes[hash]
+		if !ok {
+			continue
+		}
+		delete(p.hashes, hash)
+		nonces := p.nonces[sn.sender]
+		if ptxn, ok := nonces[sn.nonce]; !ok || ptxn.stxn.TxnHash != hash {
+			continue
+		}
+		delete(nonces, sn.nonce)
+		if len(nonces) == 0 {
+			delete(p.nonces, sn.sender)
+		}
+	}
+}
+
+// PoolNonce returns the nonce following the txns of the sender in the txpool whose nonces
+// are contiguous from the nonce of the sender in the state, stNonce.
+func (p *TxPool) PoolNonce(sender common.Address, stNonce uint64) uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	nonces := p.nonces[sender]
+	next := stNonce
+	for {
+		if _, ok := nonces[next]; !ok {
+			return next
+		}
+		next++
+	}
+}
+
+// SubscribeReplacedTxns subscribes to the txns replaced in the txpool.
+func (p *TxPool) SubscribeReplacedTxns(ch chan<- ReplacedTxnEvent) event.Subscription {
+	return p.replacedFeed.Subscribe(ch)
+}
+
+// SubscribeNewTxns subscribes to the txns added into the txpool.
+func (p *TxPool) SubscribeNewTxns(ch chan<- NewTxnEvent) event.Subscription {
+	return p.newTxnFeed.Subscribe(ch)
+}
@@ -0,0 +1,110 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtxpool "github.com/ethereum/go-ethereum/core/txpool"
+	yu_common "github.com/yu-org/yu/common"
+	yu_config "github.com/yu-org/yu/config"
+	"github.com/yu-org/yu/core/txpool"
+	yu_types "github.com/yu-org/yu/core/types"
+)
+
+func newTestPoolTxn(t *testing.T, sender common.Address, nonce uint64, gasPrice int64) *yu_types.SignedTxn {
+	byt, err := json.Marshal(&TxRequest{Origin: sender, Nonce: nonce, GasPrice: big.NewInt(gasPrice)})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	hash := yu_common.BytesToHash(append(sender.Bytes(), new(big.Int).SetUint64(nonce<<32|uint64(gasPrice)).Bytes()...))
+	return &yu_types.SignedTxn{
+		TxnHash: hash,
+		Raw:     &yu_types.UnsignedTxn{WrCall: &yu_common.WrCall{Params: string(byt)}},
+	}
+}
+
+func newTestTxPool() *TxPool {
+	return NewTxPool(txpool.NewTxPool(yu_common.FullNode, &yu_config.TxpoolConf{PoolSize: 100, TxnMaxSize: 1 << 20}), 10)
+}
+
+func TestTxPoolNonce(t *testing.T) {
+	alice := common.HexToAddress("0x0a")
+	bob := common.HexToAddress("0x0b")
+	pool := newTestTxPool()
+	first := newTestPoolTxn(t, alice, 3, 1)
+	for _, stxn := range []*yu_types.SignedTxn{
+		first,
+		newTestPoolTxn(t, alice, 4, 1),
+		// the nonce 5 of alice is missing.
+		newTestPoolTxn(t, alice, 6, 1),
+		newTestPoolTxn(t, bob, 0, 1),
+	} {
+		if err := pool.Insert(stxn); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	if nonce := pool.PoolNonce(alice, 3); nonce != 5 {
+		t.Fatalf("Expected pool nonce 5, but got %d", nonce)
+	}
+	// the txns whose nonces are behind the state are not counted.
+	if nonce := pool.PoolNonce(alice, 7); nonce != 7 {
+		t.Fatalf("Expected pool nonce 7, but got %d", nonce)
+	}
+	if nonce := pool.PoolNonce(bob, 0); nonce != 1 {
+		t.Fatalf("Expected pool nonce 1, but got %d", nonce)
+	}
+	if nonce := pool.PoolNonce(common.HexToAddress("0x0c"), 2); nonce != 2 {
+		t.Fatalf("Expected pool nonce 2, but got %d", nonce)
+	}
+
+	if err := pool.Reset(yu_types.SignedTxns{first}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if nonce := pool.PoolNonce(alice, 3); nonce != 3 {
+		t.Fatalf("Expected pool nonce 3 once the txn is packed, but got %d", nonce)
+	}
+	if pool.Size() != 3 {
+		t.Fatalf("Expected 3 txns in the txpool, but got %d", pool.Size())
+	}
+}
+
+func TestTxPoolReplace(t *testing.T) {
+	alice := common.HexToAddress("0x0a")
+	pool := newTestTxPool()
+	replacedCh := make(chan ReplacedTxnEvent, 1)
+	sub := pool.SubscribeReplacedTxns(replacedCh)
+	defer sub.Unsubscribe()
+
+	old := newTestPoolTxn(t, alice, 0, 100)
+	if err := pool.Insert(old); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := pool.Insert(old); !errors.Is(err, ErrAlreadyKnown) {
+		t.Fatalf("Expected ErrAlreadyKnown, but got %v", err)
+	}
+	// a bump of 9% is less than the price bump of 10%.
+	if err := pool.Insert(newTestPoolTxn(t, alice, 0, 109)); !errors.Is(err, gethtxpool.ErrReplaceUnderpriced) {
+		t.Fatalf("Expected ErrReplaceUnderpriced, but got %v", err)
+	}
+	if pool.Size() != 1 || !pool.Exist(old.TxnHash) {
+		t.Fatalf("Expected the txn to stay in the txpool")
+	}
+
+	replacement := newTestPoolTxn(t, alice, 0, 110)
+	if err := pool.Insert(replacement); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if pool.Size() != 1 || pool.Exist(old.TxnHash) || !pool.Exist(replacement.TxnHash) {
+		t.Fatalf("Expected the txn to be replaced in the txpool")
+	}
+	ev := <-replacedCh
+	if ev.Replaced != old || ev.Replacement != replacement.TxnHash {
+		t.Fatalf("Expected the replaced event of %s, but got %+v", old.TxnHash.String(), ev)
+	}
+	if nonce := pool.PoolNonce(alice, 0); nonce != 1 {
+		t.Fatalf("Expected pool nonce 1, but got %d", nonce)
+	}
+}
@@ -0,0 +1,424 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/sirupsen/logrus"
+	yu_types "github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/evm/pending_state"
+)
+
+// WitnessVersion is the version of the encoding of the execution witnesses, it is the
+// first byte of an encoded witness and is bumped whenever ExecutionWitness changes.
+const WitnessVersion byte = 1
+
+var witnessPrefix = []byte("reddio-witness-")
+
+// ExecutionWitness is what a stateless verifier, e.g. a ZK prover, needs to re-execute
+// a block on top of the state root of its parent without the state.
+type ExecutionWitness struct {
+	BlockNumber uint64
+	ParentRoot  common.Hash
+	// State are the trie nodes of the parent state on the paths of the accounts and the
+	// slots read or written by the block, and the ones resolved when the post state is
+	// hashed, sorted by their hashes.
+	State [][]byte
+	// Codes are the codes of the accounts read or written by the block, sorted by their hashes.
+	Codes [][]byte
+	// BlockHashes are the hashes returned by BLOCKHASH, sorted by the block numbers.
+	BlockHashes []WitnessBlockHash
+	// Txns are the txns of the block in the block order, which is the order they are executed in.
+	Txns []WitnessTxn
+}
+
+type WitnessBlockHash struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// WitnessTxn is a txn as it is executed, Request is the json encoded TxRequest.
+type WitnessTxn struct {
+	Hash    common.Hash
+	Index   uint64 // the index of the txn in the block
+	Request []byte
+}
+
+// witnessRecorder collects the state accessed by the txns of the block being executed.
+// It is only used with the lock of Solidity held.
+type witnessRecorder struct {
+	accounts    map[common.Address]struct{}
+	slots       map[common.Address]map[common.Hash]struct{}
+	blockHashes map[uint64]common.Hash
+}
+
+func newWitnessRecorder() *witnessRecorder {
+	return &witnessRecorder{
+		accounts:    make(map[common.Address]struct{}),
+		slots:       make(map[common.Address]map[common.Hash]struct{}),
+		blockHashes: make(map[uint64]common.Hash),
+	}
+}
+
+// recordAccesses adds the accounts and the slots read or written by a txn.
+func (w *witnessRecorder) recordAccesses(sctx *pending_state.StateContext) {
+	for _, visited := range []*pending_state.VisitedAddress{sctx.Read, sctx.Write} {
+		for _, addrs := range []map[common.Address]pending_state.VisitTxnID{
+			visited.Address, visited.Account, visited.Balance, visited.Nonce, visited.Code,
+		} {
+			for addr := range addrs {
+				w.accounts[addr] = struct{}{}
+			}
+		}
+		for addr, keys := range visited.State {
+			w.accounts[addr] = struct{}{}
+			slots, ok := w.slots[addr]
+			if !ok {
+				slots = make(map[common.Hash]struct{}, len(keys))
+				w.slots[addr] = slots
+			}
+			for key := range keys {
+				slots[key] = struct{}{}
+			}
+		}
+	}
+}
+
+// getHashFn wraps the GetHashFn of the block configs to record the hashes it returns.
+func (w *witnessRecorder) getHashFn(getHash func(n uint64) common.Hash) func(n uint64) common.Hash {
+	return func(n uint64) common.Hash {
+		hash := getHash(n)
+		w.blockHashes[n] = hash
+		return hash
+	}
+}
+
+// WitnessEnabled reports whether the execution witnesses of the blocks are recorded.
+func (s *Solidity) WitnessEnabled() bool {
+	return s.cfg.RecordWitness
+}
+
+// SwapWitness records the accesses of the txns executed from now on in a fresh witness,
+// and returns the function restoring the witness of the block. The accesses of a re-execution
+// of the block, e.g. the serial one checking the parallel one, are then dropped.
+func (s *Solidity) SwapWitness() (restore func()) {
+	s.Lock()
+	defer s.Unlock()
+	witness := s.witness
+	s.witness = newWitnessRecorder()
+	return func() {
+		s.Lock()
+		defer s.Unlock()
+		s.witness = witness
+	}
+}
+
+// buildWitness proves the accessed accounts and slots in the state of the parent of the
+// block, it must be called before the state of the block is committed.
+func (s *Solidity) buildWitness(block *yu_types.Block) (*ExecutionWitness, error) {
+	parent, err := s.Chain.GetCompactBlock(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	root := common.Hash(parent.StateRoot)
+	sdb, err := s.ethState.StateAt(root)
+	if err != nil {
+		return nil, err
+	}
+	// the coinbase is rewarded once the txns are executed.
+	s.witness.accounts[s.cfg.Coinbase] = struct{}{}
+	nodes, codes, err := s.witness.prove(sdb, s.ethState.StateDB(), root)
+	if err != nil {
+		return nil, err
+	}
+
+	witness := &ExecutionWitness{
+		BlockNumber: uint64(block.Height),
+		ParentRoot:  root,
+		State:       nodes,
+		Codes:       codes,
+		BlockHashes: make([]WitnessBlockHash, 0, len(s.witness.blockHashes)),
+		Txns:        make([]WitnessTxn, 0, len(block.Txns)),
+	}
+	for number, hash := range s.witness.blockHashes {
+		witness.BlockHashes = append(witness.BlockHashes, WitnessBlockHash{Number: number, Hash: hash})
+	}
+	sort.Slice(witness.BlockHashes, func(i, j int) bool {
+		return witness.BlockHashes[i].Number < witness.BlockHashes[j].Number
+	})
+	for i, stxn := range block.Txns {
+		witness.Txns = append(witness.Txns, WitnessTxn{
+			Hash:    common.Hash(stxn.TxnHash),
+			Index:   uint64(i),
+			Request: []byte(stxn.Raw.WrCall.Params),
+		})
+	}
+	return witness, nil
+}
+
+// prove returns the trie nodes of the state at root a stateless verifier resolves to
+// re-execute the block, and the codes of the accounts, both sorted by their hashes. The
+// nodes are the ones on the paths of the recorded accounts and slots, and the ones resolved
+// when the post state is hashed, e.g. the sibling a branch collapses into once a slot next
+// to it is cleared.
+func (w *witnessRecorder) prove(pre, post *state.StateDB, root common.Hash) (nodes, codes [][]byte, err error) {
+	tdb := pre.Database().TrieDB()
+	tr, err := trie.NewStateTrie(trie.StateTrieID(root), tdb)
+	if err != nil {
+		return nil, nil, err
+	}
+	proofs := make(witnessNodes)
+	codeSet := make(map[common.Hash][]byte)
+	// storageRoots are the storage roots in the state at root of the accounts with recorded slots.
+	storageRoots := make(map[common.Hash]common.Hash)
+	for addr := range w.accounts {
+		addrHash := crypto.Keccak256Hash(addr.Bytes())
+		if err = tr.Prove(addrHash.Bytes(), proofs); err != nil {
+			return nil, nil, err
+		}
+		if code := pre.GetCode(addr); len(code) > 0 {
+			codeSet[crypto.Keccak256Hash(code)] = code
+		}
+		slots := w.slots[addr]
+		storageRoot := pre.GetStorageRoot(addr)
+		if len(slots) == 0 || storageRoot == types.EmptyRootHash || storageRoot == (common.Hash{}) {
+			continue
+		}
+		storageRoots[addrHash] = storageRoot
+		st, err := trie.NewStateTrie(trie.StorageTrieID(root, addrHash, storageRoot), tdb)
+		if err != nil {
+			return nil, nil, err
+		}
+		for slot := range slots {
+			if err = st.Prove(crypto.Keccak256(slot.Bytes()), proofs); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err = pre.Error(); err != nil {
+		return nil, nil, err
+	}
+	if err = w.resolvePostState(tdb, post, root, storageRoots, proofs); err != nil {
+		return nil, nil, err
+	}
+	return sortedByHash(proofs), sortedByHash(codeSet), nil
+}
+
+// resolvePostState hashes the post state of the recorded accounts and slots on the nodes
+// collected so far, and collects every node missing on the way from the state at root,
+// until the post state is hashed without a missing node.
+func (w *witnessRecorder) resolvePostState(tdb *triedb.Database, post *state.StateDB, root common.Hash, storageRoots map[common.Hash]common.Hash, nodes witnessNodes) error {
+	for {
+		err := w.hashPostState(post, root, storageRoots, nodes)
+		missing := new(trie.MissingNodeError)
+		if !errors.As(err, &missing) {
+			return err
+		}
+		if _, ok := nodes[missing.NodeHash]; ok {
+			return err
+		}
+		id := trie.StateTrieID(root)
+		if missing.Owner != (common.Hash{}) {
+			id = trie.StorageTrieID(root, missing.Owner, storageRoots[missing.Owner])
+		}
+		tr, err := trie.New(id, tdb)
+		if err != nil {
+			return err
+		}
+		// the proof of a key under the path of the missing node ends with the node.
+		if err = tr.Prove(pathKey(missing.Path), nodes); err != nil {
+			return err
+		}
+		if _, ok := nodes[missing.NodeHash]; !ok {
+			return fmt.Errorf("trie node %s is not found in the state %s", missing.NodeHash.Hex(), root.Hex())
+		}
+	}
+}
+
+// hashPostState applies the post state of the recorded accounts and slots to the tries of
+// the state at root opened on the nodes, the way the state is hashed when it is committed:
+// the updates are applied before the deletions, in the storage tries before the account
+// trie. The accounts which are empty in the post state are deleted.
+func (w *witnessRecorder) hashPostState(post *state.StateDB, root common.Hash, storageRoots map[common.Hash]common.Hash, nodes witnessNodes) error {
+	db := rawdb.NewMemoryDatabase()
+	for hash, node := range nodes {
+		rawdb.WriteLegacyTrieNode(db, hash, node)
+	}
+	tdb := triedb.NewDatabase(db, triedb.HashDefaults)
+	tr, err := trie.NewStateTrie(trie.StateTrieID(root), tdb)
+	if err != nil {
+		return err
+	}
+	var deleted []common.Address
+	for addr := range w.accounts {
+		if !post.Exist(addr) || post.Empty(addr) {
+			deleted = append(deleted, addr)
+			continue
+		}
+		addrHash := crypto.Keccak256Hash(addr.Bytes())
+		storageRoot := types.EmptyRootHash
+		if parentRoot, ok := storageRoots[addrHash]; ok {
+			storageRoot, err = w.hashPostStorage(post, addr, trie.StorageTrieID(root, addrHash, parentRoot), tdb)
+			if err != nil {
+				return err
+			}
+		}
+		err = tr.UpdateAccount(addr, &types.StateAccount{
+			Nonce:    post.GetNonce(addr),
+			Balance:  post.GetBalance(addr),
+			Root:     storageRoot,
+			CodeHash: post.GetCodeHash(addr).Bytes(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, addr := range deleted {
+		if err = tr.DeleteAccount(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *witnessRecorder) hashPostStorage(post *state.StateDB, addr common.Address, id *trie.ID, tdb *triedb.Database) (common.Hash, error) {
+	st, err := trie.NewStateTrie(id, tdb)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var deleted []common.Hash
+	for slot := range w.slots[addr] {
+		value := post.GetState(addr, slot)
+		if value == (common.Hash{}) {
+			deleted = append(deleted, slot)
+			continue
+		}
+		if err = st.UpdateStorage(addr, slot.Bytes(), common.TrimLeftZeroes(value[:])); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	for _, slot := range deleted {
+		if err = st.DeleteStorage(addr, slot.Bytes()); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	return st.Hash(), nil
+}
+
+// pathKey returns a key of a trie whose path starts with the nibbles of path.
+func pathKey(path []byte) []byte {
+	key := make([]byte, (len(path)+1)/2)
+	for i, nibble := range path {
+		if i%2 == 0 {
+			key[i/2] = nibble << 4
+		} else {
+			key[i/2] |= nibble
+		}
+	}
+	return key
+}
+
+// witnessNodes collects the trie nodes of the proofs by their hashes.
+type witnessNodes map[common.Hash][]byte
+
+func (n witnessNodes) Put(key []byte, value []byte) error {
+	n[common.BytesToHash(key)] = common.CopyBytes(value)
+	return nil
+}
+
+func (n witnessNodes) Delete(key []byte) error {
+	panic("not supported")
+}
+
+func sortedByHash(m map[common.Hash][]byte) [][]byte {
+	hashes := make([]common.Hash, 0, len(m))
+	for hash := range m {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	list := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		list[i] = m[hash]
+	}
+	return list
+}
+
+// EncodeWitness encodes the witness as its version followed by its RLP encoding.
+func EncodeWitness(witness *ExecutionWitness) ([]byte, error) {
+	enc, err := rlp.EncodeToBytes(witness)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{WitnessVersion}, enc...), nil
+}
+
+// DecodeWitness decodes a witness encoded by EncodeWitness.
+func DecodeWitness(byt []byte) (*ExecutionWitness, error) {
+	if len(byt) == 0 {
+		return nil, fmt.Errorf("%w: empty witness", ErrWitnessVersion)
+	}
+	if byt[0] != WitnessVersion {
+		return nil, fmt.Errorf("%w: %d", ErrWitnessVersion, byt[0])
+	}
+	witness := new(ExecutionWitness)
+	if err := rlp.DecodeBytes(byt[1:], witness); err != nil {
+		return nil, err
+	}
+	return witness, nil
+}
+
+func witnessKey(height uint64) []byte {
+	key := make([]byte, len(witnessPrefix)+8)
+	copy(key, witnessPrefix)
+	binary.BigEndian.PutUint64(key[len(witnessPrefix):], height)
+	return key
+}
+
+// WriteExecutionWitness stores the encoded witness of the block.
+func WriteExecutionWitness(db ethdb.KeyValueWriter, witness *ExecutionWitness) error {
+	byt, err := EncodeWitness(witness)
+	if err != nil {
+		return err
+	}
+	return db.Put(witnessKey(witness.BlockNumber), byt)
+}
+
+// ReadRawExecutionWitness returns the encoded witness of the block,
+// it is nil if it was not recorded when the block was executed.
+func ReadRawExecutionWitness(db ethdb.KeyValueReader, height uint64) []byte {
+	byt, err := db.Get(witnessKey(height))
+	if err != nil {
+		return nil
+	}
+	return byt
+}
+
+// writeWitness stores the witness of the block being committed, a failure is logged
+// and does not fail the block.
+func (s *Solidity) writeWitness(block *yu_types.Block) {
+	if block.Height == 0 {
+		return
+	}
+	witness, err := s.buildWitness(block)
+	if err == nil {
+		err = WriteExecutionWitness(s.ethState.ethDB, witness)
+	}
+	if err != nil {
+		logrus.Errorf("Solidity failed to write the execution witness of Block(%d), error: %v", block.Height, err)
+	}
+}
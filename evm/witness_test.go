@@ -0,0 +1,111 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+
+	"github.com/reddio-com/reddio/evm/pending_state"
+)
+
+func TestExecutionWitnessRoundTrip(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	witness := &ExecutionWitness{
+		BlockNumber: 7,
+		ParentRoot:  common.HexToHash("0x01"),
+		State:       [][]byte{{0xc0}, {0xc1, 0x80}},
+		Codes:       [][]byte{{0x60, 0x00}},
+		BlockHashes: []WitnessBlockHash{{Number: 5, Hash: common.HexToHash("0x05")}},
+		Txns: []WitnessTxn{
+			{Hash: common.HexToHash("0x0b"), Index: 1, Request: []byte(`{"gasLimit":21000}`)},
+			{Hash: common.HexToHash("0x0a"), Index: 0, Request: []byte(`{"gasLimit":30000}`)},
+		},
+	}
+	if raw := ReadRawExecutionWitness(db, 7); raw != nil {
+		t.Fatalf("Expected no witness before it is written, but got %x", raw)
+	}
+	if err := WriteExecutionWitness(db, witness); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	raw := ReadRawExecutionWitness(db, 7)
+	if len(raw) == 0 || raw[0] != WitnessVersion {
+		t.Fatalf("Expected the witness to start with version %d, but got %x", WitnessVersion, raw)
+	}
+	decoded, err := DecodeWitness(raw)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !reflect.DeepEqual(decoded, witness) {
+		t.Fatalf("Expected witness %+v, but got %+v", witness, decoded)
+	}
+
+	raw[0] = WitnessVersion + 1
+	if _, err = DecodeWitness(raw); !errors.Is(err, ErrWitnessVersion) {
+		t.Fatalf("Expected ErrWitnessVersion, but got %v", err)
+	}
+}
+
+func TestWitnessRecorderAccesses(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0x0a")
+		bob   = common.HexToAddress("0x0b")
+		token = common.HexToAddress("0x0c")
+		slot1 = common.HexToHash("0x01")
+		slot2 = common.HexToHash("0x02")
+	)
+	w := newWitnessRecorder()
+	first := pending_state.NewStateContext(false)
+	first.Read.VisitBalance(alice, 0)
+	first.Read.VisitCode(token, 0)
+	first.Read.VisitState(token, slot1, 0)
+	first.Write.VisitState(token, slot2, 0)
+	w.recordAccesses(first)
+	second := pending_state.NewStateContext(false)
+	second.Write.VisitNonce(bob, 1)
+	second.Read.VisitState(token, slot1, 1)
+	w.recordAccesses(second)
+
+	for _, addr := range []common.Address{alice, bob, token} {
+		if _, ok := w.accounts[addr]; !ok {
+			t.Fatalf("Expected account %s to be recorded", addr.Hex())
+		}
+	}
+	if len(w.accounts) != 3 {
+		t.Fatalf("Expected 3 accounts, but got %d", len(w.accounts))
+	}
+	if len(w.slots) != 1 || len(w.slots[token]) != 2 {
+		t.Fatalf("Expected the 2 slots of the token, but got %v", w.slots)
+	}
+
+	getHash := w.getHashFn(func(n uint64) common.Hash { return common.BigToHash(new(big.Int).SetUint64(n)) })
+	if hash := getHash(3); hash != common.BigToHash(big.NewInt(3)) {
+		t.Fatalf("Expected the hash of the wrapped GetHashFn, but got %s", hash.Hex())
+	}
+	if hash, ok := w.blockHashes[3]; !ok || hash != common.BigToHash(big.NewInt(3)) {
+		t.Fatalf("Expected the hash of block 3 to be recorded, but got %v", w.blockHashes)
+	}
+}
+
+func TestSwapWitness(t *testing.T) {
+	alice := common.HexToAddress("0x0a")
+	shadow := common.HexToAddress("0x0b")
+	s := NewSolidity(&GethConfig{})
+	s.witness.accounts[alice] = struct{}{}
+
+	restore := s.SwapWitness()
+	if len(s.witness.accounts) != 0 {
+		t.Fatalf("Expected a fresh witness, but got %d accounts", len(s.witness.accounts))
+	}
+	s.witness.accounts[shadow] = struct{}{}
+	restore()
+	if _, ok := s.witness.accounts[shadow]; ok {
+		t.Fatalf("Expected the accesses of the re-execution to be dropped")
+	}
+	if _, ok := s.witness.accounts[alice]; !ok || len(s.witness.accounts) != 1 {
+		t.Fatalf("Expected the witness of the block to be restored, but got %d accounts", len(s.witness.accounts))
+	}
+}
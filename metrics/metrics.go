@@ -6,6 +6,8 @@ const (
 	TypeLbl       = "type"
 	TypeCountLbl  = "count"
 	TypeStatusLbl = "status"
+	AddressLbl    = "address"
+	SlotLbl       = "slot"
 )
 
 var (
@@ -60,6 +62,36 @@ var (
 		[]string{TypeCountLbl},
 	)
 
+	ConflictKeyCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "reddio",
+			Subsystem: "parallel",
+			Name:      "conflict_key_total",
+			Help:      "Total number of keys causing conflicts in parallel execution",
+		},
+		[]string{TypeLbl},
+	)
+
+	ConflictHotKeyGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "reddio",
+			Subsystem: "parallel",
+			Name:      "conflict_hot_key_count",
+			Help:      "conflict count of the hottest keys in recent blocks",
+		},
+		[]string{AddressLbl, SlotLbl},
+	)
+
+	DiffExecutionCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "reddio",
+			Subsystem: "parallel",
+			Name:      "diff_execution_total",
+			Help:      "Total number of blocks compared between parallel and serial execution",
+		},
+		[]string{TypeStatusLbl},
+	)
+
 	BlockExecuteTxnDurationGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: "reddio",
@@ -208,6 +240,10 @@ func init() {
 	prometheus.MustRegister(BatchTxnSplitCounter)
 	prometheus.MustRegister(BatchTxnDuration)
 
+	prometheus.MustRegister(ConflictKeyCounter)
+	prometheus.MustRegister(ConflictHotKeyGauge)
+	prometheus.MustRegister(DiffExecutionCounter)
+
 	prometheus.MustRegister(DownwardMessageSuccessCounter)
 	prometheus.MustRegister(DownwardMessageFailureCounter)
 	prometheus.MustRegister(DownwardMessageReceivedCounter)
@@ -0,0 +1,106 @@
+package parallel
+
+import (
+	common2 "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type slotKey struct {
+	addr common2.Address
+	slot common2.Hash
+}
+
+// txnAccess is the statically known footprint of a txn. Accounts are touched
+// as a whole (balance, nonce, code), slots only touch a single storage key.
+type txnAccess struct {
+	accounts map[common2.Address]struct{}
+	slots    map[slotKey]struct{}
+}
+
+// newTxnAccess builds the footprint of a txn from its origin, its recipient and
+// its EIP-2930 access list, falling back to the predicted access list.
+// Without any access list only the origin and the recipient are touched.
+// The footprint is not binding, see ParallelEvmExecutor.reorderedConflict.
+func newTxnAccess(tctx *txnCtx) *txnAccess {
+	ta := &txnAccess{
+		accounts: make(map[common2.Address]struct{}),
+		slots:    make(map[slotKey]struct{}),
+	}
+	req := tctx.req
+	ta.accounts[req.Origin] = struct{}{}
+	if req.Address == nil {
+		ta.accounts[crypto.CreateAddress(req.Origin, req.Nonce)] = struct{}{}
+	}
+	al, ok := req.AccessList()
+	if !ok {
+		if req.Address != nil {
+			ta.accounts[*req.Address] = struct{}{}
+		}
+		return ta
+	}
+	listed := make(map[common2.Address]struct{})
+	for _, tuple := range al {
+		listed[tuple.Address] = struct{}{}
+		if len(tuple.StorageKeys) == 0 {
+			ta.accounts[tuple.Address] = struct{}{}
+			continue
+		}
+		for _, slot := range tuple.StorageKeys {
+			ta.slots[slotKey{addr: tuple.Address, slot: slot}] = struct{}{}
+		}
+	}
+	// the recipient is touched as a whole when it receives value or when
+	// the access list says nothing about its storage.
+	if req.Address != nil {
+		_, isListed := listed[*req.Address]
+		if !isListed || (req.Value != nil && req.Value.Sign() > 0) {
+			ta.accounts[*req.Address] = struct{}{}
+		}
+	}
+	return ta
+}
+
+// buildTxnLevels builds the dependency DAG of the txns and returns it as levels.
+// A txn depends on every earlier txn whose footprint overlaps its own, and it
+// is put in the level right after the deepest of them. Txns in the same level
+// are conflict-free with each other and keep their block order.
+func buildTxnLevels(list []*txnCtx) [][]*txnCtx {
+	levels := make([][]*txnCtx, 0)
+	// the deepest level which touched the address in any way.
+	addrLevel := make(map[common2.Address]int)
+	// the deepest level which touched the account as a whole.
+	accountLevel := make(map[common2.Address]int)
+	slotLevel := make(map[slotKey]int)
+	deeper := func(level int, m map[common2.Address]int, addr common2.Address) int {
+		if l, ok := m[addr]; ok && l+1 > level {
+			return l + 1
+		}
+		return level
+	}
+	for _, tctx := range list {
+		ta := newTxnAccess(tctx)
+		level := 0
+		for addr := range ta.accounts {
+			level = deeper(level, addrLevel, addr)
+		}
+		for key := range ta.slots {
+			level = deeper(level, accountLevel, key.addr)
+			if l, ok := slotLevel[key]; ok && l+1 > level {
+				level = l + 1
+			}
+		}
+		for addr := range ta.accounts {
+			accountLevel[addr] = max(accountLevel[addr], level)
+			addrLevel[addr] = max(addrLevel[addr], level)
+		}
+		for key := range ta.slots {
+			slotLevel[key] = max(slotLevel[key], level)
+			addrLevel[key.addr] = max(addrLevel[key.addr], level)
+		}
+		if level == len(levels) {
+			levels = append(levels, make([]*txnCtx, 0))
+		}
+		levels[level] = append(levels[level], tctx)
+	}
+	return levels
+}
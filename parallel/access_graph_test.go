@@ -0,0 +1,93 @@
+package parallel
+
+import (
+	"encoding/json"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/reddio-com/reddio/evm"
+)
+
+func newTestTxnCtx(t *testing.T, origin, to common.Address, al types.AccessList) *txnCtx {
+	args := &evm.TempTransactionArgs{}
+	if al != nil {
+		args.AccessList = &al
+	}
+	byt, err := json.Marshal(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return &txnCtx{req: &evm.TxRequest{
+		Origin:     origin,
+		Address:    &to,
+		Value:      big.NewInt(0),
+		Hash:       common.BytesToHash(append(origin.Bytes(), to.Bytes()...)),
+		OriginArgs: byt,
+	}}
+}
+
+func TestBuildTxnLevels(t *testing.T) {
+	router := common.HexToAddress("0x01")
+	token := common.HexToAddress("0x02")
+	other := common.HexToAddress("0x03")
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb0")
+	carol := common.HexToAddress("0xc0")
+
+	slotA := common.HexToHash("0x0a")
+	slotB := common.HexToHash("0x0b")
+	list := []*txnCtx{
+		// alice and bob both call the token through the router, on different slots.
+		newTestTxnCtx(t, alice, router, types.AccessList{{Address: router, StorageKeys: []common.Hash{slotA}}, {Address: token, StorageKeys: []common.Hash{slotA}}}),
+		newTestTxnCtx(t, bob, router, types.AccessList{{Address: router, StorageKeys: []common.Hash{slotB}}, {Address: token, StorageKeys: []common.Hash{slotB}}}),
+		// carol touches the same token slot as alice.
+		newTestTxnCtx(t, carol, router, types.AccessList{{Address: token, StorageKeys: []common.Hash{slotA}}}),
+		// alice again, depends on her first txn by nonce.
+		newTestTxnCtx(t, alice, other, nil),
+	}
+	levels := buildTxnLevels(list)
+	if len(levels) != 2 {
+		t.Fatalf("Expected 2 levels, but got %d", len(levels))
+	}
+	if !slices.Equal(levels[0], list[:2]) {
+		t.Fatalf("Expected first two txns in level 0")
+	}
+	if !slices.Equal(levels[1], list[2:]) {
+		t.Fatalf("Expected last two txns in level 1")
+	}
+}
+
+func TestBuildTxnLevelsPredicted(t *testing.T) {
+	router := common.HexToAddress("0x01")
+	token := common.HexToAddress("0x02")
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb0")
+
+	list := []*txnCtx{
+		newTestTxnCtx(t, alice, router, nil),
+		newTestTxnCtx(t, bob, router, nil),
+	}
+	// without access lists both txns touch the router as a whole.
+	if levels := buildTxnLevels(list); len(levels) != 2 {
+		t.Fatalf("Expected 2 levels, but got %d", len(levels))
+	}
+
+	// the predicted access lists put them on different slots.
+	evm.SetPredictedAccessList(list[0].req.Hash, types.AccessList{{Address: router, StorageKeys: []common.Hash{common.HexToHash("0x0a")}}, {Address: token}})
+	evm.SetPredictedAccessList(list[1].req.Hash, types.AccessList{{Address: router, StorageKeys: []common.Hash{common.HexToHash("0x0b")}}})
+	levels := buildTxnLevels(list)
+	if len(levels) != 1 || !slices.Equal(levels[0], list) {
+		t.Fatalf("Expected both txns in level 0, but got %d levels", len(levels))
+	}
+
+	// the access list signed with the txn wins over the predicted one.
+	list[1] = newTestTxnCtx(t, bob, router, types.AccessList{{Address: token}})
+	evm.SetPredictedAccessList(list[1].req.Hash, nil)
+	if levels = buildTxnLevels(list); len(levels) != 2 {
+		t.Fatalf("Expected 2 levels, but got %d", len(levels))
+	}
+}
@@ -0,0 +1,180 @@
+package parallel
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/yu-org/yu/common"
+	"github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm/pending_state"
+	"github.com/reddio-com/reddio/metrics"
+)
+
+// stmTask tracks the latest incarnation of a transaction in the block-stm executor.
+type stmTask struct {
+	// snapshot is the number of committed transactions the incarnation was executed on.
+	snapshot    int
+	incarnation int
+	executed    bool
+}
+
+// BlockStmEvmExecutor executes the block optimistically: every transaction
+// runs against a copy of the committed prefix, then it is validated in block order
+// against the multi-version memory. Only the transactions which read values
+// written after their snapshot are executed again.
+type BlockStmEvmExecutor struct {
+	k        *ParallelEVM
+	cpdb     *state.StateDB
+	cpdbMu   sync.Mutex
+	receipts map[common.Hash]*types.Receipt
+	txnList  []*txnCtx
+	tasks    []*stmTask
+	mv       *mvMemory
+}
+
+func NewBlockStmEvmExecutor(evm *ParallelEVM) *BlockStmEvmExecutor {
+	return &BlockStmEvmExecutor{
+		k: evm,
+	}
+}
+
+func (e *BlockStmEvmExecutor) Prepare(block *types.Block) {
+	e.k.prepareExecute()
+	txnCtxList, receipts := e.k.prepareTxnList(block)
+	e.receipts = receipts
+	e.k.updateTxnObjInc(txnCtxList)
+	e.txnList = txnCtxList
+	e.tasks = make([]*stmTask, len(txnCtxList))
+	for i := range e.tasks {
+		e.tasks[i] = &stmTask{}
+	}
+	e.mv = newMVMemory()
+	e.cpdb = e.k.Solidity.StateDBCopy()
+}
+
+func (e *BlockStmEvmExecutor) Execute(block *types.Block) {
+	start := time.Now()
+	defer func() {
+		e.k.statManager.ExecuteTxnDuration = time.Since(start)
+	}()
+	committed := 0
+	for committed < len(e.txnList) {
+		e.executeRound(committed)
+		committed = e.validateAndCommit(committed)
+	}
+	e.k.Solidity.SetStateDB(e.cpdb)
+	for _, c := range e.txnList {
+		e.receipts[c.txn.TxnHash] = c.receipt
+	}
+	e.k.gcCopiedStateDB(nil, e.txnList)
+}
+
+func (e *BlockStmEvmExecutor) Receipts(block *types.Block) map[common.Hash]*types.Receipt {
+	return e.receipts
+}
+
+func (e *BlockStmEvmExecutor) executedTxns() []*txnCtx {
+	return e.txnList
+}
+
+// executeRound executes up to MaxConcurrency pending transactions, all on
+// the state of the first `committed` transactions.
+func (e *BlockStmEvmExecutor) executeRound(committed int) {
+	concurrency := config.GetGlobalConfig().MaxConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	indexes := make([]int, 0, concurrency)
+	for i := committed; i < len(e.txnList) && len(indexes) < concurrency; i++ {
+		if !e.tasks[i].executed {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return
+	}
+	e.k.statManager.TxnBatchCount++
+	copiedStateDBList := e.copyStateDb(indexes)
+	wg := sync.WaitGroup{}
+	for i, index := range indexes {
+		wg.Add(1)
+		go func(tctx *txnCtx, task *stmTask, cpDb *pending_state.PendingStateWrapper) {
+			defer wg.Done()
+			tctx.err = nil
+			tctx.ctx.ExtraInterface = cpDb
+			err := tctx.writing(tctx.ctx)
+			if err != nil {
+				tctx.err = err
+				tctx.receipt = e.k.handleTxnError(err, tctx.ctx, tctx.ctx.Block, tctx.txn)
+			} else {
+				tctx.receipt = e.k.handleTxnEvent(tctx.ctx, tctx.ctx.Block, tctx.txn, task.incarnation > 0)
+			}
+			tctx.ps = tctx.ctx.ExtraInterface.(*pending_state.PendingStateWrapper)
+			tctx.sctx = tctx.ps.GetCtx()
+			task.snapshot = committed
+			task.executed = true
+		}(e.txnList[index], e.tasks[index], copiedStateDBList[i])
+	}
+	wg.Wait()
+}
+
+// validateAndCommit merges the executed transactions into the state in block
+// order, starting from `committed`. It stops at the first transaction that is
+// not executed yet or whose reads are stale, and returns the new committed count.
+func (e *BlockStmEvmExecutor) validateAndCommit(committed int) int {
+	for committed < len(e.txnList) {
+		tctx, task := e.txnList[committed], e.tasks[committed]
+		if !task.executed {
+			break
+		}
+		if key, stale := e.staleKey(committed); stale {
+			GetConflictHeatmap().Record([]pending_state.ConflictKey{key.conflictKey()})
+			task.executed = false
+			task.incarnation++
+			e.k.statManager.ConflictCount++
+			e.k.statManager.TxnReExecuteCount++
+			metrics.BatchTxnCounter.WithLabelValues(batchTxnLabelRedo).Inc()
+			break
+		}
+		sctx := tctx.ps.GetCtx()
+		tctx.ps.MergeInto(e.cpdb, tctx.req.Origin)
+		e.mv.record(mvVersion{txnIndex: committed, incarnation: task.incarnation}, writeKeys(sctx, tctx.req.Origin))
+		tctx.ctx.ExtraInterface = nil
+		tctx.ps = nil
+		metrics.BatchTxnCounter.WithLabelValues(batchTxnLabelSuccess).Inc()
+		committed++
+	}
+	return committed
+}
+
+// staleKey returns the key txn `index` depends on which is written by a txn
+// committed after its snapshot, if any.
+func (e *BlockStmEvmExecutor) staleKey(index int) (mvKey, bool) {
+	task := e.tasks[index]
+	if task.snapshot == index {
+		return mvKey{}, false
+	}
+	tctx := e.txnList[index]
+	for _, key := range readKeys(tctx.ps.GetCtx(), tctx.req.Origin) {
+		if _, ok := e.mv.writtenBetween(key, task.snapshot, index); ok {
+			return key, true
+		}
+	}
+	return mvKey{}, false
+}
+
+func (e *BlockStmEvmExecutor) copyStateDb(indexes []int) []*pending_state.PendingStateWrapper {
+	start := time.Now()
+	defer func() {
+		e.k.statManager.CopyDuration += time.Since(start)
+	}()
+	copiedStateDBList := make([]*pending_state.PendingStateWrapper, 0, len(indexes))
+	for _, index := range indexes {
+		overlay := pending_state.NewOverlayStateDB(e.cpdb, &e.cpdbMu)
+		copiedStateDBList = append(copiedStateDBList, pending_state.NewPendingStateWrapper(pending_state.NewOverlayStateDBWrapper(overlay), pending_state.NewStateContext(false), int64(index)))
+	}
+	return copiedStateDBList
+}
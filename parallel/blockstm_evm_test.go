@@ -0,0 +1,53 @@
+package parallel
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+
+	"github.com/reddio-com/reddio/config"
+)
+
+// TestBlockStmMatchesSerial executes txns depending on each other in one round, block-stm
+// has to execute the stale ones again to get the same result as the serial execution.
+func TestBlockStmMatchesSerial(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0xa1")
+		bob   = common.HexToAddress("0xb0")
+		carol = common.HexToAddress("0xc0")
+		dave  = common.HexToAddress("0xd0")
+		fresh = common.HexToAddress("0xf0")
+		// SSTORE(0, EXTCODEHASH(fresh)), EXTCODEHASH reads the emptiness of fresh first.
+		codeHashOf = common.HexToAddress("0x1001")
+		// SSTORE(0, SLOAD(0) + 1)
+		counter = common.HexToAddress("0x1002")
+	)
+	chain := newTestChain(t, func(sdb *state.StateDB) {
+		fundTestAccounts(alice, bob, carol, dave)(sdb)
+		code := append([]byte{byte(vm.PUSH20)}, fresh.Bytes()...)
+		sdb.SetCode(codeHashOf, append(code, byte(vm.EXTCODEHASH), byte(vm.PUSH1), 0, byte(vm.SSTORE), byte(vm.STOP)))
+		sdb.SetCode(counter, []byte{byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE), byte(vm.STOP)})
+	})
+	block := newTestBlock(
+		newTestTxRequest(alice, fresh, 0, 1000, nil),
+		newTestTxRequest(bob, codeHashOf, 0, 0, nil),
+		newTestTxRequest(carol, counter, 0, 0, nil),
+		newTestTxRequest(dave, counter, 0, 0, nil),
+		newTestTxRequest(alice, bob, 1, 1, nil),
+		newTestTxRequest(bob, counter, 1, 0, nil),
+	)
+
+	testExecutor(t, false, "", 1)
+	serialReceipts, serialRoot, _ := chain.replay(t, block)
+	for i, stxn := range block.Txns {
+		if receipt := serialReceipts[stxn.TxnHash]; receipt == nil || receipt.Error != "" {
+			t.Fatalf("Expected txn %d to succeed, but got %+v", i, receipt)
+		}
+	}
+
+	testExecutor(t, true, config.ExecutorBlockStm, len(block.Txns))
+	receipts, root, _ := chain.replay(t, block)
+	checkSameExecution(t, block, serialReceipts, receipts, serialRoot, root)
+}
@@ -0,0 +1,152 @@
+package parallel
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	common2 "github.com/ethereum/go-ethereum/common"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm/pending_state"
+	"github.com/reddio-com/reddio/metrics"
+)
+
+const (
+	defaultConflictHeatmapWindow = 100
+	defaultConflictHeatmapTopN   = 20
+
+	conflictKeyLabelAddress = "address"
+	conflictKeyLabelSlot    = "slot"
+)
+
+// ConflictHeat is the number of conflicts caused by an address or a storage slot.
+type ConflictHeat struct {
+	Address common2.Address `json:"address"`
+	Slot    *common2.Hash   `json:"slot,omitempty"`
+	Count   uint64          `json:"count"`
+}
+
+// ConflictHeatmapResult is the result of the `debug_parallelConflicts` RPC call.
+type ConflictHeatmapResult struct {
+	Blocks  int             `json:"blocks"`
+	HotKeys []*ConflictHeat `json:"hotKeys"`
+}
+
+// ConflictHeatmap counts the keys causing conflicts in the parallel executor,
+// over a rolling window of the recent blocks.
+type ConflictHeatmap struct {
+	sync.Mutex
+	current map[pending_state.ConflictKey]uint64
+	buckets []map[pending_state.ConflictKey]uint64
+	total   map[pending_state.ConflictKey]uint64
+}
+
+var conflictHeatmap = NewConflictHeatmap()
+
+// GetConflictHeatmap returns the heatmap the executors record conflicts into.
+func GetConflictHeatmap() *ConflictHeatmap {
+	return conflictHeatmap
+}
+
+func NewConflictHeatmap() *ConflictHeatmap {
+	return &ConflictHeatmap{
+		current: make(map[pending_state.ConflictKey]uint64),
+		buckets: make([]map[pending_state.ConflictKey]uint64, 0),
+		total:   make(map[pending_state.ConflictKey]uint64),
+	}
+}
+
+// Record counts the keys of a conflict into the current block.
+func (h *ConflictHeatmap) Record(keys []pending_state.ConflictKey) {
+	h.Lock()
+	defer h.Unlock()
+	for _, key := range keys {
+		h.current[key]++
+		h.total[key]++
+		if key.IsSlot {
+			metrics.ConflictKeyCounter.WithLabelValues(conflictKeyLabelSlot).Inc()
+		} else {
+			metrics.ConflictKeyCounter.WithLabelValues(conflictKeyLabelAddress).Inc()
+		}
+	}
+}
+
+// Roll closes the current block, drops the blocks out of the window and
+// exports the hottest keys as metrics.
+func (h *ConflictHeatmap) Roll() {
+	h.Lock()
+	defer h.Unlock()
+	h.buckets = append(h.buckets, h.current)
+	h.current = make(map[pending_state.ConflictKey]uint64)
+	for len(h.buckets) > conflictHeatmapWindow() {
+		for key, count := range h.buckets[0] {
+			h.total[key] -= count
+			if h.total[key] == 0 {
+				delete(h.total, key)
+			}
+		}
+		h.buckets = h.buckets[1:]
+	}
+
+	metrics.ConflictHotKeyGauge.Reset()
+	for _, heat := range h.top(conflictHeatmapTopN()) {
+		slot := ""
+		if heat.Slot != nil {
+			slot = heat.Slot.Hex()
+		}
+		metrics.ConflictHotKeyGauge.WithLabelValues(heat.Address.Hex(), slot).Set(float64(heat.Count))
+	}
+}
+
+// Top returns the n hottest keys in the window, n <= 0 means the configured top n.
+func (h *ConflictHeatmap) Top(n int) *ConflictHeatmapResult {
+	h.Lock()
+	defer h.Unlock()
+	if n <= 0 {
+		n = conflictHeatmapTopN()
+	}
+	return &ConflictHeatmapResult{
+		Blocks:  len(h.buckets),
+		HotKeys: h.top(n),
+	}
+}
+
+func (h *ConflictHeatmap) top(n int) []*ConflictHeat {
+	heats := make([]*ConflictHeat, 0, len(h.total))
+	for key, count := range h.total {
+		heat := &ConflictHeat{Address: key.Address, Count: count}
+		if key.IsSlot {
+			slot := key.Slot
+			heat.Slot = &slot
+		}
+		heats = append(heats, heat)
+	}
+	sort.Slice(heats, func(i, j int) bool {
+		if heats[i].Count != heats[j].Count {
+			return heats[i].Count > heats[j].Count
+		}
+		if c := bytes.Compare(heats[i].Address.Bytes(), heats[j].Address.Bytes()); c != 0 {
+			return c < 0
+		}
+		return heats[i].Slot != nil && (heats[j].Slot == nil || bytes.Compare(heats[i].Slot.Bytes(), heats[j].Slot.Bytes()) < 0)
+	})
+	if len(heats) > n {
+		heats = heats[:n]
+	}
+	return heats
+}
+
+func conflictHeatmapWindow() int {
+	if window := config.GetGlobalConfig().ConflictHeatmapWindow; window > 0 {
+		return window
+	}
+	return defaultConflictHeatmapWindow
+}
+
+func conflictHeatmapTopN() int {
+	if n := config.GetGlobalConfig().ConflictHeatmapTopN; n > 0 {
+		return n
+	}
+	return defaultConflictHeatmapTopN
+}
@@ -0,0 +1,62 @@
+package parallel
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm/pending_state"
+)
+
+func TestConflictHeatmap(t *testing.T) {
+	cfg := config.GetGlobalConfig()
+	window := cfg.ConflictHeatmapWindow
+	defer func() {
+		cfg.ConflictHeatmapWindow = window
+	}()
+	cfg.ConflictHeatmapWindow = 2
+
+	exchange := common.HexToAddress("0x01")
+	token := common.HexToAddress("0x02")
+	slot := common.HexToHash("0x0a")
+	// the txns pay the same exchange, and the first one of them also updates a slot of the token.
+	newTxnCtx := func(txnID int64, withSlot bool) *pending_state.StateContext {
+		sctx := pending_state.NewStateContext(false)
+		if err := sctx.WriteBalance(exchange, txnID); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if withSlot {
+			if err := sctx.WriteState(token, slot, txnID); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+		}
+		return sctx
+	}
+
+	h := NewConflictHeatmap()
+	h.Record(newTxnCtx(1, true).ConflictKeys(newTxnCtx(2, true)))
+	h.Roll()
+	h.Record(newTxnCtx(3, false).ConflictKeys(newTxnCtx(4, false)))
+	h.Roll()
+	result := h.Top(0)
+	if result.Blocks != 2 || len(result.HotKeys) != 2 {
+		t.Fatalf("Expected 2 hot keys in 2 blocks, but got %d keys in %d blocks", len(result.HotKeys), result.Blocks)
+	}
+	if hot := result.HotKeys[0]; hot.Address != exchange || hot.Slot != nil || hot.Count != 2 {
+		t.Fatalf("Expected the balance of the exchange to be the hottest key, but got %+v", hot)
+	}
+	if hot := result.HotKeys[1]; hot.Address != token || hot.Slot == nil || *hot.Slot != slot || hot.Count != 1 {
+		t.Fatalf("Expected the slot of the token to be the second key, but got %+v", hot)
+	}
+	if top := h.Top(1); len(top.HotKeys) != 1 {
+		t.Fatalf("Expected 1 hot key, but got %d", len(top.HotKeys))
+	}
+
+	// the first block drops out of the window.
+	h.Roll()
+	result = h.Top(0)
+	if len(result.HotKeys) != 1 || result.HotKeys[0].Address != exchange || result.HotKeys[0].Count != 1 {
+		t.Fatalf("Expected only the conflict of the second block, but got %d keys", len(result.HotKeys))
+	}
+}
@@ -0,0 +1,261 @@
+package parallel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	common2 "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/sirupsen/logrus"
+	"github.com/yu-org/yu/common"
+	"github.com/yu-org/yu/core/context"
+	"github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm"
+	"github.com/reddio-com/reddio/metrics"
+)
+
+const (
+	diffLabelMatch    = "match"
+	diffLabelDiverged = "diverged"
+)
+
+// ReceiptTrace is the part of a txn receipt compared by the differential mode.
+type ReceiptTrace struct {
+	TxHash          common2.Hash    `json:"txHash"`
+	Status          uint64          `json:"status"`
+	GasUsed         uint64          `json:"gasUsed"`
+	ContractAddress common2.Address `json:"contractAddress"`
+	Error           string          `json:"error,omitempty"`
+	Logs            []*ethtypes.Log `json:"logs"`
+}
+
+type ReceiptDiff struct {
+	TxHash   common2.Hash  `json:"txHash"`
+	Parallel *ReceiptTrace `json:"parallel"`
+	Serial   *ReceiptTrace `json:"serial"`
+}
+
+type BalanceDiff struct {
+	Address  common2.Address `json:"address"`
+	Parallel *hexutil.Big    `json:"parallel"`
+	Serial   *hexutil.Big    `json:"serial"`
+}
+
+// DiffReport is dumped to disk when the parallel and the serial executor
+// diverge on a block.
+type DiffReport struct {
+	BlockHeight            common.BlockNum `json:"blockHeight"`
+	BlockHash              common.Hash     `json:"blockHash"`
+	ExecutorType           string          `json:"executorType"`
+	ParallelRoot           common2.Hash    `json:"parallelRoot"`
+	SerialRoot             common2.Hash    `json:"serialRoot"`
+	ParallelCoinbaseReward *uint256.Int    `json:"parallelCoinbaseReward"`
+	SerialCoinbaseReward   *uint256.Int    `json:"serialCoinbaseReward"`
+	ReceiptDiffs           []*ReceiptDiff  `json:"receiptDiffs,omitempty"`
+	BalanceDiffs           []*BalanceDiff  `json:"balanceDiffs,omitempty"`
+	ParallelTrace          []*ReceiptTrace `json:"parallelTrace"`
+	SerialTrace            []*ReceiptTrace `json:"serialTrace"`
+}
+
+func (r *DiffReport) diverged() bool {
+	return r.ParallelRoot != r.SerialRoot || r.ParallelCoinbaseReward.Cmp(r.SerialCoinbaseReward) != 0 ||
+		len(r.ReceiptDiffs) > 0 || len(r.BalanceDiffs) > 0
+}
+
+// diffExecution re-executes a block with the serial executor on a separate
+// copy of the pre-state, and compares it with the result of the parallel executor.
+type diffExecution struct {
+	k        *ParallelEVM
+	preState *state.StateDB
+	preFees  map[common2.Hash]*evm.TxFee
+}
+
+func (k *ParallelEVM) newDiffExecution() *diffExecution {
+	return &diffExecution{
+		k:        k,
+		preState: k.Solidity.StateDBCopy(),
+		preFees:  k.Solidity.TxFees(),
+	}
+}
+
+func (d *diffExecution) check(block *types.Block, receipts map[common.Hash]*types.Receipt) {
+	parallelState := d.k.Solidity.StateDBCopy()
+	parallelReward := d.k.Solidity.BlockFees(block).CoinbaseReward
+	serialReceipts, serialTxns, serialReward := d.executeSerial(block)
+
+	report := &DiffReport{
+		BlockHeight:            block.Height,
+		BlockHash:              block.Hash,
+		ExecutorType:           config.GetGlobalConfig().ExecutorType,
+		ParallelRoot:           parallelState.IntermediateRoot(true),
+		SerialRoot:             d.preState.IntermediateRoot(true),
+		ParallelCoinbaseReward: parallelReward,
+		SerialCoinbaseReward:   serialReward,
+		ReceiptDiffs:           make([]*ReceiptDiff, 0),
+		BalanceDiffs:           make([]*BalanceDiff, 0),
+		ParallelTrace:          make([]*ReceiptTrace, 0, len(block.Txns)),
+		SerialTrace:            make([]*ReceiptTrace, 0, len(block.Txns)),
+	}
+	for _, stxn := range block.Txns {
+		pt := newReceiptTrace(stxn.TxnHash, receipts[stxn.TxnHash])
+		st := newReceiptTrace(stxn.TxnHash, serialReceipts[stxn.TxnHash])
+		report.ParallelTrace = append(report.ParallelTrace, pt)
+		report.SerialTrace = append(report.SerialTrace, st)
+		if !pt.equal(st) {
+			report.ReceiptDiffs = append(report.ReceiptDiffs, &ReceiptDiff{TxHash: pt.TxHash, Parallel: pt, Serial: st})
+		}
+	}
+	for addr := range touchedAddresses(d.k.processor.executedTxns(), serialTxns) {
+		pb, sb := parallelState.GetBalance(addr), d.preState.GetBalance(addr)
+		if pb.Cmp(sb) != 0 {
+			report.BalanceDiffs = append(report.BalanceDiffs, &BalanceDiff{
+				Address:  addr,
+				Parallel: (*hexutil.Big)(pb.ToBig()),
+				Serial:   (*hexutil.Big)(sb.ToBig()),
+			})
+		}
+	}
+
+	if !report.diverged() {
+		metrics.DiffExecutionCounter.WithLabelValues(diffLabelMatch).Inc()
+		return
+	}
+	metrics.DiffExecutionCounter.WithLabelValues(diffLabelDiverged).Inc()
+	path, err := writeDiffReport(report)
+	if err != nil {
+		logrus.Errorf("parallel and serial execution diverged on block(%d), failed to write report: %v", block.Height, err)
+		return
+	}
+	logrus.Errorf("parallel and serial execution diverged on block(%d), parallel root %s, serial root %s, report: %s",
+		block.Height, report.ParallelRoot.Hex(), report.SerialRoot.Hex(), path)
+}
+
+// executeSerial executes the block with the serial executor on the pre-state
+// copy. The receipts are not emitted and the txn fees, traces and witness of the
+// parallel execution are restored afterward.
+func (d *diffExecution) executeSerial(block *types.Block) (map[common.Hash]*types.Receipt, []*txnCtx, *uint256.Int) {
+	statManager := d.k.statManager
+	parallelFees := d.k.Solidity.TxFees()
+	parallelTraces := d.k.Solidity.TxTraces()
+	d.k.statManager = &BlockTxnStatManager{TxnCount: len(block.Txns)}
+	d.k.shadowRun = true
+	d.k.Solidity.SetTxFees(d.preFees)
+	restoreWitness := d.k.Solidity.SwapWitness()
+	defer func() {
+		restoreWitness()
+		d.k.shadowRun = false
+		d.k.statManager = statManager
+		d.k.Solidity.SetTxFees(parallelFees)
+		d.k.Solidity.SetTxTraces(parallelTraces)
+	}()
+	serial := &SerialEvmExecutor{k: d.k, db: d.preState}
+	serial.Prepare(block)
+	serial.Execute(block)
+	return serial.Receipts(block), serial.executedTxns(), d.k.Solidity.BlockFees(block).CoinbaseReward
+}
+
+func newReceiptTrace(txHash common.Hash, receipt *types.Receipt) *ReceiptTrace {
+	trace := &ReceiptTrace{TxHash: common2.Hash(txHash), Logs: make([]*ethtypes.Log, 0)}
+	if receipt == nil {
+		trace.Error = "missing receipt"
+		return trace
+	}
+	trace.Error = receipt.Error
+	if receipt.Extra == nil {
+		return trace
+	}
+	ethRcpt := new(ethtypes.Receipt)
+	if err := json.Unmarshal(receipt.Extra, ethRcpt); err != nil {
+		trace.Error = fmt.Sprintf("decode receipt: %v", err)
+		return trace
+	}
+	trace.Status = ethRcpt.Status
+	trace.GasUsed = ethRcpt.GasUsed
+	trace.ContractAddress = ethRcpt.ContractAddress
+	if ethRcpt.Logs != nil {
+		trace.Logs = ethRcpt.Logs
+	}
+	return trace
+}
+
+func (t *ReceiptTrace) equal(o *ReceiptTrace) bool {
+	if t.Status != o.Status || t.GasUsed != o.GasUsed || t.ContractAddress != o.ContractAddress ||
+		t.Error != o.Error || len(t.Logs) != len(o.Logs) {
+		return false
+	}
+	for i, log := range t.Logs {
+		if !logEqual(log, o.Logs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func logEqual(a, b *ethtypes.Log) bool {
+	if a.Address != b.Address || !bytes.Equal(a.Data, b.Data) || len(a.Topics) != len(b.Topics) {
+		return false
+	}
+	for i, topic := range a.Topics {
+		if topic != b.Topics[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// touchedAddresses returns the accounts whose balance may be changed by the executed
+// txns, including the ones written by the internal calls.
+func touchedAddresses(lists ...[]*txnCtx) map[common2.Address]struct{} {
+	addrs := make(map[common2.Address]struct{})
+	for _, list := range lists {
+		for _, tctx := range list {
+			addrs[tctx.req.Origin] = struct{}{}
+			if tctx.sctx == nil {
+				continue
+			}
+			for addr := range tctx.sctx.GetWriteBalance() {
+				addrs[addr] = struct{}{}
+			}
+			// the created and the destructed accounts.
+			for addr := range tctx.sctx.GetWriteAccount() {
+				addrs[addr] = struct{}{}
+			}
+		}
+	}
+	return addrs
+}
+
+func writeDiffReport(report *DiffReport) (string, error) {
+	dir := config.GetGlobalConfig().DiffReportDir
+	if dir == "" {
+		dir = "diff_reports"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	byt, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("block-%d-%s.json", report.BlockHeight, report.BlockHash.Hex()))
+	return path, os.WriteFile(path, byt, 0644)
+}
+
+func shadowReceipt(err error, ctx *context.WriteContext, block *types.Block, stxn *types.SignedTxn) *types.Receipt {
+	if ctx == nil {
+		receipt := types.NewReceipt(nil, err, nil)
+		receipt.FillMetadata(block, stxn, 0)
+		return receipt
+	}
+	receipt := types.NewReceipt(ctx.Events, err, ctx.Extra)
+	receipt.FillMetadata(block, stxn, ctx.LeiCost)
+	return receipt
+}
@@ -0,0 +1,116 @@
+package parallel
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+
+	"github.com/reddio-com/reddio/config"
+)
+
+// TestDiffExecutionReport ignores the conflict of two txns of a batch, which pay the
+// recipient picked by a counter through different contracts. The report lists the
+// internally paid accounts, which are neither the origins nor the recipients of the txns.
+func TestDiffExecutionReport(t *testing.T) {
+	var (
+		carol = common.HexToAddress("0xc0")
+		dave  = common.HexToAddress("0xd0")
+		// CALL(GAS, 0x3000 + counter++, 1000, 0, 0, 0, 0)
+		payer   = common.HexToAddress("0x1004")
+		proxies = []common.Address{common.HexToAddress("0x2001"), common.HexToAddress("0x2002")}
+		paid    = []common.Address{common.HexToAddress("0x3000"), common.HexToAddress("0x3001")}
+	)
+	chain := newTestChain(t, func(sdb *state.StateDB) {
+		fundTestAccounts(carol, dave, payer)(sdb)
+		sdb.SetCode(payer, []byte{
+			byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH2), 0x03, 0xe8,
+			byte(vm.PUSH1), 0, byte(vm.SLOAD),
+			byte(vm.DUP1), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+			byte(vm.PUSH2), 0x30, 0x00, byte(vm.ADD),
+			byte(vm.GAS), byte(vm.CALL), byte(vm.POP), byte(vm.STOP),
+		})
+		// CALL(GAS, payer, 0, 0, 0, 0, 0)
+		code := []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH20)}
+		code = append(code, payer.Bytes()...)
+		code = append(code, byte(vm.GAS), byte(vm.CALL), byte(vm.POP), byte(vm.STOP))
+		for _, proxy := range proxies {
+			sdb.SetCode(proxy, code)
+		}
+	})
+	block := newTestBlock(
+		newTestTxRequest(carol, proxies[0], 0, 0, nil),
+		newTestTxRequest(dave, proxies[1], 0, 0, nil),
+	)
+
+	testExecutor(t, true, config.ExecutorBatch, len(block.Txns))
+	cfg := config.GetGlobalConfig()
+	cfg.IgnoreConflict = true
+	cfg.DiffExecution = true
+	cfg.DiffReportDir = t.TempDir()
+	chain.replay(t, block)
+
+	files, err := os.ReadDir(cfg.DiffReportDir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected 1 diff report, but got %d, %v", len(files), err)
+	}
+	byt, err := os.ReadFile(filepath.Join(cfg.DiffReportDir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	report := &DiffReport{}
+	if err = json.Unmarshal(byt, report); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if report.BlockHeight != 1 || report.ExecutorType != config.ExecutorBatch || report.ParallelRoot == report.SerialRoot {
+		t.Fatalf("Expected the roots of block 1 to diverge, but got %+v", report)
+	}
+	if len(report.ParallelTrace) != 2 || len(report.SerialTrace) != 2 {
+		t.Fatalf("Expected the traces of 2 txns, but got %d and %d", len(report.ParallelTrace), len(report.SerialTrace))
+	}
+	balances := make(map[common.Address]*BalanceDiff)
+	for _, diff := range report.BalanceDiffs {
+		balances[diff.Address] = diff
+	}
+	// both parallel txns paid the first account, the serial execution paid each of them once.
+	if diff, ok := balances[paid[1]]; !ok || diff.Parallel.ToInt().Sign() != 0 || diff.Serial.ToInt().Uint64() != 1000 {
+		t.Fatalf("Expected the balance diff of the second paid account, but got %+v", report.BalanceDiffs)
+	}
+	payerBalance := uint256.NewInt(params.Ether - 2000).ToBig()
+	if diff, ok := balances[payer]; !ok || diff.Serial.ToInt().Cmp(payerBalance) != 0 {
+		t.Fatalf("Expected the balance diff of the payer, but got %+v", report.BalanceDiffs)
+	}
+	if _, ok := balances[paid[0]]; ok {
+		t.Fatalf("Expected the first paid account to have the same balance")
+	}
+}
+
+func TestDiffExecutionKeepsObjectInc(t *testing.T) {
+	cfg := config.GetGlobalConfig()
+	asyncCommit := cfg.AsyncCommit
+	defer func() {
+		cfg.AsyncCommit = asyncCommit
+	}()
+	cfg.AsyncCommit = true
+
+	alice := common.HexToAddress("0xa1")
+	k := NewParallelEVM()
+	k.objectInc = map[common.Address]int{alice: 1}
+	k.shadowRun = true
+	k.prepareExecute()
+	k.updateTxnObjInc([]*txnCtx{newTestTxnCtx(t, alice, alice, nil)})
+	if k.objectInc[alice] != 1 {
+		t.Fatalf("Expected the shadow run to keep the object increments, but got %d", k.objectInc[alice])
+	}
+	k.shadowRun = false
+	k.prepareExecute()
+	if len(k.objectInc) != 0 {
+		t.Fatalf("Expected the object increments to be cleared, but got %v", k.objectInc)
+	}
+}
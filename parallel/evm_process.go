@@ -30,6 +30,9 @@ type ParallelEVM struct {
 	statManager *BlockTxnStatManager
 	objectInc   map[common2.Address]int
 	processor   EvmProcessor
+	// shadowRun is set while the serial executor re-executes the block in the
+	// differential mode, its receipts are not emitted.
+	shadowRun bool
 }
 
 func NewParallelEVM() *ParallelEVM {
@@ -40,7 +43,12 @@ func NewParallelEVM() *ParallelEVM {
 }
 
 func (k *ParallelEVM) setupProcessor() {
-	if config.GetGlobalConfig().IsParallel {
+	cfg := config.GetGlobalConfig()
+	if cfg.IsParallel {
+		if cfg.ExecutorType == config.ExecutorBlockStm {
+			k.processor = NewBlockStmEvmExecutor(k)
+			return
+		}
 		k.processor = NewParallelEvmExecutor(k)
 	} else {
 		k.processor = NewSerialEvmExecutor(k)
@@ -48,18 +56,42 @@ func (k *ParallelEVM) setupProcessor() {
 }
 
 func (k *ParallelEVM) Execute(block *types.Block) error {
-	k.statManager = &BlockTxnStatManager{TxnCount: len(block.Txns)}
-	k.db = k.Solidity.StateDB()
-	k.setupProcessor()
 	start := time.Now()
 	defer func() {
 		k.statManager.ExecuteDuration = time.Since(start)
 		k.statManager.UpdateMetrics()
+		GetConflictHeatmap().Roll()
 	}()
+	receipts := k.executeBlock(block)
+	return k.Commit(block, receipts)
+}
+
+// Replay executes the block on the current state like Execute, but nothing is
+// committed, it is used to re-execute the historical blocks offline.
+func (k *ParallelEVM) Replay(block *types.Block) (map[common.Hash]*types.Receipt, *BlockTxnStatManager) {
+	start := time.Now()
+	receipts := k.executeBlock(block)
+	k.statManager.ExecuteDuration = time.Since(start)
+	GetConflictHeatmap().Roll()
+	return receipts, k.statManager
+}
+
+func (k *ParallelEVM) executeBlock(block *types.Block) map[common.Hash]*types.Receipt {
+	k.statManager = &BlockTxnStatManager{TxnCount: len(block.Txns)}
+	k.db = k.Solidity.StateDB()
+	k.setupProcessor()
+	cfg := config.GetGlobalConfig()
+	var diff *diffExecution
+	if cfg.DiffExecution && cfg.IsParallel {
+		diff = k.newDiffExecution()
+	}
 	k.processor.Prepare(block)
 	k.processor.Execute(block)
 	receipts := k.processor.Receipts(block)
-	return k.Commit(block, receipts)
+	if diff != nil {
+		diff.check(block, receipts)
+	}
+	return receipts
 }
 
 func (k *ParallelEVM) Commit(block *types.Block, receipts map[common.Hash]*types.Receipt) error {
@@ -67,6 +99,18 @@ func (k *ParallelEVM) Commit(block *types.Block, receipts map[common.Hash]*types
 	defer func() {
 		k.statManager.CommitDuration = time.Since(commitStart)
 	}()
+	bloom, gasUsed, err := evm.FinalizeReceipts(block, receipts)
+	if err != nil {
+		return err
+	}
+	// LeiUsed is the gas used of the block, the base fee of the next block is calculated from it.
+	block.LeiUsed = gasUsed
+	if err = evm.WriteBlockBloom(k.Solidity.GetEthDB(), uint64(block.Height), bloom); err != nil {
+		return err
+	}
+	if err = evm.IndexBloomBits(k.Solidity.GetEthDB(), uint64(block.Height)); err != nil {
+		return err
+	}
 	return k.PostExecute(block, receipts)
 }
 
@@ -74,4 +118,6 @@ type EvmProcessor interface {
 	Prepare(block *types.Block)
 	Execute(block *types.Block)
 	Receipts(block *types.Block) map[common.Hash]*types.Receipt
+	// executedTxns returns the txns of the block, with the state contexts of their executions.
+	executedTxns() []*txnCtx
 }
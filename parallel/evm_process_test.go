@@ -0,0 +1,163 @@
+package parallel
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+	yu_common "github.com/yu-org/yu/common"
+	"github.com/yu-org/yu/core/env"
+	"github.com/yu-org/yu/core/tripod"
+	"github.com/yu-org/yu/core/types"
+
+	"github.com/reddio-com/reddio/config"
+	"github.com/reddio-com/reddio/evm"
+)
+
+var testCoinbase = common.HexToAddress("0x0c")
+
+// testChain is the committed genesis state the executors run the test blocks on.
+type testChain struct {
+	db   state.Database
+	root common.Hash
+}
+
+func newTestChain(t *testing.T, genesis func(sdb *state.StateDB)) *testChain {
+	db := rawdb.NewMemoryDatabase()
+	tdb := triedb.NewDatabase(db, triedb.HashDefaults)
+	sdb, _ := state.New(ethtypes.EmptyRootHash, state.NewDatabaseWithNodeDB(db, tdb), nil)
+	genesis(sdb)
+	root, err := sdb.Commit(0, true)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err = tdb.Commit(root, false); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return &testChain{db: state.NewDatabaseWithNodeDB(db, tdb), root: root}
+}
+
+// testExecutor switches the executor of the global config, and restores it when the test ends.
+func testExecutor(t *testing.T, isParallel bool, executorType string, concurrency int) {
+	cfg := config.GetGlobalConfig()
+	old := *cfg
+	t.Cleanup(func() {
+		*config.GetGlobalConfig() = old
+	})
+	cfg.IsParallel = isParallel
+	cfg.ExecutorType = executorType
+	cfg.MaxConcurrency = concurrency
+	cfg.AsyncCommit = false
+}
+
+// replay executes the block on the genesis state with the configured executor and returns
+// the receipts, the state root and the stats of the execution.
+func (c *testChain) replay(t *testing.T, block *types.Block) (map[yu_common.Hash]*types.Receipt, common.Hash, *BlockTxnStatManager) {
+	sdb, err := state.New(c.root, c.db, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	solidity := evm.NewStatelessSolidity(&evm.GethConfig{
+		ChainConfig: params.AllEthashProtocolChanges,
+		Coinbase:    testCoinbase,
+		Random:      &common.Hash{},
+		NoBaseFee:   true,
+	}, sdb)
+	k := NewParallelEVM()
+	land := tripod.NewLand()
+	tripods := make([]*tripod.Tripod, 0, 2)
+	for _, v := range []any{solidity, k} {
+		tri := tripod.ResolveTripod(v)
+		tri.SetChainEnv(&env.ChainEnv{})
+		tri.SetLand(land)
+		tri.SetInstance(v)
+		tripods = append(tripods, tri)
+	}
+	land.SetTripods(tripods...)
+	if err = tripod.InjectToTripod(k); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	solidity.StartBlock(block)
+	receipts, stat := k.Replay(block)
+	return receipts, solidity.IntermediateRoot(block), stat
+}
+
+// newTestBlock wraps the requests into the ExecuteTxn calls of block 1.
+func newTestBlock(reqs ...*evm.TxRequest) *types.Block {
+	block := &types.Block{
+		Header: &types.Header{Height: 1, Timestamp: 1, LeiLimit: 30000000},
+		Txns:   make(types.SignedTxns, 0, len(reqs)),
+	}
+	for i, req := range reqs {
+		byt, _ := json.Marshal(req)
+		block.Txns = append(block.Txns, &types.SignedTxn{
+			TxnHash: yu_common.Hash(common.BigToHash(big.NewInt(int64(i + 1)))),
+			Raw: &types.UnsignedTxn{WrCall: &yu_common.WrCall{
+				TripodName: "solidity",
+				FuncName:   "ExecuteTxn",
+				Params:     string(byt),
+			}},
+		})
+	}
+	return block
+}
+
+func newTestTxRequest(from, to common.Address, nonce uint64, value int64, input []byte) *evm.TxRequest {
+	var (
+		gas      = hexutil.Uint64(100000)
+		gasPrice = big.NewInt(params.GWei)
+		n        = hexutil.Uint64(nonce)
+	)
+	args, _ := json.Marshal(&evm.TempTransactionArgs{
+		From:     &from,
+		To:       &to,
+		Gas:      &gas,
+		GasPrice: (*hexutil.Big)(gasPrice),
+		Value:    (*hexutil.Big)(big.NewInt(value)),
+		Nonce:    &n,
+		Input:    (*hexutil.Bytes)(&input),
+	})
+	return &evm.TxRequest{
+		Input:      input,
+		Origin:     from,
+		Address:    &to,
+		GasLimit:   uint64(gas),
+		GasPrice:   gasPrice,
+		Value:      big.NewInt(value),
+		Nonce:      nonce,
+		V:          big.NewInt(27),
+		R:          big.NewInt(1),
+		S:          big.NewInt(1),
+		OriginArgs: args,
+	}
+}
+
+// checkSameExecution compares the receipts and the state root with the ones of the serial execution.
+func checkSameExecution(t *testing.T, block *types.Block, serialReceipts, receipts map[yu_common.Hash]*types.Receipt, serialRoot, root common.Hash) {
+	for i, stxn := range block.Txns {
+		expected := newReceiptTrace(stxn.TxnHash, serialReceipts[stxn.TxnHash])
+		got := newReceiptTrace(stxn.TxnHash, receipts[stxn.TxnHash])
+		if !expected.equal(got) {
+			t.Fatalf("Expected receipt %+v of txn %d, but got %+v", expected, i, got)
+		}
+	}
+	if root != serialRoot {
+		t.Fatalf("Expected state root %s, but got %s", serialRoot.Hex(), root.Hex())
+	}
+}
+
+func fundTestAccounts(addrs ...common.Address) func(sdb *state.StateDB) {
+	return func(sdb *state.StateDB) {
+		for _, addr := range addrs {
+			sdb.AddBalance(addr, uint256.NewInt(params.Ether), 0)
+		}
+	}
+}
@@ -14,6 +14,7 @@ type BlockTxnStatManager struct {
 	TxnBatchCount      int
 	TxnBatchRedoCount  int
 	ConflictCount      int
+	TxnReExecuteCount  int
 	ExecuteDuration    time.Duration
 	ExecuteTxnDuration time.Duration
 	PrepareDuration    time.Duration
@@ -28,8 +29,8 @@ func (stat *BlockTxnStatManager) UpdateMetrics() {
 	metrics.BlockTxnPrepareDurationGauge.WithLabelValues().Set(float64(stat.PrepareDuration.Seconds()))
 	metrics.BlockTxnCommitDurationGauge.WithLabelValues().Set(float64(stat.CommitDuration.Seconds()))
 	if config.GlobalConfig.IsBenchmarkMode {
-		logrus.Infof("execute %v txn, total:%v, execute cost:%v, prepare:%v, copy:%v, commit:%v, txnBatch:%v, conflict:%v, redoBatch:%v",
+		logrus.Infof("execute %v txn, total:%v, execute cost:%v, prepare:%v, copy:%v, commit:%v, txnBatch:%v, conflict:%v, redoBatch:%v, reExecute:%v",
 			stat.TxnCount, stat.ExecuteDuration.String(), stat.ExecuteTxnDuration.String(),
-			stat.PrepareDuration.String(), stat.CopyDuration.String(), stat.CommitDuration.String(), stat.TxnBatchCount, stat.ConflictCount, stat.TxnBatchRedoCount)
+			stat.PrepareDuration.String(), stat.CopyDuration.String(), stat.CommitDuration.String(), stat.TxnBatchCount, stat.ConflictCount, stat.TxnBatchRedoCount, stat.TxnReExecuteCount)
 	}
 }
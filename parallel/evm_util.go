@@ -16,35 +16,6 @@ import (
 	"github.com/reddio-com/reddio/metrics"
 )
 
-func checkAddressConflict(curTxn *txnCtx, curList []*txnCtx) bool {
-	for _, compare := range curList {
-
-		if curTxn.req.Address != nil && compare.req.Address != nil {
-			if *compare.req.Address == *curTxn.req.Address {
-				return true
-			}
-		}
-
-		if compare.req.Address != nil {
-			if *compare.req.Address == curTxn.req.Origin {
-				return true
-			}
-		}
-
-		if curTxn.req.Address != nil {
-			if compare.req.Origin == *curTxn.req.Address {
-				return true
-			}
-		}
-
-		if compare.req.Origin == curTxn.req.Origin {
-			return true
-		}
-
-	}
-	return false
-}
-
 type txnCtx struct {
 	ctx     *context.WriteContext
 	txn     *types.SignedTxn
@@ -52,15 +23,23 @@ type txnCtx struct {
 	req     *evm.TxRequest
 	err     error
 	ps      *pending_state.PendingStateWrapper
+	// sctx is the state context of the last execution, it is kept after ps is released.
+	sctx    *pending_state.StateContext
 	receipt *types.Receipt
 }
 
 func (k *ParallelEVM) handleTxnError(err error, ctx *context.WriteContext, block *types.Block, stxn *types.SignedTxn) *types.Receipt {
+	if k.shadowRun {
+		return shadowReceipt(err, ctx, block, stxn)
+	}
 	metrics.TxnCounter.WithLabelValues(txnLabelErrExecute).Inc()
 	return k.HandleError(err, ctx, block, stxn)
 }
 
 func (k *ParallelEVM) handleTxnEvent(ctx *context.WriteContext, block *types.Block, stxn *types.SignedTxn, isRedo bool) *types.Receipt {
+	if k.shadowRun {
+		return shadowReceipt(nil, ctx, block, stxn)
+	}
 	metrics.TxnCounter.WithLabelValues(txnLabelExecuteSuccess).Inc()
 	if isRedo {
 		metrics.TxnCounter.WithLabelValues(txnLabelRedoExecute).Inc()
@@ -69,10 +48,11 @@ func (k *ParallelEVM) handleTxnEvent(ctx *context.WriteContext, block *types.Blo
 }
 
 func (k *ParallelEVM) prepareExecute() {
-	if config.GetGlobalConfig().AsyncCommit {
-		//k.cpdb.ClearPendingCommitMark()
-		k.clearObjInc()
+	if !config.GetGlobalConfig().AsyncCommit || k.shadowRun {
+		return
 	}
+	//k.cpdb.ClearPendingCommitMark()
+	k.clearObjInc()
 }
 
 func (k *ParallelEVM) clearObjInc() {
@@ -80,7 +60,7 @@ func (k *ParallelEVM) clearObjInc() {
 }
 
 func (k *ParallelEVM) updateTxnObjSub(txns []*txnCtx) {
-	if !config.GetGlobalConfig().AsyncCommit {
+	if !config.GetGlobalConfig().AsyncCommit || k.shadowRun {
 		return
 	}
 	sub := func(key common2.Address) {
@@ -103,7 +83,7 @@ func (k *ParallelEVM) updateTxnObjSub(txns []*txnCtx) {
 }
 
 func (k *ParallelEVM) updateTxnObjInc(txns []*txnCtx) {
-	if !config.GetGlobalConfig().AsyncCommit {
+	if !config.GetGlobalConfig().AsyncCommit || k.shadowRun {
 		return
 	}
 	inc := func(key common2.Address) {
@@ -172,6 +152,7 @@ func (k *ParallelEVM) executeTxnCtxListInOrder(sdb *state.StateDB, list []*txnCt
 			tctx.receipt = k.handleTxnEvent(tctx.ctx, tctx.ctx.Block, tctx.txn, isRedo)
 		}
 		tctx.ps = tctx.ctx.ExtraInterface.(*pending_state.PendingStateWrapper)
+		tctx.sctx = tctx.ps.GetCtx()
 		list[index] = tctx
 	}
 	k.gcCopiedStateDB(nil, list)
@@ -0,0 +1,152 @@
+package parallel
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/reddio-com/reddio/evm/pending_state"
+)
+
+type mvKeyKind uint8
+
+const (
+	mvKeyAccount mvKeyKind = iota
+	mvKeyBalance
+	mvKeyNonce
+	mvKeyCode
+	mvKeyState
+)
+
+// mvKey identifies a single piece of state touched by a transaction.
+type mvKey struct {
+	kind mvKeyKind
+	addr common.Address
+	slot common.Hash
+}
+
+func (k mvKey) conflictKey() pending_state.ConflictKey {
+	if k.kind == mvKeyState {
+		return pending_state.ConflictKey{Address: k.addr, Slot: k.slot, IsSlot: true}
+	}
+	return pending_state.ConflictKey{Address: k.addr}
+}
+
+// mvVersion is the transaction (and its incarnation) which wrote a key.
+type mvVersion struct {
+	txnIndex    int
+	incarnation int
+}
+
+// mvMemory is the multi-version memory of the block-stm executor. It keeps
+// every committed write of the block, keyed by state key, in block order.
+type mvMemory struct {
+	sync.RWMutex
+	writes map[mvKey][]mvVersion
+}
+
+func newMVMemory() *mvMemory {
+	return &mvMemory{
+		writes: make(map[mvKey][]mvVersion),
+	}
+}
+
+// record stores the write set of a committed transaction. Transactions are
+// committed in block order, so the versions of each key stay sorted.
+func (m *mvMemory) record(v mvVersion, keys []mvKey) {
+	m.Lock()
+	defer m.Unlock()
+	for _, key := range keys {
+		m.writes[key] = append(m.writes[key], v)
+	}
+}
+
+// writtenBetween returns the latest version of key written by a transaction
+// whose index is in [from, to).
+func (m *mvMemory) writtenBetween(key mvKey, from, to int) (mvVersion, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	versions := m.writes[key]
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if v.txnIndex >= to {
+			continue
+		}
+		if v.txnIndex < from {
+			break
+		}
+		return v, true
+	}
+	return mvVersion{}, false
+}
+
+// readKeys returns the keys whose values the transaction depends on. Balance,
+// account and nonce writes are read-modify-write, so they count as reads too.
+// Every field of an account depends on the account, which is recreated or
+// destructed as a whole. The existence and the emptiness of an account are read
+// as the account, they change with any field of it.
+func readKeys(sctx *pending_state.StateContext, origin common.Address) []mvKey {
+	keys := make([]mvKey, 0)
+	seen := make(map[mvKey]struct{})
+	add := func(kind mvKeyKind, addr common.Address, slot common.Hash) {
+		for _, key := range []mvKey{{kind: kind, addr: addr, slot: slot}, {kind: mvKeyAccount, addr: addr}} {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	add(mvKeyNonce, origin, common.Hash{})
+	for addr := range sctx.Read.Account {
+		add(mvKeyBalance, addr, common.Hash{})
+		add(mvKeyNonce, addr, common.Hash{})
+		add(mvKeyCode, addr, common.Hash{})
+	}
+	for addr := range sctx.Read.Balance {
+		add(mvKeyBalance, addr, common.Hash{})
+	}
+	for addr := range sctx.Read.Nonce {
+		add(mvKeyNonce, addr, common.Hash{})
+	}
+	for addr := range sctx.Read.Code {
+		add(mvKeyCode, addr, common.Hash{})
+	}
+	for addr, slots := range sctx.Read.State {
+		for slot := range slots {
+			add(mvKeyState, addr, slot)
+		}
+	}
+	for addr := range sctx.Write.Balance {
+		add(mvKeyBalance, addr, common.Hash{})
+	}
+	for addr := range sctx.Write.Account {
+		add(mvKeyAccount, addr, common.Hash{})
+	}
+	for addr := range sctx.Write.Nonce {
+		add(mvKeyNonce, addr, common.Hash{})
+	}
+	return keys
+}
+
+// writeKeys returns the keys the transaction wrote.
+func writeKeys(sctx *pending_state.StateContext, origin common.Address) []mvKey {
+	keys := []mvKey{{kind: mvKeyNonce, addr: origin}}
+	for addr := range sctx.Write.Account {
+		keys = append(keys, mvKey{kind: mvKeyAccount, addr: addr})
+	}
+	for addr := range sctx.Write.Balance {
+		keys = append(keys, mvKey{kind: mvKeyBalance, addr: addr})
+	}
+	for addr := range sctx.Write.Nonce {
+		keys = append(keys, mvKey{kind: mvKeyNonce, addr: addr})
+	}
+	for addr := range sctx.Write.Code {
+		keys = append(keys, mvKey{kind: mvKeyCode, addr: addr})
+	}
+	for addr, slots := range sctx.Write.State {
+		for slot := range slots {
+			keys = append(keys, mvKey{kind: mvKeyState, addr: addr, slot: slot})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,87 @@
+package parallel
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/reddio-com/reddio/evm/pending_state"
+)
+
+func TestMVMemoryWrittenBetween(t *testing.T) {
+	key := mvKey{kind: mvKeyBalance, addr: common.HexToAddress("0x01")}
+	m := newMVMemory()
+	m.record(mvVersion{txnIndex: 1}, []mvKey{key})
+	m.record(mvVersion{txnIndex: 3, incarnation: 2}, []mvKey{key})
+	m.record(mvVersion{txnIndex: 5}, []mvKey{key})
+
+	cases := []struct {
+		from, to int
+		expected mvVersion
+		written  bool
+	}{
+		{0, 1, mvVersion{}, false},
+		{0, 3, mvVersion{txnIndex: 1}, true},
+		{0, 6, mvVersion{txnIndex: 5}, true},
+		{2, 5, mvVersion{txnIndex: 3, incarnation: 2}, true},
+		{4, 5, mvVersion{}, false},
+	}
+	for _, c := range cases {
+		v, written := m.writtenBetween(key, c.from, c.to)
+		if written != c.written || v != c.expected {
+			t.Fatalf("Expected %v, %v in [%d, %d), but got %v, %v", c.expected, c.written, c.from, c.to, v, written)
+		}
+	}
+	if _, written := m.writtenBetween(mvKey{kind: mvKeyNonce, addr: key.addr}, 0, 6); written {
+		t.Fatalf("Expected the nonce not to be written")
+	}
+}
+
+func TestReadKeys(t *testing.T) {
+	origin := common.HexToAddress("0x0a")
+	checked := common.HexToAddress("0x01")
+	contract := common.HexToAddress("0x02")
+	slot := common.HexToHash("0x03")
+
+	sctx := pending_state.NewStateContext(false)
+	// Exist, Empty and HasSelfDestructed read the account.
+	if err := sctx.ReadAccount(checked, 1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := sctx.ReadState(contract, slot, 1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	keys := readKeys(sctx, origin)
+	expected := []mvKey{
+		{kind: mvKeyNonce, addr: origin},
+		{kind: mvKeyAccount, addr: origin},
+		{kind: mvKeyAccount, addr: checked},
+		{kind: mvKeyBalance, addr: checked},
+		{kind: mvKeyNonce, addr: checked},
+		{kind: mvKeyCode, addr: checked},
+		{kind: mvKeyState, addr: contract, slot: slot},
+		{kind: mvKeyAccount, addr: contract},
+	}
+	for _, key := range expected {
+		if !slices.Contains(keys, key) {
+			t.Fatalf("Expected the read key %+v, but got %+v", key, keys)
+		}
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected %d distinct read keys, but got %+v", len(expected), keys)
+	}
+
+	// a balance written after the snapshot makes the emptiness read stale.
+	m := newMVMemory()
+	m.record(mvVersion{txnIndex: 0}, []mvKey{{kind: mvKeyBalance, addr: checked}})
+	stale := false
+	for _, key := range keys {
+		if _, written := m.writtenBetween(key, 0, 1); written {
+			stale = true
+		}
+	}
+	if !stale {
+		t.Fatalf("Expected the read of the account to be stale")
+	}
+}
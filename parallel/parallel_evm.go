@@ -6,7 +6,6 @@ import (
 	"sync"
 	"time"
 
-	common2 "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/yu-org/yu/common"
 	"github.com/yu-org/yu/core/types"
@@ -19,7 +18,9 @@ import (
 type ParallelEvmExecutor struct {
 	k          *ParallelEVM
 	cpdb       *state.StateDB
+	cpdbMu     sync.Mutex
 	receipts   map[common.Hash]*types.Receipt
+	txnList    []*txnCtx
 	subTxnList [][]*txnCtx
 }
 
@@ -34,6 +35,7 @@ func (e *ParallelEvmExecutor) Prepare(block *types.Block) {
 	txnCtxList, receipts := e.k.prepareTxnList(block)
 	e.receipts = receipts
 	e.k.updateTxnObjInc(txnCtxList)
+	e.txnList = txnCtxList
 	e.subTxnList = e.splitTxnCtxList(txnCtxList)
 	e.cpdb = e.k.Solidity.StateDBCopy()
 }
@@ -51,6 +53,10 @@ func (e *ParallelEvmExecutor) Receipts(block *types.Block) map[common.Hash]*type
 	return e.receipts
 }
 
+func (e *ParallelEvmExecutor) executedTxns() []*txnCtx {
+	return e.txnList
+}
+
 func (e *ParallelEvmExecutor) executeAllTxn(got [][]*txnCtx) [][]*txnCtx {
 	start := time.Now()
 	defer func() {
@@ -60,35 +66,86 @@ func (e *ParallelEvmExecutor) executeAllTxn(got [][]*txnCtx) [][]*txnCtx {
 		e.executeTxnCtxListInParallel(subList)
 		got[index] = subList
 	}
+	if key, reordered := e.reorderedConflict(got); reordered {
+		// the block is executed again in the block order on the state before it.
+		GetConflictHeatmap().Record([]pending_state.ConflictKey{key.conflictKey()})
+		e.k.statManager.ConflictCount++
+		e.k.statManager.TxnBatchRedoCount++
+		e.k.statManager.TxnReExecuteCount += len(e.txnList)
+		metrics.BatchTxnCounter.WithLabelValues(batchTxnLabelRedo).Inc()
+		for _, tctx := range e.txnList {
+			tctx.err = nil
+		}
+		e.cpdb = e.k.Solidity.StateDBCopy()
+		e.k.executeTxnCtxListInOrder(e.cpdb, e.txnList, true)
+	}
 	e.k.Solidity.SetStateDB(e.cpdb)
 	return got
 }
 
+// splitTxnCtxList splits the txns into batches along the conflict-free levels
+// of their dependency DAG, each batch holds at most MaxConcurrency txns.
 func (e *ParallelEvmExecutor) splitTxnCtxList(list []*txnCtx) [][]*txnCtx {
-	cur := 0
-	curList := make([]*txnCtx, 0)
 	got := make([][]*txnCtx, 0)
-	for cur < len(list) {
-		curTxnCtx := list[cur]
-		if checkAddressConflict(curTxnCtx, curList) {
-			got = append(got, curList)
-			curList = make([]*txnCtx, 0)
-			continue
+	maxConcurrency := config.GetGlobalConfig().MaxConcurrency
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+	for _, level := range buildTxnLevels(list) {
+		for len(level) > maxConcurrency {
+			got = append(got, level[:maxConcurrency])
+			level = level[maxConcurrency:]
 		}
-		curList = append(curList, curTxnCtx)
-		if len(curList) >= config.GetGlobalConfig().MaxConcurrency {
-			got = append(got, curList)
-			curList = make([]*txnCtx, 0)
+		if len(level) > 0 {
+			got = append(got, level)
 		}
-		cur++
-	}
-	if len(curList) > 0 {
-		got = append(got, curList)
 	}
 	e.k.statManager.TxnBatchCount = len(got)
 	return got
 }
 
+// reorderedConflict checks every txn against the later txns of the block which ran in
+// an earlier batch. The levels follow the access lists, which are only hints, so such a
+// txn may write a key the later txn read or wrote, or read a key it wrote. Then the state
+// is not the one of the block order, and the key is returned.
+func (e *ParallelEvmExecutor) reorderedConflict(batches [][]*txnCtx) (mvKey, bool) {
+	// the latest txn of the block order which read or wrote the key, in the former batches.
+	lastRead := make(map[mvKey]int)
+	lastWrite := make(map[mvKey]int)
+	for _, batch := range batches {
+		reads := make([][]mvKey, len(batch))
+		writes := make([][]mvKey, len(batch))
+		for i, tctx := range batch {
+			index := tctx.ctx.TxnIndex
+			reads[i] = readKeys(tctx.sctx, tctx.req.Origin)
+			writes[i] = writeKeys(tctx.sctx, tctx.req.Origin)
+			for _, key := range reads[i] {
+				if w, ok := lastWrite[key]; ok && w > index {
+					return key, true
+				}
+			}
+			for _, key := range writes[i] {
+				if w, ok := lastWrite[key]; ok && w > index {
+					return key, true
+				}
+				if r, ok := lastRead[key]; ok && r > index {
+					return key, true
+				}
+			}
+		}
+		for i, tctx := range batch {
+			index := tctx.ctx.TxnIndex
+			for _, key := range reads[i] {
+				lastRead[key] = max(lastRead[key], index)
+			}
+			for _, key := range writes[i] {
+				lastWrite[key] = max(lastWrite[key], index)
+			}
+		}
+	}
+	return mvKey{}, false
+}
+
 func (e *ParallelEvmExecutor) executeTxnCtxListInParallel(list []*txnCtx) []*txnCtx {
 	metrics.BatchTxnSplitCounter.WithLabelValues(strconv.FormatInt(int64(len(list)), 10)).Inc()
 	return e.executeTxnCtxListInConcurrency(list)
@@ -118,17 +175,22 @@ func (e *ParallelEvmExecutor) executeTxnCtxListInConcurrency(list []*txnCtx) []*
 				tctx.receipt = e.k.handleTxnEvent(tctx.ctx, tctx.ctx.Block, tctx.txn, false)
 			}
 			tctx.ps = tctx.ctx.ExtraInterface.(*pending_state.PendingStateWrapper)
+			tctx.sctx = tctx.ps.GetCtx()
 			list[index] = tctx
 		}(i, c, copiedStateDBList[i])
 	}
 	wg.Wait()
+	// curtCtx holds the visits of the txns of the batch before tctx.
 	curtCtx := pending_state.NewStateContext(false)
 	for _, tctx := range list {
-		if curtCtx.IsConflict(tctx.ps.GetCtx()) {
+		sctx := tctx.ps.GetCtx()
+		if curtCtx.IsConflict(sctx) {
 			conflict = true
 			e.k.statManager.ConflictCount++
+			GetConflictHeatmap().Record(curtCtx.ConflictKeys(sctx))
 			break
 		}
+		curtCtx.Merge(sctx)
 	}
 	if conflict && !config.GetGlobalConfig().IgnoreConflict {
 		e.k.statManager.TxnBatchRedoCount++
@@ -147,21 +209,16 @@ func (e *ParallelEvmExecutor) mergeStateDB(list []*txnCtx) {
 	}
 }
 
+// CopyStateDb creates a copy-on-write overlay of e.cpdb for every txn.
 func (e *ParallelEvmExecutor) CopyStateDb(list []*txnCtx) []*pending_state.PendingStateWrapper {
-	copiedStateDBList := make([]*pending_state.PendingStateWrapper, 0)
+	copiedStateDBList := make([]*pending_state.PendingStateWrapper, 0, len(list))
 	start := time.Now()
 	defer func() {
 		e.k.statManager.CopyDuration += time.Since(start)
 	}()
 	for i := 0; i < len(list); i++ {
-		needCopy := make(map[common2.Address]struct{})
-		if list[i].req.Address != nil {
-			needCopy[*list[i].req.Address] = struct{}{}
-		}
-		needCopy[list[i].req.Origin] = struct{}{}
-		//copiedStateDBList = append(copiedStateDBList, pending_state.NewPendingStateWrapper(pending_state.NewStateDBWrapper(e.cpdb.SimpleCopy(needCopy)), pending_state.NewStateContext(false), int64(i)))
-		copiedStateDBList = append(copiedStateDBList, pending_state.NewPendingStateWrapper(pending_state.NewStateDBWrapper(e.cpdb.Copy()), pending_state.NewStateContext(false), int64(i)))
-
+		overlay := pending_state.NewOverlayStateDB(e.cpdb, &e.cpdbMu)
+		copiedStateDBList = append(copiedStateDBList, pending_state.NewPendingStateWrapper(pending_state.NewOverlayStateDBWrapper(overlay), pending_state.NewStateContext(false), int64(i)))
 	}
 	return copiedStateDBList
 }
@@ -0,0 +1,88 @@
+package parallel
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+
+	"github.com/reddio-com/reddio/config"
+)
+
+// TestParallelEvmReorderedConflict schedules a txn before an earlier txn of the block it
+// depends on, which its footprint does not show. The block is executed again in the block order.
+func TestParallelEvmReorderedConflict(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0xa1")
+		bob   = common.HexToAddress("0xb0")
+		fresh = common.HexToAddress("0xf0")
+		// SSTORE(0, EXTCODEHASH(fresh))
+		codeHashOf = common.HexToAddress("0x1001")
+	)
+	chain := newTestChain(t, func(sdb *state.StateDB) {
+		fundTestAccounts(alice, bob)(sdb)
+		code := append([]byte{byte(vm.PUSH20)}, fresh.Bytes()...)
+		sdb.SetCode(codeHashOf, append(code, byte(vm.EXTCODEHASH), byte(vm.PUSH1), 0, byte(vm.SSTORE), byte(vm.STOP)))
+	})
+	block := newTestBlock(
+		newTestTxRequest(alice, common.HexToAddress("0x01"), 0, 1, nil),
+		// it is in level 1 after the first txn of alice.
+		newTestTxRequest(alice, fresh, 1, 1000, nil),
+		// it is in level 0, but it reads the account funded by the txn before it.
+		newTestTxRequest(bob, codeHashOf, 0, 0, nil),
+	)
+
+	testExecutor(t, false, "", 1)
+	serialReceipts, serialRoot, _ := chain.replay(t, block)
+
+	testExecutor(t, true, config.ExecutorBatch, len(block.Txns))
+	receipts, root, _ := chain.replay(t, block)
+	checkSameExecution(t, block, serialReceipts, receipts, serialRoot, root)
+}
+
+// TestParallelEvmBatchConflict executes two txns of the same batch which update the same
+// slot through different contracts. The batch is executed again in the block order.
+func TestParallelEvmBatchConflict(t *testing.T) {
+	var (
+		carol = common.HexToAddress("0xc0")
+		dave  = common.HexToAddress("0xd0")
+		// SSTORE(0, SLOAD(0) + 1)
+		counter = common.HexToAddress("0x1003")
+		// CALL(GAS, counter, 0, 0, 0, 0, 0)
+		proxies = []common.Address{common.HexToAddress("0x2001"), common.HexToAddress("0x2002")}
+	)
+	chain := newTestChain(t, func(sdb *state.StateDB) {
+		fundTestAccounts(carol, dave)(sdb)
+		sdb.SetCode(counter, []byte{byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE), byte(vm.STOP)})
+		code := []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH20)}
+		code = append(code, counter.Bytes()...)
+		code = append(code, byte(vm.GAS), byte(vm.CALL), byte(vm.POP), byte(vm.STOP))
+		for _, proxy := range proxies {
+			sdb.SetCode(proxy, code)
+		}
+	})
+	block := newTestBlock(
+		newTestTxRequest(carol, proxies[0], 0, 0, nil),
+		newTestTxRequest(dave, proxies[1], 0, 0, nil),
+	)
+
+	testExecutor(t, false, "", 1)
+	serialReceipts, serialRoot, _ := chain.replay(t, block)
+
+	testExecutor(t, true, config.ExecutorBatch, len(block.Txns))
+	receipts, root, stat := chain.replay(t, block)
+	checkSameExecution(t, block, serialReceipts, receipts, serialRoot, root)
+	if stat.TxnBatchCount != 1 || stat.ConflictCount != 1 || stat.TxnBatchRedoCount != 1 {
+		t.Fatalf("Expected the only batch to conflict and be redone, but got %+v", stat)
+	}
+	hot := false
+	for _, heat := range GetConflictHeatmap().Top(-1).HotKeys {
+		if heat.Address == counter && heat.Slot != nil && *heat.Slot == (common.Hash{}) {
+			hot = true
+		}
+	}
+	if !hot {
+		t.Fatalf("Expected the slot of the counter to be recorded in the heatmap")
+	}
+}
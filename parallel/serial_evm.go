@@ -48,6 +48,10 @@ func (s *SerialEvmExecutor) Receipts(block *types.Block) map[common.Hash]*types.
 	return s.receipts
 }
 
+func (s *SerialEvmExecutor) executedTxns() []*txnCtx {
+	return s.txnCtxList
+}
+
 func (s *SerialEvmExecutor) executeTxnCtxListInSerial(list []*txnCtx) []*txnCtx {
 	defer func() {
 		if config.GetGlobalConfig().AsyncCommit {